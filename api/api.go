@@ -26,6 +26,23 @@ type Metric struct {
 // Metrics holds host metrics.
 type Metrics map[string]Metric
 
+// MetricQuery defines the metrics selected, server side, when retrieving metrics.
+type MetricQuery struct {
+	Include  []string // metric name regular expressions, metric is included if any match
+	Exclude  []string // metric name regular expressions, metric is excluded if any match
+	Tags     []string // tag selectors (category:value or category:*), all must match
+	Conduits []string // builtins, plugins, receiver, statsd, prometheus (default all)
+}
+
+// ConduitMetrics defines the last metrics flushed from a conduit.
+type ConduitMetrics struct {
+	Metrics   Metrics `json:"metrics"`
+	LastFlush string  `json:"last_flush"` // RFC3339
+}
+
+// Peek holds the last metrics flushed, by conduit.
+type Peek map[string]ConduitMetrics
+
 // Inventory defines list of active plugins.
 type Inventory []Plugin
 
@@ -50,6 +67,7 @@ var (
 	errInvalidGroupID      = fmt.Errorf("invalid group id (empty)")
 	errInvalidMetrics      = fmt.Errorf("invalid metrics (nil)")
 	errInvalidMetricList   = fmt.Errorf("invalid metrics (none)")
+	errInvalidQuery        = fmt.Errorf("invalid query, conduits cannot be combined with a plugin ID")
 )
 
 // New creates a new circonus-agent api client.
@@ -9,6 +9,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strings"
 )
 
 // Metrics retrieves metrics from one or all plugins
@@ -26,6 +28,24 @@ func (c *Client) Metrics(pluginID string) (*Metrics, error) {
 //	agent will act as though any other client (e.g. a broker)
 //	were requesting metrics - it will *run* the plugin(s).
 func (c *Client) MetricsWithContext(ctx context.Context, pluginID string) (*Metrics, error) {
+	return c.MetricsQueryWithContext(ctx, pluginID, nil)
+}
+
+// MetricsQuery retrieves metrics from one or all plugins, filtered by the agent
+// NOTE: metrics not selected by the query are still collected (and discarded)
+//
+//	by the agent - the plugin(s) are *run*, accumulated metrics (receiver,
+//	statsd, prometheus) are copied, not flushed, when the query filters metrics.
+func (c *Client) MetricsQuery(pluginID string, query *MetricQuery) (*Metrics, error) {
+	return c.MetricsQueryWithContext(context.Background(), pluginID, query)
+}
+
+// MetricsQueryWithContext retrieves metrics from one or all plugins, filtered by the agent
+// NOTE: metrics not selected by the query are still collected (and discarded)
+//
+//	by the agent - the plugin(s) are *run*, accumulated metrics (receiver,
+//	statsd, prometheus) are copied, not flushed, when the query filters metrics.
+func (c *Client) MetricsQueryWithContext(ctx context.Context, pluginID string, query *MetricQuery) (*Metrics, error) {
 	pid := ""
 	if pluginID != "" {
 		if !c.pidVal.MatchString(pluginID) {
@@ -37,6 +57,12 @@ func (c *Client) MetricsWithContext(ctx context.Context, pluginID string) (*Metr
 	if pid != "" {
 		rpath += "/" + pid
 	}
+	if query != nil && pid != "" && len(query.Conduits) > 0 {
+		return nil, errInvalidQuery
+	}
+	if qs := query.values(); len(qs) > 0 {
+		rpath += "?" + qs.Encode()
+	}
 
 	data, err := c.get(ctx, rpath)
 	if err != nil {
@@ -50,3 +76,24 @@ func (c *Client) MetricsWithContext(ctx context.Context, pluginID string) (*Metr
 
 	return &v, nil
 }
+
+// values returns the query parameters for a metric query.
+func (q *MetricQuery) values() url.Values {
+	qs := url.Values{}
+	if q == nil {
+		return qs
+	}
+	for _, v := range q.Include {
+		qs.Add("include", v)
+	}
+	for _, v := range q.Exclude {
+		qs.Add("exclude", v)
+	}
+	for _, v := range q.Tags {
+		qs.Add("tag", v)
+	}
+	if len(q.Conduits) > 0 {
+		qs.Set("conduit", strings.Join(q.Conduits, ","))
+	}
+	return qs
+}
@@ -8,6 +8,7 @@ package api
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -58,3 +59,59 @@ func TestMetrics(t *testing.T) {
 		ts.Close()
 	}
 }
+
+func TestMetricsQuery(t *testing.T) {
+	t.Log("Testing MetricsQuery")
+
+	tests := []struct {
+		query         *MetricQuery
+		name          string
+		pluginID      string
+		expectedQuery string
+		expectedErr   string
+		shouldErr     bool
+	}{
+		{nil, "nil query", "", "", "", false},
+		{&MetricQuery{}, "empty query", "", "", "", false},
+		{&MetricQuery{Include: []string{"^cpu_", "^mem_"}, Exclude: []string{"idle$"}}, "include/exclude", "", "exclude=idle%24&include=%5Ecpu_&include=%5Emem_", "", false},
+		{&MetricQuery{Tags: []string{"collector:procfs/cpu"}}, "tags", "cpu", "tag=collector%3Aprocfs%2Fcpu", "", false},
+		{&MetricQuery{Conduits: []string{"builtins", "statsd"}}, "conduits", "", "conduit=builtins%2Cstatsd", "", false},
+		{&MetricQuery{Conduits: []string{"statsd"}}, "invalid (conduits w/plugin id)", "cpu", "", "invalid query, conduits cannot be combined with a plugin ID", true},
+		{&MetricQuery{Include: []string{"("}}, "invalid (server)", "", "", "", true},
+	}
+
+	for _, test := range tests {
+		tc := test
+		t.Log("\t", tc.name)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Query().Get("include"), "(") {
+				http.Error(w, "invalid include", http.StatusBadRequest)
+				return
+			}
+			if r.URL.RawQuery != tc.expectedQuery {
+				t.Errorf("expected query %q, got %q", tc.expectedQuery, r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`{"cpu_user":{"_type":"L", "_value":1}}`))
+		}))
+
+		c, err := New(ts.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+
+		_, err = c.MetricsQuery(tc.pluginID, tc.query)
+
+		if tc.shouldErr {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tc.expectedErr != "" && err.Error() != tc.expectedErr {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+		} else if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+
+		ts.Close()
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Peek retrieves the last metrics flushed from each conduit, optionally
+// filtered by the agent. Unlike Metrics, plugins are not run and the
+// conduits are not flushed - it does not take metrics from the broker.
+func (c *Client) Peek(query *MetricQuery) (*Peek, error) {
+	return c.PeekWithContext(context.Background(), query)
+}
+
+// PeekWithContext retrieves the last metrics flushed from each conduit, optionally
+// filtered by the agent. Unlike Metrics, plugins are not run and the
+// conduits are not flushed - it does not take metrics from the broker.
+func (c *Client) PeekWithContext(ctx context.Context, query *MetricQuery) (*Peek, error) {
+	rpath := "/peek"
+	if qs := query.values(); len(qs) > 0 {
+		rpath += "?" + qs.Encode()
+	}
+
+	data, err := c.get(ctx, rpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var v Peek
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("json parse - peek: %w", err)
+	}
+
+	return &v, nil
+}
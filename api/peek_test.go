@@ -0,0 +1,68 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPeek(t *testing.T) {
+	t.Log("Testing Peek")
+
+	tests := []struct {
+		query         *MetricQuery
+		name          string
+		response      string
+		expectedQuery string
+		expectedErr   string
+		shouldErr     bool
+	}{
+		{nil, "invalid (json/parse)", "invalid", "", "json parse - peek: invalid character 'i' looking for beginning of value", true},
+		{nil, "valid", `{"builtins":{"metrics":{"foo":{"_type":"n","_value":3.12}},"last_flush":"2024-01-01T00:00:00Z"}}`, "", "", false},
+		{&MetricQuery{Conduits: []string{"statsd"}, Include: []string{"^foo"}}, "valid (query)", `{"statsd":{"metrics":{},"last_flush":"2024-01-01T00:00:00Z"}}`, "conduit=statsd&include=%5Efoo", "", false},
+	}
+
+	for _, test := range tests {
+		tc := test
+		t.Log("\t", tc.name)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/peek" {
+				t.Errorf("expected path /peek, got %s", r.URL.Path)
+			}
+			if r.URL.RawQuery != tc.expectedQuery {
+				t.Errorf("expected query %q, got %q", tc.expectedQuery, r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(tc.response))
+		}))
+
+		c, err := New(ts.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+
+		p, err := c.Peek(tc.query)
+
+		if tc.shouldErr {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if err.Error() != tc.expectedErr {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+		} else {
+			if err != nil {
+				t.Fatalf("expected no error, got (%s)", err)
+			}
+			if len(*p) != 1 {
+				t.Fatalf("expected 1 conduit, got %d", len(*p))
+			}
+		}
+
+		ts.Close()
+	}
+}
@@ -833,6 +833,81 @@ func init() {
 		viper.SetDefault(key, defaults.SSLVerify)
 	}
 
+	{
+		const (
+			key          = config.KeySSLClientCAFile
+			longOpt      = "ssl-client-ca-file"
+			defaultValue = ""
+			envVar       = release.ENVPREFIX + "_SSL_CLIENT_CA_FILE"
+			description  = "SSL CA bundle used to verify client certificates (mTLS)"
+		)
+
+		RootCmd.Flags().String(longOpt, defaultValue, desc(description, envVar))
+		if err := viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)); err != nil {
+			bindFlagError(longOpt, err)
+		}
+		if err := viper.BindEnv(key, envVar); err != nil {
+			bindEnvError(envVar, err)
+		}
+	}
+
+	{
+		const (
+			key          = config.KeySSLClientAuth
+			longOpt      = "ssl-client-auth"
+			defaultValue = defaults.SSLClientAuth
+			envVar       = release.ENVPREFIX + "_SSL_CLIENT_AUTH"
+			description  = "SSL client certificate verification (optional|require) - requires ssl-client-ca-file"
+		)
+
+		RootCmd.Flags().String(longOpt, defaultValue, desc(description, envVar))
+		if err := viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)); err != nil {
+			bindFlagError(longOpt, err)
+		}
+		if err := viper.BindEnv(key, envVar); err != nil {
+			bindEnvError(envVar, err)
+		}
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key         = config.KeySSLClientAllow
+			longOpt     = "ssl-client-allow"
+			envVar      = release.ENVPREFIX + "_SSL_CLIENT_ALLOW"
+			description = "SSL client certificate subjects (CN or SAN) allowed to connect - requires ssl-client-ca-file"
+		)
+
+		RootCmd.Flags().StringSlice(longOpt, []string{}, desc(description, envVar))
+		if err := viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)); err != nil {
+			bindFlagError(longOpt, err)
+		}
+		if err := viper.BindEnv(key, envVar); err != nil {
+			bindEnvError(envVar, err)
+		}
+	}
+
+	//
+	// API auth
+	//
+	{
+		const (
+			key          = config.KeyAPIAuthFile
+			longOpt      = "api-auth-file"
+			defaultValue = ""
+			envVar       = release.ENVPREFIX + "_API_AUTH_FILE"
+			description  = "API auth config file (json|toml|yaml) with bearer tokens and client cert subjects and their scopes - setting enables API auth"
+		)
+
+		RootCmd.Flags().String(longOpt, defaultValue, desc(description, envVar))
+		if err := viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)); err != nil {
+			bindFlagError(longOpt, err)
+		}
+		if err := viper.BindEnv(key, envVar); err != nil {
+			bindEnvError(envVar, err)
+		}
+	}
+
 	//
 	// StatsD
 	//
@@ -1110,6 +1185,82 @@ func init() {
 		viper.SetDefault(key, defaults.DisableGzip)
 	}
 
+	{
+		const (
+			key          = config.KeyMetricsCacheTTL
+			longOpt      = "metrics-cache-ttl"
+			defaultValue = defaults.MetricsCacheTTL
+			envVar       = release.ENVPREFIX + "_METRICS_CACHE_TTL"
+			description  = "Serve /metrics from metrics flushed by /run within TTL, otherwise collect on demand (0 always collects)"
+		)
+
+		RootCmd.Flags().String(longOpt, defaultValue, desc(description, envVar))
+		if err := viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)); err != nil {
+			bindFlagError(longOpt, err)
+		}
+		if err := viper.BindEnv(key, envVar); err != nil {
+			bindEnvError(envVar, err)
+		}
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = config.KeyResponseCacheTTL
+			longOpt      = "response-cache-ttl"
+			defaultValue = defaults.ResponseCacheTTL
+			envVar       = release.ENVPREFIX + "_RESPONSE_CACHE_TTL"
+			description  = "Share an encoded /run response with identical requests within TTL, later requests get the cached response without a new collection (0 shares only with concurrent requests)"
+		)
+
+		RootCmd.Flags().String(longOpt, defaultValue, desc(description, envVar))
+		if err := viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)); err != nil {
+			bindFlagError(longOpt, err)
+		}
+		if err := viper.BindEnv(key, envVar); err != nil {
+			bindEnvError(envVar, err)
+		}
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = config.KeyDrainOwner
+			longOpt      = "drain-owner"
+			defaultValue = defaults.DrainOwner
+			envVar       = release.ENVPREFIX + "_DRAIN_OWNER"
+			description  = "Consumer which drains receiver, statsd and prometheus metrics (any|run|metrics|multiagent), others get a copy"
+		)
+
+		RootCmd.Flags().String(longOpt, defaultValue, desc(description, envVar))
+		if err := viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)); err != nil {
+			bindFlagError(longOpt, err)
+		}
+		if err := viper.BindEnv(key, envVar); err != nil {
+			bindEnvError(envVar, err)
+		}
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = config.KeyShutdownTimeout
+			longOpt      = "shutdown-timeout"
+			defaultValue = defaults.ShutdownTimeout
+			envVar       = release.ENVPREFIX + "_SHUTDOWN_TIMEOUT"
+			description  = "Time to wait for in-flight requests, plugins and final submissions when stopping"
+		)
+
+		RootCmd.Flags().String(longOpt, defaultValue, desc(description, envVar))
+		if err := viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)); err != nil {
+			bindFlagError(longOpt, err)
+		}
+		if err := viper.BindEnv(key, envVar); err != nil {
+			bindEnvError(envVar, err)
+		}
+		viper.SetDefault(key, defaultValue)
+	}
+
 	{
 		const (
 			key         = config.KeyDebug
@@ -6,6 +6,7 @@ require (
 	github.com/bi-zone/wmi v1.1.4
 	github.com/circonus-labs/circonus-gometrics/v3 v3.4.7
 	github.com/circonus-labs/go-apiclient v0.7.24
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/gojuno/minimock/v3 v3.3.6
 	github.com/google/uuid v1.6.0
 	github.com/hashicorp/go-retryablehttp v0.7.5
@@ -20,6 +21,7 @@ require (
 	github.com/spf13/viper v1.18.2
 	golang.org/x/sync v0.6.0
 	golang.org/x/sys v0.16.0
+	google.golang.org/protobuf v1.32.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins"
 	"github.com/circonus-labs/circonus-agent/internal/check"
@@ -41,6 +42,7 @@ type Agent struct {
 	signalCh     chan os.Signal
 	statsdServer *statsd.Server
 	logger       zerolog.Logger
+	stopTimeout  time.Duration
 }
 
 // New returns a new agent instance.
@@ -62,6 +64,19 @@ func New() (*Agent, error) {
 		return nil, fmt.Errorf("config validate: %w", err)
 	}
 
+	if err := config.ApplyHostMode(); err != nil {
+		return nil, fmt.Errorf("host mode: %w", err)
+	}
+
+	timeout := viper.GetString(config.KeyShutdownTimeout)
+	if timeout == "" {
+		timeout = defaults.ShutdownTimeout
+	}
+	a.stopTimeout, err = time.ParseDuration(timeout)
+	if err != nil {
+		return nil, fmt.Errorf("shutdown timeout: %w", err)
+	}
+
 	a.check, err = check.New(nil)
 	if err != nil {
 		return nil, fmt.Errorf("init check: %w", err)
@@ -89,6 +104,7 @@ func New() (*Agent, error) {
 	if err != nil {
 		return nil, fmt.Errorf("init server: %w", err)
 	}
+	a.listenServer.SetStopTimeout(a.stopTimeout)
 
 	agentAddress, err := a.listenServer.GetReverseAgentAddress()
 	if err != nil {
@@ -96,10 +112,11 @@ func New() (*Agent, error) {
 	}
 
 	if viper.GetBool(config.KeyReverse) {
-		a.reverseConn, err = reverse.New(a.logger, a.check, agentAddress)
+		a.reverseConn, err = reverse.New(a.logger, a.check, agentAddress, a.listenServer.GetReverseAgentToken())
 		if err != nil {
 			return nil, fmt.Errorf("init reverse: %w", err)
 		}
+		a.listenServer.AddHealthCheck("reverse", true, a.reverseConn.Health)
 	}
 
 	if viper.GetBool(config.KeyMultiAgent) {
@@ -107,6 +124,7 @@ func New() (*Agent, error) {
 		if err != nil {
 			return nil, fmt.Errorf("init multi-agent: %w", err)
 		}
+		a.listenServer.AddHealthCheck("multiagent", true, a.submitter.Health)
 	}
 
 	a.signalNotifySetup()
@@ -150,6 +168,7 @@ func (a *Agent) Start() error {
 // Stop cleans up and shuts down the Agent.
 func (a *Agent) Stop() {
 	a.stopSignalHandler()
+	a.shutdown()
 	a.groupCancel()
 
 	a.logger.Debug().
@@ -158,6 +177,42 @@ func (a *Agent) Stop() {
 		Str("ver", release.VERSION).Msg("Stopped")
 }
 
+// shutdown stops the agent components in order, within the shutdown timeout:
+// stop accepting connections and drain in-flight requests, stop plugins,
+// flush statsd group metrics and submit a final multi-agent payload. Anything
+// still running at the deadline is cancelled with the agent context.
+func (a *Agent) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.stopTimeout)
+	defer cancel()
+
+	start := time.Now()
+	a.logger.Info().Str("timeout", a.stopTimeout.String()).Msg("shutting down")
+
+	if a.listenServer != nil {
+		if err := a.listenServer.Shutdown(ctx); err != nil {
+			a.logger.Warn().Err(err).Msg("draining requests")
+		}
+	}
+
+	if a.plugins != nil {
+		if err := a.plugins.Stop(ctx); err != nil {
+			a.logger.Warn().Err(err).Msg("stopping plugins")
+		}
+	}
+
+	if a.statsdServer != nil {
+		a.statsdServer.FlushGroup()
+	}
+
+	if a.submitter != nil {
+		if err := a.submitter.Flush(ctx); err != nil {
+			a.logger.Warn().Err(err).Msg("submitting final multi-agent metrics")
+		}
+	}
+
+	a.logger.Info().Str("duration", time.Since(start).String()).Msg("shutdown complete")
+}
+
 // stopSignalHandler disables the signal handler.
 func (a *Agent) stopSignalHandler() {
 	signal.Stop(a.signalCh)
@@ -161,6 +161,14 @@ func (b *Builtins) IsBuiltin(id string) bool {
 	return ok
 }
 
+// Health returns the number of configured collectors, for readiness.
+func (b *Builtins) Health() (string, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	return fmt.Sprintf("%d collectors", len(b.collectors)), nil
+}
+
 // Flush returns current metrics for all collectors.
 func (b *Builtins) Flush(id string) *cgm.Metrics {
 	b.Lock()
@@ -184,3 +192,20 @@ func (b *Builtins) Flush(id string) *cgm.Metrics {
 
 	return &metrics
 }
+
+// Snapshot returns a copy of the current metrics for all collectors, metrics
+// which are only returned once (e.g. prometheus histograms) are not reset.
+func (b *Builtins) Snapshot(id string) *cgm.Metrics {
+	b.Lock()
+	defer b.Unlock()
+
+	metrics := cgm.Metrics{}
+
+	for _, c := range b.collectors {
+		for name, val := range c.Snapshot() {
+			metrics[name] = val
+		}
+	}
+
+	return &metrics
+}
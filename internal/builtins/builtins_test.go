@@ -46,6 +46,11 @@ func (f *foo) Flush() cgm.Metrics {
 	defer f.Unlock()
 	return f.lastMetrics
 }
+func (f *foo) Snapshot() cgm.Metrics {
+	f.Lock()
+	defer f.Unlock()
+	return f.lastMetrics
+}
 func (f *foo) ID() string {
 	f.Lock()
 	defer f.Unlock()
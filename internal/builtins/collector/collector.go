@@ -20,6 +20,7 @@ type Collector interface {
 	ID() string
 	Inventory() InventoryStats
 	Logger() zerolog.Logger
+	Snapshot() cgm.Metrics
 }
 
 // InventoryStats defines the stats a collector exposes for the /inventory endpoint.
@@ -50,6 +50,17 @@ func (c *gencommon) Flush() cgm.Metrics {
 	return c.lastMetrics
 }
 
+// Snapshot returns a copy of the last metrics collected.
+func (c *gencommon) Snapshot() cgm.Metrics {
+	c.Lock()
+	defer c.Unlock()
+	metrics := make(cgm.Metrics, len(c.lastMetrics))
+	for mn, mv := range c.lastMetrics {
+		metrics[mn] = mv
+	}
+	return metrics
+}
+
 // ID returns the id of the instance.
 func (c *gencommon) ID() string {
 	c.Lock()
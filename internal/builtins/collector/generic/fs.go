@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -135,7 +136,7 @@ func (c *FS) Collect(ctx context.Context) error {
 	c.Unlock()
 
 	metrics := cgm.Metrics{}
-	partitions, err := disk.PartitionsWithContext(ctx, c.allFSDevices)
+	partitions, err := disk.PartitionsWithContext(config.HostContext(ctx), c.allFSDevices)
 	if err != nil {
 		c.logger.Warn().Err(err).Msg("collecting disk filesystem/partition metrics")
 		c.setStatus(metrics, nil)
@@ -161,7 +162,8 @@ func (c *FS) Collect(ctx context.Context) error {
 
 		l.Debug().Msg("filesystem")
 
-		usage, err := disk.UsageWithContext(ctx, partition.Mountpoint)
+		// in host mode, mount points are reached through the host's root (<host_proc>/1/root)
+		usage, err := disk.UsageWithContext(ctx, filepath.Join(config.HostRootPath(), partition.Mountpoint))
 		if err != nil {
 			l.Warn().Err(err).Msg("collecting disk usage")
 			continue
@@ -90,7 +90,7 @@ func (c *Load) Collect(ctx context.Context) error {
 	tagUnitsProcesses := tags.Tag{Category: "units", Value: "processes"}
 
 	metrics := cgm.Metrics{}
-	loadavg, err := load.Avg()
+	loadavg, err := load.AvgWithContext(config.HostContext(ctx))
 	if err != nil {
 		c.logger.Warn().Err(err).Msg("collecting load metrics")
 	} else {
@@ -106,7 +106,7 @@ func (c *Load) Collect(ctx context.Context) error {
 		}
 	}
 
-	misc, err := load.MiscWithContext(ctx)
+	misc, err := load.MiscWithContext(config.HostContext(ctx))
 	if err != nil {
 		c.logger.Warn().Err(err).Msg("collecting misc load metrics")
 		c.setStatus(metrics, nil)
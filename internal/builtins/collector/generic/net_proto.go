@@ -105,7 +105,7 @@ func (c *Proto) Collect(ctx context.Context) error {
 	//
 
 	metrics := cgm.Metrics{}
-	counters, err := net.ProtoCountersWithContext(ctx, c.protocols)
+	counters, err := net.ProtoCountersWithContext(config.HostContext(ctx), c.protocols)
 	if err != nil {
 		c.logger.Warn().Err(err).Msg("collecting network protocol metrics")
 		c.setStatus(metrics, nil)
@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -80,6 +81,17 @@ func (c *common) Flush() cgm.Metrics {
 	return c.lastMetrics
 }
 
+// Snapshot returns a copy of the last metrics collected.
+func (c *common) Snapshot() cgm.Metrics {
+	c.Lock()
+	defer c.Unlock()
+	metrics := make(cgm.Metrics, len(c.lastMetrics))
+	for mn, mv := range c.lastMetrics {
+		metrics[mn] = mv
+	}
+	return metrics
+}
+
 // ID returns the id of the instance.
 func (c *common) ID() string {
 	c.Lock()
@@ -105,13 +117,10 @@ func (c *common) Logger() zerolog.Logger {
 	return c.logger
 }
 
-// cleanName is used to clean the metric name.
+// cleanName is used to clean the metric name. Most procfs metric names are
+// static, but some sources return dynamic names (e.g. ethtool driver stats).
 func (c *common) cleanName(name string) string {
-	// metric names are not dynamic for linux procfs - reintroduce cleaner if
-	// procfs sources used return dirty dynamic names.
-	//
-	// return c.metricNameRegex.ReplaceAllString(name, c.metricNameChar)
-	return name
+	return metricNameRegex.ReplaceAllString(name, metricNameChar)
 }
 
 // addMetric to internal buffer if metric is active.
@@ -190,3 +199,13 @@ func (c *common) readFile(file string) ([]string, error) {
 
 	return lines, f.Close() //nolint:wrapcheck
 }
+
+// readSysAttr reads a single value (e.g. sysfs attribute) file.
+func readSysAttr(fn string) (string, bool) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return "", false
+	}
+	v := strings.TrimSpace(string(data))
+	return v, v != ""
+}
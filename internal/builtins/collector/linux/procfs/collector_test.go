@@ -125,6 +125,29 @@ func TestAddMetric(t *testing.T) {
 	}
 }
 
+func TestCleanName(t *testing.T) {
+	t.Log("Testing cleanName")
+
+	c := &common{id: "test"}
+
+	tests := []struct {
+		name   string
+		expect string
+	}{
+		{"rx_missed_errors", "rx_missed_errors"},
+		{"tx-timeout.count", "tx-timeout.count"},
+		{"rx_queue_0 drops", "rx_queue_0_drops"},
+		{"port.rx_dropped(hw)", "port.rx_dropped_hw_"},
+		{"rx|ST[foo]", "rx_ST_foo_"},
+	}
+
+	for _, tst := range tests {
+		if got := c.cleanName(tst.name); got != tst.expect {
+			t.Fatalf("expected (%s) got (%s)", tst.expect, got)
+		}
+	}
+}
+
 func TestSetStatus(t *testing.T) {
 	t.Log("Testing setStatus")
 
@@ -32,6 +32,10 @@ type Disk struct {
 	include         *regexp.Regexp
 	exclude         *regexp.Regexp
 	sectorSizeCache map[string]uint64
+	metaCache       map[string]*diskMeta
+	metaTags        map[string]bool // OPT device metadata added as stream tags
+	latency         *diskLatency    // block request latency tracer, nil when latency histograms are not enabled
+	sysFSPath       string          // OPT sysfs mount point path
 	common
 	sectorSizeDefault uint64
 }
@@ -44,9 +48,13 @@ type diskOptions struct {
 	RunTTL     string `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
 
 	// collector specific
-	IncludeRegex      string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
-	ExcludeRegex      string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
-	DefaultSectorSize string `json:"default_sector_size" toml:"default_sector_size" yaml:"default_sector_size"`
+	IncludeRegex      string   `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
+	ExcludeRegex      string   `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+	DefaultSectorSize string   `json:"default_sector_size" toml:"default_sector_size" yaml:"default_sector_size"`
+	LatencyHistograms string   `json:"latency_histograms" toml:"latency_histograms" yaml:"latency_histograms"`
+	TracefsPath       string   `json:"tracefs_path" toml:"tracefs_path" yaml:"tracefs_path"`
+	SysFSPath         string   `json:"sysfs_path" toml:"sysfs_path" yaml:"sysfs_path"`
+	MetadataTags      []string `json:"metadata_tags" toml:"metadata_tags" yaml:"metadata_tags"`
 }
 
 type dstats struct {
@@ -80,9 +88,15 @@ func NewDiskCollector(cfgBaseName, procFSPath string) (collector.Collector, erro
 	}
 
 	c.sectorSizeCache = make(map[string]uint64)
+	c.metaCache = make(map[string]*diskMeta)
+	c.metaTags = make(map[string]bool)
 	c.include = defaultIncludeRegex
 	c.exclude = defaultExcludeRegex
 	c.sectorSizeDefault = 512
+	c.sysFSPath = viper.GetString(config.KeyHostSys)
+	if c.sysFSPath == "" {
+		c.sysFSPath = defaults.HostSys
+	}
 
 	if cfgBaseName == "" {
 		if _, err := os.Stat(c.file); os.IsNotExist(err) {
@@ -126,6 +140,35 @@ func NewDiskCollector(cfgBaseName, procFSPath string) (collector.Collector, erro
 		c.sectorSizeDefault = v
 	}
 
+	if opts.SysFSPath != "" {
+		c.sysFSPath = opts.SysFSPath
+	}
+
+	for _, name := range opts.MetadataTags {
+		if _, ok := diskMetaTagCategories[name]; !ok {
+			return nil, fmt.Errorf("%s invalid metadata_tags value (%s)", c.pkgID, name) //nolint:goerr113
+		}
+		c.metaTags[name] = true
+	}
+
+	if opts.LatencyHistograms != "" {
+		enabled, err := strconv.ParseBool(opts.LatencyHistograms)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing latency_histograms: %w", c.pkgID, err)
+		}
+		if enabled {
+			tracefsPath := opts.TracefsPath
+			if tracefsPath == "" {
+				tracefsPath, err = findTracefs(c.sysFSPath)
+			}
+			if err != nil {
+				c.logger.Warn().Err(err).Msg("latency histograms disabled")
+			} else {
+				c.latency = newDiskLatency(tracefsPath, c.logger)
+			}
+		}
+	}
+
 	if opts.ID != "" {
 		c.id = opts.ID
 	}
@@ -174,6 +217,7 @@ func (c *Disk) Collect(ctx context.Context) error {
 	c.Unlock()
 
 	stats := make(map[string]*dstats)
+	devNums := make(map[string]string) // major,minor -> device name
 
 	lines, err := c.readFile(c.file)
 	if err != nil {
@@ -216,6 +260,7 @@ func (c *Disk) Collect(ctx context.Context) error {
 			continue // parser logs error
 		}
 		stats[ds.id] = ds
+		devNums[fields[0]+","+fields[1]] = ds.id
 	}
 
 	unitOperationsTag := tags.Tag{Category: "units", Value: "operations"}
@@ -254,9 +299,13 @@ func (c *Disk) Collect(ctx context.Context) error {
 			}
 		}
 
+		meta := c.getMeta(devID)
 		diskTags := tags.Tags{
 			tags.Tag{Category: "device", Value: devID},
 		}
+		diskTags = append(diskTags, meta.tags(c.metaTags)...)
+
+		c.metaCollect(&metrics, meta, diskTags)
 
 		{
 			tagList := tags.Tags{unitOperationsTag}
@@ -302,20 +351,57 @@ func (c *Disk) Collect(ctx context.Context) error {
 		}
 	}
 
+	if c.latency != nil {
+		c.latencyCollect(&metrics, devNums)
+	}
+
 	c.setStatus(metrics, nil)
 	return nil
 }
 
+// startLatency starts the block request latency tracer, if latency histograms
+// are enabled, it runs until the context is done.
+func (c *Disk) startLatency(ctx context.Context) error {
+	if c.latency == nil {
+		return nil
+	}
+	if err := c.latency.start(ctx); err != nil {
+		c.latency = nil
+		return fmt.Errorf("%s starting latency tracer: %w", c.pkgID, err)
+	}
+	return nil
+}
+
+// latencyCollect adds the read/write/discard latency histograms recorded since the last collection.
+func (c *Disk) latencyCollect(metrics *cgm.Metrics, devNums map[string]string) {
+	unitSecondsTag := tags.Tag{Category: "units", Value: "seconds"}
+
+	for devNum, ops := range c.latency.flush() {
+		devID, ok := devNums[devNum]
+		if !ok {
+			continue
+		}
+		if c.exclude.MatchString(devID) || !c.include.MatchString(devID) {
+			continue
+		}
+		for op, hist := range ops {
+			tagList := tags.Tags{
+				tags.Tag{Category: "device", Value: devID},
+				tags.Tag{Category: "operation", Value: op},
+				unitSecondsTag,
+			}
+			tagList = append(tagList, c.getMeta(devID).tags(c.metaTags)...)
+			_ = c.addMetric(metrics, "", "latency", "h", hist, tagList)
+		}
+	}
+}
+
 func (c *Disk) getSectorSize(dev string) uint64 {
 	if sz, have := c.sectorSizeCache[dev]; have {
 		return sz
 	}
 
-	sysFSPath := viper.GetString(config.KeyHostSys)
-	if sysFSPath == "" {
-		sysFSPath = defaults.HostSys
-	}
-	fn := path.Join(string(os.PathSeparator), sysFSPath, "block", dev, "queue", "physical_block_size")
+	fn := path.Join(string(os.PathSeparator), c.sysFSPath, "block", dev, "queue", "physical_block_size")
 
 	c.logger.Debug().Str("fn", fn).Msg("checking for sector size")
 
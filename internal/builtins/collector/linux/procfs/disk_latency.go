@@ -0,0 +1,285 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openhistogram/circonusllhist"
+	"github.com/rs/zerolog"
+)
+
+const (
+	latencyTraceInstance = "circonus_agent_blk"
+	latencyMaxPending    = 300.0 // seconds, drop issued requests never seen completing
+	latencyReadDeadline  = time.Second
+)
+
+var (
+	errTracefsNotFound = fmt.Errorf("tracefs not found")
+
+	// block layer tracepoints enabled in the tracefs instance
+	latencyTraceEvents = []string{
+		filepath.Join("events", "block", "block_rq_issue", "enable"),
+		filepath.Join("events", "block", "block_rq_complete", "enable"),
+	}
+)
+
+// diskLatency tracks block request latency (issue to complete, i.e. device
+// time) per device and operation using the block layer tracepoints.
+type diskLatency struct {
+	hists      map[string]map[string]*circonusllhist.Histogram // device number (major,minor) -> op -> histogram
+	pending    map[string]float64                              // dev,sector -> issue timestamp
+	tracefs    string
+	instance   string
+	logger     zerolog.Logger
+	lastTS     float64
+	sync.Mutex // protects hists and pending
+}
+
+// blockEvent is the subset of a block_rq_issue/block_rq_complete trace line used.
+type blockEvent struct {
+	event  string
+	dev    string
+	op     string
+	sector string
+	ts     float64
+}
+
+func newDiskLatency(tracefsPath string, logger zerolog.Logger) *diskLatency {
+	return &diskLatency{
+		tracefs:  tracefsPath,
+		instance: filepath.Join(tracefsPath, "instances", latencyTraceInstance),
+		hists:    make(map[string]map[string]*circonusllhist.Histogram),
+		pending:  make(map[string]float64),
+		logger:   logger,
+	}
+}
+
+// findTracefs returns the tracefs mount under sysfs (tracing or debug/tracing).
+func findTracefs(sysFSPath string) (string, error) {
+	for _, p := range []string{
+		filepath.Join(sysFSPath, "kernel", "tracing"),
+		filepath.Join(sysFSPath, "kernel", "debug", "tracing"),
+	} {
+		if _, err := os.Stat(filepath.Join(p, "instances")); err == nil {
+			return p, nil
+		}
+	}
+	return "", errTracefsNotFound
+}
+
+// start creates a tracefs instance with the block tracepoints enabled and
+// consumes its trace_pipe until the context is done.
+func (dl *diskLatency) start(ctx context.Context) error {
+	_ = os.Remove(dl.instance) // cleanup stale instance from previous run
+	if err := os.Mkdir(dl.instance, 0o750); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("creating trace instance: %w", err)
+	}
+
+	for _, ev := range latencyTraceEvents {
+		if err := os.WriteFile(filepath.Join(dl.instance, ev), []byte("1\n"), 0o600); err != nil {
+			dl.stop()
+			return fmt.Errorf("enabling %s: %w", ev, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dl.instance, "tracing_on"), []byte("1\n"), 0o600); err != nil {
+		dl.stop()
+		return fmt.Errorf("enabling tracing: %w", err)
+	}
+
+	pipe, err := os.Open(filepath.Join(dl.instance, "trace_pipe"))
+	if err != nil {
+		dl.stop()
+		return fmt.Errorf("opening trace_pipe: %w", err)
+	}
+
+	go func() {
+		dl.consume(ctx, pipe)
+		pipe.Close()
+		dl.stop()
+	}()
+
+	return nil
+}
+
+// stop disables tracing and removes the tracefs instance.
+func (dl *diskLatency) stop() {
+	_ = os.WriteFile(filepath.Join(dl.instance, "tracing_on"), []byte("0\n"), 0o600)
+	if err := os.Remove(dl.instance); err != nil && !os.IsNotExist(err) {
+		dl.logger.Warn().Err(err).Str("instance", dl.instance).Msg("removing trace instance")
+	}
+}
+
+// consume reads trace lines until the context is done or a read error occurs.
+func (dl *diskLatency) consume(ctx context.Context, pipe *os.File) {
+	rdr := bufio.NewReader(pipe)
+	var partial string
+	for {
+		if done(ctx) {
+			return
+		}
+		// trace_pipe blocks while there are no events, use a deadline so
+		// the context is checked periodically (ignored if not pollable)
+		_ = pipe.SetReadDeadline(time.Now().Add(latencyReadDeadline))
+		line, err := rdr.ReadString('\n')
+		if err != nil {
+			partial += line
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			dl.logger.Warn().Err(err).Msg("reading trace_pipe")
+			return
+		}
+		line = partial + line
+		partial = ""
+		if ev, ok := parseBlockEvent(line); ok {
+			dl.handle(ev)
+		}
+	}
+}
+
+// handle an issue or complete event, recording latency on completion.
+func (dl *diskLatency) handle(ev blockEvent) {
+	dl.Lock()
+	defer dl.Unlock()
+
+	if ev.ts > dl.lastTS {
+		dl.lastTS = ev.ts
+	}
+
+	key := ev.dev + "," + ev.sector
+	switch ev.event {
+	case "block_rq_issue":
+		dl.pending[key] = ev.ts
+	case "block_rq_complete":
+		start, ok := dl.pending[key]
+		if !ok {
+			return
+		}
+		delete(dl.pending, key)
+		if ev.op == "" || ev.ts < start {
+			return
+		}
+		ops, ok := dl.hists[ev.dev]
+		if !ok {
+			ops = make(map[string]*circonusllhist.Histogram)
+			dl.hists[ev.dev] = ops
+		}
+		h, ok := ops[ev.op]
+		if !ok {
+			h = circonusllhist.New(circonusllhist.NoLocks())
+			ops[ev.op] = h
+		}
+		_ = h.RecordValue(ev.ts - start)
+	}
+}
+
+// flush returns the serialized histograms, per device number and op, recorded
+// since the last flush and resets them.
+func (dl *diskLatency) flush() map[string]map[string]string {
+	dl.Lock()
+	defer dl.Unlock()
+
+	for k, ts := range dl.pending {
+		if dl.lastTS-ts > latencyMaxPending {
+			delete(dl.pending, k)
+		}
+	}
+
+	ret := make(map[string]map[string]string)
+	for dev, ops := range dl.hists {
+		for op, h := range ops {
+			if h.Count() == 0 {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := h.SerializeB64(&buf); err != nil {
+				dl.logger.Warn().Err(err).Str("dev", dev).Str("op", op).Msg("serializing latency histogram")
+				continue
+			}
+			h.Reset()
+			if _, ok := ret[dev]; !ok {
+				ret[dev] = make(map[string]string)
+			}
+			ret[dev][op] = buf.String()
+		}
+	}
+
+	return ret
+}
+
+// parseBlockEvent parses a block_rq_issue or block_rq_complete trace line.
+//
+//	kworker/0:1H-123 [000] ..... 1234.567890: block_rq_issue: 8,0 WS 4096 () 2048 + 8 [kworker/0:1H]
+//	<idle>-0         [000] ..s1. 1234.568912: block_rq_complete: 8,0 WS () 2048 + 8 [0]
+func parseBlockEvent(line string) (blockEvent, bool) {
+	fields := strings.Fields(line)
+
+	idx := -1
+	for i, f := range fields {
+		if f == "block_rq_issue:" || f == "block_rq_complete:" {
+			idx = i
+			break
+		}
+	}
+	// need timestamp before event and dev, rwbs, sector + count after event
+	if idx < 1 || len(fields) < idx+6 {
+		return blockEvent{}, false
+	}
+
+	ts, err := strconv.ParseFloat(strings.TrimSuffix(fields[idx-1], ":"), 64)
+	if err != nil {
+		return blockEvent{}, false
+	}
+
+	ev := blockEvent{
+		event: strings.TrimSuffix(fields[idx], ":"),
+		dev:   fields[idx+1],
+		op:    rwbsOp(fields[idx+2]),
+		ts:    ts,
+	}
+
+	// the command "(...)" may contain spaces, locate sector by the "+ count" which follows it
+	for i := idx + 3; i < len(fields)-1; i++ {
+		if fields[i] == "+" {
+			ev.sector = fields[i-1]
+			break
+		}
+	}
+	if ev.sector == "" {
+		return blockEvent{}, false
+	}
+
+	return ev, true
+}
+
+// rwbsOp returns the operation from the rwbs field of a block trace event.
+func rwbsOp(rwbs string) string {
+	switch {
+	case strings.Contains(rwbs, "D"):
+		return "discard"
+	case strings.Contains(rwbs, "W"):
+		return "write"
+	case strings.Contains(rwbs, "R"):
+		return "read"
+	default:
+		return "" // flush only, none, etc.
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestParseBlockEvent(t *testing.T) {
+	t.Log("Testing parseBlockEvent")
+
+	tests := []struct {
+		name   string
+		line   string
+		event  string
+		dev    string
+		op     string
+		sector string
+		ts     float64
+		ok     bool
+	}{
+		{"issue", "kworker/0:1H-123 [000] ..... 1234.567890: block_rq_issue: 8,0 WS 4096 () 2048 + 8 [kworker/0:1H]", "block_rq_issue", "8,0", "write", "2048", 1234.567890, true},
+		{"complete", "<idle>-0 [000] ..s1. 1234.568912: block_rq_complete: 8,0 WS () 2048 + 8 [0]", "block_rq_complete", "8,0", "write", "2048", 1234.568912, true},
+		{"read ahead", "dd-4242 [001] d..1. 10.000001: block_rq_issue: 259,0 RA 131072 () 8192 + 256 [dd]", "block_rq_issue", "259,0", "read", "8192", 10.000001, true},
+		{"discard", "fstrim-77 [002] ..... 20.5: block_rq_issue: 259,0 DS 1048576 () 0 + 2048 [fstrim]", "block_rq_issue", "259,0", "discard", "0", 20.5, true},
+		{"scsi command", "sg-1 [000] ..... 5.25: block_rq_issue: 8,16 R 512 (28 00 00 00 00 00 00 00 01 00) 0 + 1 [sg]", "block_rq_issue", "8,16", "read", "0", 5.25, true},
+		{"flush", "kworker-1 [000] ..... 5.5: block_rq_issue: 8,0 FF 0 () 0 + 0 [kworker]", "block_rq_issue", "8,0", "", "0", 5.5, true},
+		{"other event", "kworker-1 [000] ..... 5.5: block_rq_insert: 8,0 WS 4096 () 2048 + 8 [kworker]", "", "", "", "", 0, false},
+		{"truncated", "kworker-1 [000] ..... 5.5: block_rq_issue: 8,0 WS", "", "", "", "", 0, false},
+		{"bad timestamp", "kworker-1 [000] ..... abc: block_rq_issue: 8,0 WS 4096 () 2048 + 8 [kworker]", "", "", "", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ev, ok := parseBlockEvent(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("expected ok %v, got %v", tt.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			if ev.event != tt.event || ev.dev != tt.dev || ev.op != tt.op || ev.sector != tt.sector || ev.ts != tt.ts {
+				t.Fatalf("unexpected event %+v", ev)
+			}
+		})
+	}
+}
+
+func TestDiskLatencyFlush(t *testing.T) {
+	t.Log("Testing diskLatency flush")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dl := newDiskLatency("testdata", zerolog.Nop())
+
+	t.Log("complete without issue")
+	{
+		dl.handle(blockEvent{event: "block_rq_complete", dev: "8,0", op: "read", sector: "1", ts: 1.0})
+		if h := dl.flush(); len(h) != 0 {
+			t.Fatalf("expected no histograms, got %v", h)
+		}
+	}
+
+	t.Log("issue and complete")
+	{
+		dl.handle(blockEvent{event: "block_rq_issue", dev: "8,0", op: "read", sector: "1", ts: 2.0})
+		dl.handle(blockEvent{event: "block_rq_issue", dev: "8,0", op: "discard", sector: "9", ts: 2.0})
+		dl.handle(blockEvent{event: "block_rq_complete", dev: "8,0", op: "read", sector: "1", ts: 2.001})
+		dl.handle(blockEvent{event: "block_rq_complete", dev: "8,0", op: "discard", sector: "9", ts: 2.5})
+
+		h := dl.flush()
+		if len(h["8,0"]) != 2 {
+			t.Fatalf("expected 2 histograms, got %v", h)
+		}
+		if h["8,0"]["read"] == "" || h["8,0"]["discard"] == "" {
+			t.Fatalf("expected read and discard histograms, got %v", h)
+		}
+		if len(dl.pending) != 0 {
+			t.Fatalf("expected no pending, got %v", dl.pending)
+		}
+	}
+
+	t.Log("reset after flush")
+	{
+		if h := dl.flush(); len(h) != 0 {
+			t.Fatalf("expected no histograms, got %v", h)
+		}
+	}
+
+	t.Log("stale pending dropped")
+	{
+		dl.handle(blockEvent{event: "block_rq_issue", dev: "8,0", op: "write", sector: "5", ts: 3.0})
+		dl.handle(blockEvent{event: "block_rq_issue", dev: "8,0", op: "write", sector: "6", ts: 3.0 + latencyMaxPending + 1})
+		_ = dl.flush()
+		if len(dl.pending) != 1 {
+			t.Fatalf("expected 1 pending, got %v", dl.pending)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+)
+
+const diskMetaTTL = 5 * time.Minute // how long device metadata is cached (e.g. scheduler can be changed at runtime)
+
+// diskMetaTagCategories maps the metadata_tags option values to tag categories.
+var diskMetaTagCategories = map[string]string{
+	"class":     "device-class",
+	"scheduler": "device-scheduler",
+	"model":     "device-model",
+	"parent":    "device-parent",
+}
+
+// diskMeta is block device metadata from sysfs (/sys/class/block/<dev>).
+type diskMeta struct {
+	updated    time.Time
+	parent     string // disk a partition belongs to
+	class      string // ssd or hdd (from queue/rotational)
+	scheduler  string // active io scheduler
+	model      string
+	serial     string
+	wwn        string
+	nrRequests uint64
+	rotational uint32
+	haveQueue  bool
+}
+
+// tags returns the metadata stream tags enabled in the metadata_tags option.
+func (m *diskMeta) tags(enabled map[string]bool) tags.Tags {
+	tagList := tags.Tags{}
+	for name, val := range map[string]string{
+		"class":     m.class,
+		"scheduler": m.scheduler,
+		"model":     m.model,
+		"parent":    m.parent,
+	} {
+		if val != "" && enabled[name] {
+			tagList = append(tagList, tags.Tag{Category: diskMetaTagCategories[name], Value: val})
+		}
+	}
+	return tagList
+}
+
+// getMeta returns (cached) metadata for a block device.
+func (c *Disk) getMeta(dev string) *diskMeta {
+	if m, have := c.metaCache[dev]; have && time.Since(m.updated) < diskMetaTTL {
+		return m
+	}
+
+	m := &diskMeta{updated: time.Now()}
+	c.metaCache[dev] = m
+
+	devDir := filepath.Join(c.sysFSPath, "class", "block", dev)
+	if _, err := os.Stat(devDir); err != nil {
+		c.logger.Debug().Err(err).Str("device", dev).Msg("device metadata not available")
+		return m
+	}
+
+	// partitions get queue and device attributes from the parent disk
+	// /sys/class/block/sda1 -> ../../devices/.../block/sda/sda1
+	diskDir := devDir
+	if _, err := os.Stat(filepath.Join(devDir, "partition")); err == nil {
+		if real, err := filepath.EvalSymlinks(devDir); err == nil {
+			m.parent = filepath.Base(filepath.Dir(real))
+			diskDir = filepath.Join(c.sysFSPath, "class", "block", m.parent)
+		}
+	}
+
+	if v, ok := readSysAttr(filepath.Join(diskDir, "queue", "rotational")); ok {
+		m.haveQueue = true
+		if v == "1" {
+			m.rotational = 1
+			m.class = "hdd"
+		} else {
+			m.class = "ssd"
+		}
+	}
+
+	// mq-deadline kyber [none]
+	if v, ok := readSysAttr(filepath.Join(diskDir, "queue", "scheduler")); ok {
+		for _, s := range strings.Fields(v) {
+			if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+				m.scheduler = strings.Trim(s, "[]")
+				break
+			}
+		}
+	}
+
+	if v, ok := readSysAttr(filepath.Join(diskDir, "queue", "nr_requests")); ok {
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			m.nrRequests = n
+		}
+	}
+
+	if v, ok := readSysAttr(filepath.Join(diskDir, "device", "model")); ok {
+		m.model = v
+	}
+
+	if v, ok := readSysAttr(filepath.Join(diskDir, "device", "serial")); ok {
+		m.serial = v
+	}
+
+	// scsi/sata have device/wwid, nvme namespaces have wwid
+	for _, fn := range []string{filepath.Join(diskDir, "device", "wwid"), filepath.Join(diskDir, "wwid")} {
+		if v, ok := readSysAttr(fn); ok {
+			m.wwn = v
+			break
+		}
+	}
+
+	return m
+}
+
+// metaCollect adds the device metadata metrics.
+func (c *Disk) metaCollect(metrics *cgm.Metrics, m *diskMeta, diskTags tags.Tags) {
+	if m.haveQueue {
+		_ = c.addMetric(metrics, "", "rotational", "I", m.rotational, diskTags)
+		tagList := tags.Tags{tags.Tag{Category: "units", Value: "requests"}}
+		tagList = append(tagList, diskTags...)
+		_ = c.addMetric(metrics, "", "nr_requests", "L", m.nrRequests, tagList)
+	}
+
+	for name, val := range map[string]string{
+		"parent":    m.parent,
+		"scheduler": m.scheduler,
+		"model":     m.model,
+		"serial":    m.serial,
+		"wwn":       m.wwn,
+	} {
+		if val != "" {
+			_ = c.addMetric(metrics, "", name, "s", val, diskTags)
+		}
+	}
+}
@@ -18,6 +18,8 @@ import (
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
 	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/circonus-labs/circonus-agent/internal/release"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
 	"github.com/rs/zerolog"
 )
 
@@ -165,6 +167,52 @@ func TestNewDiskCollector(t *testing.T) {
 			t.Fatal("expected error")
 		}
 	}
+
+	t.Log("config (metadata tags)")
+	{
+		c, err := NewDiskCollector(filepath.Join("testdata", "config_disk_metadata_tags_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !c.(*Disk).metaTags["class"] || !c.(*Disk).metaTags["parent"] || c.(*Disk).metaTags["model"] {
+			t.Fatalf("expected class and parent, got (%v)", c.(*Disk).metaTags)
+		}
+		expect := filepath.Join("testdata", "sys")
+		if c.(*Disk).sysFSPath != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*Disk).sysFSPath)
+		}
+	}
+
+	t.Log("config (metadata tags invalid)")
+	{
+		_, err := NewDiskCollector(filepath.Join("testdata", "config_disk_metadata_tags_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (latency histograms)")
+	{
+		c, err := NewDiskCollector(filepath.Join("testdata", "config_latency_histograms_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Disk).latency == nil {
+			t.Fatal("expected latency tracer")
+		}
+		expect := filepath.Join("testdata", "tracing")
+		if c.(*Disk).latency.tracefs != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*Disk).latency.tracefs)
+		}
+	}
+
+	t.Log("config (latency histograms invalid)")
+	{
+		_, err := NewDiskCollector(filepath.Join("testdata", "config_latency_histograms_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
 }
 
 func TestDiskFlush(t *testing.T) {
@@ -247,4 +295,90 @@ func TestDiskCollect(t *testing.T) {
 			t.Fatalf("expected metrics, got %v", metrics)
 		}
 	}
+
+	t.Log("good (metadata)")
+	{
+		c, err := NewDiskCollector(filepath.Join("testdata", "config_disk_metadata_tags_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		baseTags := tags.Tags{
+			tags.Tag{Category: "source", Value: release.NAME},
+			tags.Tag{Category: "collector", Value: NameDisk},
+		}
+		metrics := c.Flush()
+
+		tagList := append(baseTags, tags.Tags{ //nolint:gocritic
+			tags.Tag{Category: "device", Value: "sda"},
+			tags.Tag{Category: "device-class", Value: "hdd"},
+		}...)
+		m, ok := metrics[tags.MetricNameWithStreamTags("rotational", tagList)]
+		if !ok {
+			t.Fatal("expected rotational metric for sda")
+		}
+		if m.Value.(uint32) != 1 {
+			t.Fatalf("expected 1, got %v", m.Value)
+		}
+		m, ok = metrics[tags.MetricNameWithStreamTags("scheduler", tagList)]
+		if !ok {
+			t.Fatal("expected scheduler metric for sda")
+		}
+		if m.Value.(string) != "bfq" {
+			t.Fatalf("expected bfq, got %v", m.Value)
+		}
+
+		tagList = append(baseTags, tags.Tags{ //nolint:gocritic
+			tags.Tag{Category: "device", Value: "sda1"},
+			tags.Tag{Category: "device-class", Value: "hdd"},
+			tags.Tag{Category: "device-parent", Value: "sda"},
+		}...)
+		m, ok = metrics[tags.MetricNameWithStreamTags("parent", tagList)]
+		if !ok {
+			t.Fatal("expected parent metric for sda1")
+		}
+		if m.Value.(string) != "sda" {
+			t.Fatalf("expected sda, got %v", m.Value)
+		}
+
+		tagList = append(baseTags, tags.Tags{ //nolint:gocritic
+			tags.Tag{Category: "device", Value: "dm-0"},
+			tags.Tag{Category: "device-class", Value: "ssd"},
+		}...)
+		if _, ok := metrics[tags.MetricNameWithStreamTags("nr_requests", append(tagList, tags.Tag{Category: "units", Value: "requests"}))]; !ok {
+			t.Fatal("expected nr_requests metric for dm-0")
+		}
+	}
+
+	t.Log("good (latency histograms)")
+	{
+		c, err := NewDiskCollector(filepath.Join("testdata", "config_latency_histograms_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		dl := c.(*Disk).latency
+		dl.handle(blockEvent{event: "block_rq_issue", dev: "8,0", op: "read", sector: "2048", ts: 100.0})
+		dl.handle(blockEvent{event: "block_rq_complete", dev: "8,0", op: "read", sector: "2048", ts: 100.002})
+		dl.handle(blockEvent{event: "block_rq_issue", dev: "8,0", op: "write", sector: "4096", ts: 100.1})
+		dl.handle(blockEvent{event: "block_rq_complete", dev: "8,0", op: "write", sector: "4096", ts: 100.105})
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		hists := 0
+		for _, m := range c.Flush() {
+			if m.Type == "h" {
+				hists++
+			}
+		}
+		if hists != 2 {
+			t.Fatalf("expected 2 histograms, got %d", hists)
+		}
+	}
 }
@@ -0,0 +1,449 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"golang.org/x/sys/unix"
+)
+
+// FS metrics from the Linux ProcFS (1/mountinfo and statfs).
+type FS struct {
+	includeFS       *regexp.Regexp
+	excludeFS       *regexp.Regexp
+	excludeFSType   map[string]bool
+	optionTags      map[string]bool
+	pending         map[string]bool                            // mount points with a statfs call still outstanding (e.g. hung nfs)
+	statfs          func(path string, st *unix.Statfs_t) error // statfs implementation (overridden in tests)
+	filesystemsFile string
+	rootPath        string // OPT prefix used to reach host mount points (e.g. <host_proc>/1/root in a container)
+	common
+	statfsTimeout time.Duration // OPT timeout for each statfs call
+	allFSDevices  bool          // OPT include pseudo (nodev) filesystems
+}
+
+// fsOptions defines what elements can be overridden in a config file.
+type fsOptions struct {
+	// common
+	ID         string `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath string `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	RunTTL     string `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+
+	// collector specific
+	IncludeRegexFS    string   `json:"include_fs_regex" toml:"include_fs_regex" yaml:"include_fs_regex"`
+	ExcludeRegexFS    string   `json:"exclude_fs_regex" toml:"exclude_fs_regex" yaml:"exclude_fs_regex"`
+	IncludeAllDevices string   `json:"include_all_devices" toml:"include_all_devices" yaml:"include_all_devices"`
+	StatfsTimeout     string   `json:"statfs_timeout" toml:"statfs_timeout" yaml:"statfs_timeout"`
+	RootPath          string   `json:"root_path" toml:"root_path" yaml:"root_path"`
+	ExcludeFSType     []string `json:"exclude_fs_type" toml:"exclude_fs_type" yaml:"exclude_fs_type"`
+	MountOptionTags   []string `json:"mount_option_tags" toml:"mount_option_tags" yaml:"mount_option_tags"`
+}
+
+// mountInfo is the subset of a 1/mountinfo entry used by the collector.
+type mountInfo struct {
+	device     string
+	fsType     string
+	mountPoint string
+	options    map[string]bool // per mount and super block options combined
+}
+
+type statfsResult struct {
+	err error
+	st  unix.Statfs_t
+}
+
+// NewFSCollector creates new procfs fs collector.
+func NewFSCollector(cfgBaseName, procFSPath string) (collector.Collector, error) {
+	procFile := filepath.Join("1", "mountinfo")
+	filesystemsFile := "filesystems"
+
+	c := FS{
+		common: newCommon(NameFS, procFSPath, procFile, tags.FromList(tags.GetBaseTags())),
+	}
+
+	c.includeFS = defaultIncludeRegex
+	c.excludeFS = defaultExcludeRegex
+	c.excludeFSType = make(map[string]bool)
+	c.optionTags = make(map[string]bool)
+	c.pending = make(map[string]bool)
+	c.statfs = unix.Statfs
+	c.filesystemsFile = filepath.Join(c.procFSPath, filesystemsFile)
+	c.statfsTimeout = 5 * time.Second
+	c.allFSDevices = false
+	c.rootPath = config.ProcRootPath(c.procFSPath)
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s procfile: %w", c.pkgID, err)
+		}
+		return &c, nil
+	}
+
+	var opts fsOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if !strings.Contains(err.Error(), "no config found matching") {
+			c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+			return nil, fmt.Errorf("%s config: %w", c.pkgID, err)
+		}
+	} else {
+		c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+	}
+
+	if opts.IncludeRegexFS != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.IncludeRegexFS))
+		if err != nil {
+			return nil, fmt.Errorf("%s compile include FS rx: %w", c.pkgID, err)
+		}
+		c.includeFS = rx
+	}
+
+	if opts.ExcludeRegexFS != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.ExcludeRegexFS))
+		if err != nil {
+			return nil, fmt.Errorf("%s compile exclude FS rx: %w", c.pkgID, err)
+		}
+		c.excludeFS = rx
+	}
+
+	for _, fstype := range opts.ExcludeFSType {
+		c.excludeFSType[fstype] = true
+	}
+
+	for _, opt := range opts.MountOptionTags {
+		c.optionTags[opt] = true
+	}
+
+	if opts.IncludeAllDevices != "" {
+		all, err := strconv.ParseBool(opts.IncludeAllDevices)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing include_all_devices: %w", c.pkgID, err)
+		}
+		c.allFSDevices = all
+	}
+
+	if opts.StatfsTimeout != "" {
+		dur, err := time.ParseDuration(opts.StatfsTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing statfs_timeout: %w", c.pkgID, err)
+		}
+		c.statfsTimeout = dur
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+		c.filesystemsFile = filepath.Join(c.procFSPath, filesystemsFile)
+		c.rootPath = config.ProcRootPath(c.procFSPath)
+	}
+
+	if opts.RootPath != "" {
+		c.rootPath = opts.RootPath
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing run_ttl: %w", c.pkgID, err)
+		}
+		c.runTTL = dur
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s procfile: %w", c.pkgID, err)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource.
+func (c *FS) Collect(ctx context.Context) error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	mounts, err := c.parseMountInfo(ctx)
+	if err != nil {
+		c.setStatus(metrics, err)
+		return fmt.Errorf("%s parse mountinfo: %w", c.pkgID, err)
+	}
+
+	for _, m := range mounts {
+		if done(ctx) {
+			err := fmt.Errorf("context: %w", ctx.Err())
+			c.setStatus(metrics, err)
+			return err
+		}
+
+		l := c.logger.With().
+			Str("fs-device", m.device).
+			Str("fs-type", m.fsType).
+			Str("fs-mount", m.mountPoint).Logger()
+
+		st, err := c.statfsWithTimeout(ctx, m.mountPoint)
+		if err != nil {
+			l.Warn().Err(err).Msg("statfs")
+			continue
+		}
+
+		c.addFSMetrics(&metrics, m, st)
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// parseMountInfo returns the list of mounts, after applying filters, from 1/mountinfo.
+func (c *FS) parseMountInfo(ctx context.Context) ([]mountInfo, error) {
+	lines, err := c.readFile(c.file)
+	if err != nil {
+		return nil, fmt.Errorf("%s read file: %w", c.pkgID, err)
+	}
+
+	var physicalFS map[string]bool
+	if !c.allFSDevices {
+		physicalFS = c.physicalFSTypes()
+	}
+
+	// https://www.kernel.org/doc/Documentation/filesystems/proc.txt (3.5 /proc/<pid>/mountinfo)
+	// 36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+	//  0 mount id
+	//  1 parent id
+	//  2 major:minor
+	//  3 root
+	//  4 mount point
+	//  5 mount options
+	//  6 optional fields (zero or more), terminated by "-"
+	//  n+1 filesystem type
+	//  n+2 mount source (device)
+	//  n+3 super options
+	mounts := make([]mountInfo, 0, len(lines))
+	for _, line := range lines {
+		if done(ctx) {
+			return nil, fmt.Errorf("context: %w", ctx.Err())
+		}
+
+		fields := strings.Fields(line)
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep == -1 || len(fields) < sep+4 {
+			c.logger.Warn().Str("line", line).Msg("invalid mountinfo entry")
+			continue
+		}
+
+		m := mountInfo{
+			mountPoint: unescapeMountField(fields[4]),
+			fsType:     fields[sep+1],
+			device:     unescapeMountField(fields[sep+2]),
+			options:    make(map[string]bool),
+		}
+		for _, o := range strings.Split(fields[5]+","+fields[sep+3], ",") {
+			m.options[o] = true
+		}
+
+		if c.excludeFS.MatchString(m.mountPoint) || !c.includeFS.MatchString(m.mountPoint) {
+			c.logger.Debug().Str("fs-mount", m.mountPoint).Msg("excluded FS, ignoring")
+			continue
+		}
+		if c.excludeFSType[m.fsType] {
+			c.logger.Debug().Str("fs-mount", m.mountPoint).Str("fs-type", m.fsType).Msg("excluded FS type, ignoring")
+			continue
+		}
+		if physicalFS != nil && !physicalFS[m.fsType] {
+			c.logger.Debug().Str("fs-mount", m.mountPoint).Str("fs-type", m.fsType).Msg("pseudo FS type, ignoring")
+			continue
+		}
+
+		mounts = append(mounts, m)
+	}
+
+	return mounts, nil
+}
+
+// physicalFSTypes returns filesystem types from filesystems which are not flagged "nodev".
+// Returns nil (no filtering) if the file cannot be read.
+func (c *FS) physicalFSTypes() map[string]bool {
+	lines, err := c.readFile(c.filesystemsFile)
+	if err != nil {
+		c.logger.Warn().Err(err).Msg("reading filesystems, not filtering pseudo filesystems")
+		return nil
+	}
+
+	fsTypes := make(map[string]bool)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 1 {
+			fsTypes[fields[0]] = true
+		}
+	}
+	// zfs is flagged nodev but is backed by physical devices
+	fsTypes["zfs"] = true
+
+	return fsTypes
+}
+
+// statfsWithTimeout calls statfs in a goroutine so that a hung mount (e.g. unreachable
+// nfs server) cannot block collection. A mount point is not retried until the
+// outstanding call returns, bounding the number of goroutines to one per hung mount.
+func (c *FS) statfsWithTimeout(ctx context.Context, mountPoint string) (unix.Statfs_t, error) {
+	c.Lock()
+	if c.pending[mountPoint] {
+		c.Unlock()
+		return unix.Statfs_t{}, fmt.Errorf("previous statfs still outstanding") //nolint:goerr113
+	}
+	c.pending[mountPoint] = true
+	c.Unlock()
+
+	path := filepath.Join(c.rootPath, mountPoint)
+	result := make(chan statfsResult, 1)
+
+	go func() {
+		var r statfsResult
+		r.err = c.statfs(path, &r.st)
+		c.Lock()
+		delete(c.pending, mountPoint)
+		c.Unlock()
+		result <- r
+	}()
+
+	timer := time.NewTimer(c.statfsTimeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-result:
+		if r.err != nil {
+			return unix.Statfs_t{}, fmt.Errorf("statfs %s: %w", path, r.err)
+		}
+		return r.st, nil
+	case <-timer.C:
+		return unix.Statfs_t{}, fmt.Errorf("statfs %s: timeout after %s", path, c.statfsTimeout) //nolint:goerr113
+	case <-ctx.Done():
+		return unix.Statfs_t{}, fmt.Errorf("context: %w", ctx.Err())
+	}
+}
+
+// addFSMetrics adds the usage metrics for a single mount.
+func (c *FS) addFSMetrics(metrics *cgm.Metrics, m mountInfo, st unix.Statfs_t) {
+	bsize := uint64(st.Frsize)
+	if bsize == 0 {
+		bsize = uint64(st.Bsize)
+	}
+
+	total := st.Blocks * bsize
+	free := st.Bavail * bsize
+	used := (st.Blocks - st.Bfree) * bsize
+	inodesTotal := st.Files
+	inodesFree := st.Ffree
+	inodesUsed := inodesTotal - inodesFree
+
+	mode := "rw"
+	readOnly := 0
+	if m.options["ro"] {
+		mode = "ro"
+		readOnly = 1
+	}
+
+	fsTags := tags.Tags{
+		tags.Tag{Category: "fs-device", Value: m.device},
+		tags.Tag{Category: "fs-type", Value: m.fsType},
+		tags.Tag{Category: "fs-mountpoint", Value: m.mountPoint},
+		tags.Tag{Category: "fs-mode", Value: mode},
+	}
+	for opt := range c.optionTags {
+		if m.options[opt] {
+			fsTags = append(fsTags, tags.Tag{Category: "mount-option", Value: opt})
+		}
+	}
+
+	{ // units:bytes
+		tagList := tags.Tags{tags.Tag{Category: "units", Value: "bytes"}}
+		tagList = append(tagList, fsTags...)
+		_ = c.addMetric(metrics, "", "total", "L", total, tagList)
+		_ = c.addMetric(metrics, "", "free", "L", free, tagList)
+		_ = c.addMetric(metrics, "", "used", "L", used, tagList)
+	}
+
+	{ // units:percent
+		tagList := tags.Tags{tags.Tag{Category: "units", Value: "percent"}}
+		tagList = append(tagList, fsTags...)
+		if used+free > 0 {
+			_ = c.addMetric(metrics, "", "used", "n", float64(used)/float64(used+free)*100, tagList)
+		}
+		if inodesTotal > 0 {
+			_ = c.addMetric(metrics, "", "inodes_used", "n", float64(inodesUsed)/float64(inodesTotal)*100, tagList)
+		}
+	}
+
+	{ // units:inodes
+		tagList := tags.Tags{tags.Tag{Category: "units", Value: "inodes"}}
+		tagList = append(tagList, fsTags...)
+		_ = c.addMetric(metrics, "", "inodes_total", "L", inodesTotal, tagList)
+		_ = c.addMetric(metrics, "", "inodes_used", "L", inodesUsed, tagList)
+		_ = c.addMetric(metrics, "", "inodes_free", "L", inodesFree, tagList)
+	}
+
+	_ = c.addMetric(metrics, "", "read_only", "I", readOnly, fsTags)
+}
+
+// unescapeMountField decodes the octal escapes (e.g. \040 for space) used in mountinfo.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
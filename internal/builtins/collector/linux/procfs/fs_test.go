@@ -0,0 +1,251 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+)
+
+func TestNewFSCollector(t *testing.T) {
+	t.Log("Testing NewFSCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("no config")
+	{
+		c, err := NewFSCollector("", defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*FS).rootPath != "" {
+			t.Fatalf("expected empty root path, got (%s)", c.(*FS).rootPath)
+		}
+	}
+
+	t.Log("config (missing)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "missing"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "bad_syntax"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "1", "root")
+		if c.(*FS).rootPath != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*FS).rootPath)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (settings)")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		fc := c.(*FS)
+		if fc.rootPath != "/" {
+			t.Fatalf("expected root path /, got (%s)", fc.rootPath)
+		}
+		if fc.statfsTimeout != 100*time.Millisecond {
+			t.Fatalf("expected 100ms, got (%s)", fc.statfsTimeout)
+		}
+		if !fc.optionTags["nosuid"] {
+			t.Fatal("expected nosuid option tag")
+		}
+	}
+
+	t.Log("config (statfs timeout invalid)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "config_statfs_timeout_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestFSParseMountInfo(t *testing.T) {
+	t.Log("Testing parseMountInfo")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("physical filesystems only")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		mounts, err := c.(*FS).parseMountInfo(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(mounts) != 2 {
+			t.Fatalf("expected 2 mounts, got %d (%#v)", len(mounts), mounts)
+		}
+		if mounts[1].mountPoint != "/boot" || !mounts[1].options["ro"] {
+			t.Fatalf("expected read-only /boot, got %#v", mounts[1])
+		}
+	}
+
+	t.Log("all devices, excluded types")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_all_devices_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		mounts, err := c.(*FS).parseMountInfo(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(mounts) != 3 {
+			t.Fatalf("expected 3 mounts, got %d (%#v)", len(mounts), mounts)
+		}
+		expect := "/mnt/backup data"
+		if mounts[2].mountPoint != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, mounts[2].mountPoint)
+		}
+	}
+}
+
+func TestFSCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*FS).running = true
+
+		if err := c.Collect(context.Background()); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		c.(*FS).statfs = func(path string, st *unix.Statfs_t) error {
+			st.Bsize = 4096
+			st.Blocks = 1000
+			st.Bfree = 400
+			st.Bavail = 300
+			st.Files = 100
+			st.Ffree = 25
+			return nil
+		}
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		// 2 mounts * (3 bytes, 2 percent, 3 inodes, 1 read_only)
+		metrics := c.Flush()
+		if len(metrics) != 18 {
+			t.Fatalf("expected 18 metrics, got %d", len(metrics))
+		}
+	}
+
+	t.Log("cancelled")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		c.(*FS).statfs = func(path string, st *unix.Statfs_t) error {
+			cancel()
+			return nil
+		}
+
+		if err := c.Collect(ctx); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected (%s) got (%v)", context.Canceled, err)
+		}
+		if c.(*FS).running {
+			t.Fatal("expected not running")
+		}
+	}
+
+	t.Log("hung statfs")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		release := make(chan struct{})
+		var calls int32
+		c.(*FS).statfs = func(path string, st *unix.Statfs_t) error {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return nil
+		}
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(c.Flush()) != 0 {
+			t.Fatal("expected no metrics")
+		}
+
+		// outstanding calls are not retried
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		close(release)
+		time.Sleep(10 * time.Millisecond)
+		c.(*FS).Lock()
+		pending := len(c.(*FS).pending)
+		c.(*FS).Unlock()
+		if atomic.LoadInt32(&calls) != 2 || pending != 0 {
+			t.Fatalf("expected 2 calls and 0 pending, got %d calls %d pending", calls, pending)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+)
+
+// Interrupts metrics from the Linux ProcFS (interrupts, softirqs and net/softnet_stat).
+type Interrupts struct {
+	include       *regexp.Regexp
+	exclude       *regexp.Regexp
+	softirqsFile  string
+	softnetFile   string
+	common             // common attributes
+	aggregateCPUs bool // OPT aggregate counters across cpus (vs per cpu) may be overridden in config file
+}
+
+// interruptsOptions defines what elements can be overridden in a config file.
+type interruptsOptions struct {
+	// common
+	ID         string `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath string `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	RunTTL     string `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+
+	// collector specific
+	IncludeRegex  string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
+	ExcludeRegex  string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+	AggregateCPUs string `json:"aggregate_cpus" toml:"aggregate_cpus" yaml:"aggregate_cpus"`
+}
+
+// NewInterruptsCollector creates new procfs interrupts collector.
+func NewInterruptsCollector(cfgBaseName, procFSPath string) (collector.Collector, error) {
+	procFile := "interrupts"
+	softirqsFile := "softirqs"
+	softnetFile := filepath.Join("net", "softnet_stat")
+
+	c := Interrupts{
+		common: newCommon(NameInterrupts, procFSPath, procFile, tags.FromList(tags.GetBaseTags())),
+	}
+
+	c.include = defaultIncludeRegex
+	c.exclude = defaultExcludeRegex
+	c.aggregateCPUs = false
+	c.softirqsFile = filepath.Join(c.procFSPath, softirqsFile)
+	c.softnetFile = filepath.Join(c.procFSPath, softnetFile)
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s procfile: %w", c.pkgID, err)
+		}
+		return &c, nil
+	}
+
+	var opts interruptsOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if !strings.Contains(err.Error(), "no config found matching") {
+			c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+			return nil, fmt.Errorf("%s config: %w", c.pkgID, err)
+		}
+	} else {
+		c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+	}
+
+	if opts.IncludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.IncludeRegex))
+		if err != nil {
+			return nil, fmt.Errorf("%s compile include rx: %w", c.pkgID, err)
+		}
+		c.include = rx
+	}
+
+	if opts.ExcludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.ExcludeRegex))
+		if err != nil {
+			return nil, fmt.Errorf("%s compile exclude rx: %w", c.pkgID, err)
+		}
+		c.exclude = rx
+	}
+
+	if opts.AggregateCPUs != "" {
+		agg, err := strconv.ParseBool(opts.AggregateCPUs)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing aggregate_cpus: %w", c.pkgID, err)
+		}
+		c.aggregateCPUs = agg
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+		c.softirqsFile = filepath.Join(c.procFSPath, softirqsFile)
+		c.softnetFile = filepath.Join(c.procFSPath, softnetFile)
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing run_ttl: %w", c.pkgID, err)
+		}
+		c.runTTL = dur
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s procfile: %w", c.pkgID, err)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource.
+func (c *Interrupts) Collect(ctx context.Context) error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	if err := c.interruptsCollect(ctx, &metrics); err != nil {
+		c.setStatus(metrics, err)
+		return fmt.Errorf("%s interruptsCollect: %w", c.pkgID, err)
+	}
+
+	// softirqs and softnet_stat are not available on all kernels/containers,
+	// log and continue with what is available
+	if err := c.softirqsCollect(ctx, &metrics); err != nil {
+		c.logger.Warn().Err(err).Msg("softirqs")
+	}
+
+	if err := c.softnetCollect(ctx, &metrics); err != nil {
+		c.logger.Warn().Err(err).Msg("softnet_stat")
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// interruptsCollect gets metrics from /proc/interrupts.
+func (c *Interrupts) interruptsCollect(ctx context.Context, metrics *cgm.Metrics) error {
+	lines, err := c.readFile(c.file)
+	if err != nil {
+		return fmt.Errorf("%s read file: %w", c.pkgID, err)
+	}
+	if len(lines) < 2 {
+		return nil
+	}
+
+	// header line lists online cpus e.g. "CPU0 CPU1 CPU3"
+	cpus := c.parseCPUHeader(lines[0])
+	tagUnitsInterrupts := tags.Tag{Category: "units", Value: "interrupts"}
+	metricType := "L" // uint64
+
+	for _, line := range lines[1:] {
+		if done(ctx) {
+			return fmt.Errorf("context: %w", ctx.Err())
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		irq := strings.TrimSuffix(fields[0], ":")
+
+		//  0 irq (e.g. "24:" or "NMI:")
+		//  1..n per cpu counts (some lines e.g. "ERR:" and "MIS:" only have a single total)
+		// n+1.. numbered irqs: chip, hwirq-type, action (device) name(s)
+		//       named irqs: description
+		counts := make([]uint64, 0, len(cpus))
+		idx := 1
+		for ; idx < len(fields) && idx <= len(cpus); idx++ {
+			v, err := strconv.ParseUint(fields[idx], 10, 64)
+			if err != nil {
+				break
+			}
+			counts = append(counts, v)
+		}
+		if len(counts) == 0 {
+			c.logger.Debug().Str("irq", irq).Msg("no counters found, skipping")
+			continue
+		}
+
+		name := irq
+		if _, err := strconv.Atoi(irq); err == nil {
+			desc := fields[idx:]
+			switch {
+			case len(desc) > 2:
+				name = strings.Join(desc[2:], " ")
+			case len(desc) > 0:
+				name = desc[len(desc)-1]
+			}
+		}
+
+		if c.exclude.MatchString(name) || !c.include.MatchString(name) {
+			c.logger.Debug().Str("irq", irq).Str("name", name).Msg("excluded irq name, skipping")
+			continue
+		}
+
+		tagList := tags.Tags{
+			tags.Tag{Category: "irq", Value: irq},
+			tagUnitsInterrupts,
+		}
+		if name != irq {
+			tagList = append(tagList, tags.Tag{Category: "irq_name", Value: name})
+		}
+
+		if c.aggregateCPUs || len(counts) < len(cpus) {
+			var total uint64
+			for _, v := range counts {
+				total += v
+			}
+			_ = c.addMetric(metrics, "", "interrupts", metricType, total, tagList)
+			continue
+		}
+
+		for i, v := range counts {
+			cpuTags := append(tags.Tags{tags.Tag{Category: "cpu", Value: cpus[i]}}, tagList...)
+			_ = c.addMetric(metrics, "", "interrupts", metricType, v, cpuTags)
+		}
+	}
+
+	return nil
+}
+
+// softirqsCollect gets metrics from /proc/softirqs.
+func (c *Interrupts) softirqsCollect(ctx context.Context, metrics *cgm.Metrics) error {
+	lines, err := c.readFile(c.softirqsFile)
+	if err != nil {
+		return fmt.Errorf("%s read file: %w", c.pkgID, err)
+	}
+	if len(lines) < 2 {
+		return nil
+	}
+
+	cpus := c.parseCPUHeader(lines[0])
+	metricType := "L" // uint64
+
+	for _, line := range lines[1:] {
+		if done(ctx) {
+			return fmt.Errorf("context: %w", ctx.Err())
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		softirq := strings.ToLower(strings.TrimSuffix(fields[0], ":"))
+		tagList := tags.Tags{tags.Tag{Category: "softirq", Value: softirq}}
+
+		var total uint64
+		for i, f := range fields[1:] {
+			if i >= len(cpus) {
+				break
+			}
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("softirq", softirq).Str("cpu", cpus[i]).Msg("parsing field")
+				continue
+			}
+			if c.aggregateCPUs {
+				total += v
+				continue
+			}
+			cpuTags := append(tags.Tags{tags.Tag{Category: "cpu", Value: cpus[i]}}, tagList...)
+			_ = c.addMetric(metrics, "", "softirqs", metricType, v, cpuTags)
+		}
+
+		if c.aggregateCPUs {
+			_ = c.addMetric(metrics, "", "softirqs", metricType, total, tagList)
+		}
+	}
+
+	return nil
+}
+
+// softnetCollect gets metrics from /proc/net/softnet_stat.
+func (c *Interrupts) softnetCollect(ctx context.Context, metrics *cgm.Metrics) error {
+	lines, err := c.readFile(c.softnetFile)
+	if err != nil {
+		return fmt.Errorf("%s read file: %w", c.pkgID, err)
+	}
+
+	// https://github.com/torvalds/linux/blob/master/net/core/net-procfs.c#L140
+	// one line per online cpu, all values are hex
+	//  0 processed
+	//  1 dropped
+	//  2 time_squeeze
+	//  3-7 always zero
+	//  8 cpu_collision (always zero on recent kernels)
+	//  9 received_rps
+	// 10 flow_limit_count
+	// Kernel 5.10+ adds:
+	// 11 backlog_len
+	// 12 cpu index
+	stats := []struct {
+		name  string
+		desc  string
+		stags tags.Tags
+		idx   int
+	}{
+		{idx: 0, name: "softnet_processed", desc: "processed", stags: tags.Tags{tags.Tag{Category: "units", Value: "packets"}}},
+		{idx: 1, name: "softnet_dropped", desc: "dropped", stags: tags.Tags{tags.Tag{Category: "units", Value: "packets"}}},
+		{idx: 2, name: "softnet_time_squeeze", desc: "time squeeze", stags: tags.Tags{}},
+		{idx: 9, name: "softnet_received_rps", desc: "received rps", stags: tags.Tags{tags.Tag{Category: "units", Value: "interrupts"}}},
+		{idx: 10, name: "softnet_flow_limit", desc: "flow limit count", stags: tags.Tags{tags.Tag{Category: "units", Value: "packets"}}},
+	}
+
+	totals := make([]uint64, len(stats))
+	metricType := "L" // uint64
+
+	for lineNum, line := range lines {
+		if done(ctx) {
+			return fmt.Errorf("context: %w", ctx.Err())
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			c.logger.Warn().Int("line", lineNum).Int("found", len(fields)).Msg("invalid number of fields")
+			continue
+		}
+
+		cpu := strconv.Itoa(lineNum)
+		if len(fields) > 12 {
+			if v, err := strconv.ParseUint(fields[12], 16, 32); err == nil {
+				cpu = strconv.FormatUint(v, 10)
+			}
+		}
+
+		for i, s := range stats {
+			if len(fields) <= s.idx {
+				continue
+			}
+
+			v, err := strconv.ParseUint(fields[s.idx], 16, 64)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("cpu", cpu).Int("idx", s.idx).Str("desc", s.desc).Msg("parsing field")
+				continue
+			}
+
+			if c.aggregateCPUs {
+				totals[i] += v
+				continue
+			}
+
+			tagList := tags.Tags{tags.Tag{Category: "cpu", Value: cpu}}
+			tagList = append(tagList, s.stags...)
+			_ = c.addMetric(metrics, "", s.name, metricType, v, tagList)
+		}
+	}
+
+	if c.aggregateCPUs && len(lines) > 0 {
+		for i, s := range stats {
+			_ = c.addMetric(metrics, "", s.name, metricType, totals[i], s.stags)
+		}
+	}
+
+	return nil
+}
+
+// parseCPUHeader returns the list of cpu ids from the header line of interrupts/softirqs.
+func (c *Interrupts) parseCPUHeader(line string) []string {
+	fields := strings.Fields(line)
+	cpus := make([]string, 0, len(fields))
+	for _, f := range fields {
+		cpus = append(cpus, strings.TrimPrefix(f, "CPU"))
+	}
+	return cpus
+}
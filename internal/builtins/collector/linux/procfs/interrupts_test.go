@@ -0,0 +1,235 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/rs/zerolog"
+)
+
+func TestNewInterruptsCollector(t *testing.T) {
+	t.Log("Testing NewInterruptsCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("no config")
+	{
+		_, err := NewInterruptsCollector("", defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (missing)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "missing"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "bad_syntax"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_id_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Interrupts).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "net", "softnet_stat")
+		if c.(*Interrupts).softnetFile != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*Interrupts).softnetFile)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (include regex)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_include_regex_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := fmt.Sprintf(regexPat, `^foo`)
+		if c.(*Interrupts).include.String() != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*Interrupts).include.String())
+		}
+	}
+
+	t.Log("config (include regex invalid)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "config_include_regex_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (exclude regex invalid)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "config_exclude_regex_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (aggregate cpus true)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_aggregate_cpus_true_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !c.(*Interrupts).aggregateCPUs {
+			t.Fatal("expected true")
+		}
+	}
+
+	t.Log("config (aggregate cpus invalid)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "config_aggregate_cpus_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Interrupts).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+
+	t.Log("config (run ttl invalid)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "config_run_ttl_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestInterruptsCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Interrupts).running = true
+
+		if err := c.Collect(context.Background()); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("ttl not expired")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Interrupts).runTTL = 60 * time.Second
+		c.(*Interrupts).lastEnd = time.Now()
+
+		if err := c.Collect(context.Background()); err != nil {
+			if err.Error() != collector.ErrTTLNotExpired.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrTTLNotExpired, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good (per cpu)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if metrics == nil {
+			t.Fatal("expected metrics")
+		}
+		// interrupts: 9 irqs * 2 cpus + 2 totals, softirqs: 10 * 2 cpus, softnet: 5 * 2 cpus
+		expect := 50
+		if len(metrics) != expect {
+			t.Fatalf("expected %d metrics, got %d", expect, len(metrics))
+		}
+	}
+
+	t.Log("good (aggregate cpus)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_aggregate_cpus_true_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if metrics == nil {
+			t.Fatal("expected metrics")
+		}
+		// interrupts: 11, softirqs: 10, softnet: 5
+		expect := 26
+		if len(metrics) != expect {
+			t.Fatalf("expected %d metrics, got %d", expect, len(metrics))
+		}
+	}
+}
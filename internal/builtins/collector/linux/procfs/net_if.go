@@ -20,15 +20,28 @@ import (
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
 	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
 	"github.com/circonus-labs/circonus-agent/internal/tags"
 	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/spf13/viper"
 )
 
 // NetIF metrics from the Linux ProcFS.
 type NetIF struct {
-	include *regexp.Regexp
-	exclude *regexp.Regexp
+	include      *regexp.Regexp
+	exclude      *regexp.Regexp
+	ethtoolStats *regexp.Regexp      // OPT driver statistics to include when ethtool is enabled
+	prev         map[string]ifSample // previous byte counters, for utilization
+	sysFSPath    string              // OPT sysfs mount point path
 	common
+	useEthtool bool // OPT collect driver statistics via the ethtool ioctl
+}
+
+// ifSample is a byte counter sample used to calculate utilization.
+type ifSample struct {
+	ts      time.Time
+	rxBytes uint64
+	txBytes uint64
 }
 
 // netIFOptions defines what elements can be overridden in a config file.
@@ -39,8 +52,11 @@ type netIFOptions struct {
 	RunTTL     string `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
 
 	// collector specific
-	IncludeRegex string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
-	ExcludeRegex string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+	IncludeRegex      string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
+	ExcludeRegex      string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+	SysFSPath         string `json:"sysfs_path" toml:"sysfs_path" yaml:"sysfs_path"`
+	EthtoolStats      string `json:"ethtool_stats" toml:"ethtool_stats" yaml:"ethtool_stats"`
+	EthtoolStatsRegex string `json:"ethtool_stats_regex" toml:"ethtool_stats_regex" yaml:"ethtool_stats_regex"`
 }
 
 // NewNetIFCollector creates new procfs if collector.
@@ -53,6 +69,12 @@ func NewNetIFCollector(cfgBaseName, procFSPath string) (collector.Collector, err
 
 	c.include = defaultIncludeRegex
 	c.exclude = regexp.MustCompile(fmt.Sprintf(regexPat, `lo`))
+	c.ethtoolStats = regexp.MustCompile(fmt.Sprintf(regexPat, `.*(?:err|drop|miss|fifo|discard|timeout).*`))
+	c.prev = make(map[string]ifSample)
+	c.sysFSPath = viper.GetString(config.KeyHostSys)
+	if c.sysFSPath == "" {
+		c.sysFSPath = defaults.HostSys
+	}
 
 	if cfgBaseName == "" {
 		if _, err := os.Stat(c.file); os.IsNotExist(err) {
@@ -88,6 +110,26 @@ func NewNetIFCollector(cfgBaseName, procFSPath string) (collector.Collector, err
 		c.exclude = rx
 	}
 
+	if opts.SysFSPath != "" {
+		c.sysFSPath = opts.SysFSPath
+	}
+
+	if opts.EthtoolStats != "" {
+		enabled, err := strconv.ParseBool(opts.EthtoolStats)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing ethtool_stats: %w", c.pkgID, err)
+		}
+		c.useEthtool = enabled
+	}
+
+	if opts.EthtoolStatsRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.EthtoolStatsRegex))
+		if err != nil {
+			return nil, fmt.Errorf("%s compile ethtool stats rx: %w", c.pkgID, err)
+		}
+		c.ethtoolStats = rx
+	}
+
 	if opts.ID != "" {
 		c.id = opts.ID
 	}
@@ -195,6 +237,8 @@ func (c *NetIF) ifCollect(ctx context.Context, metrics *cgm.Metrics) error {
 	}
 
 	metricType := "L" // uint64
+	now := time.Now()
+	seen := make(map[string]bool)
 
 	lines, err := c.readFile(c.file)
 	if err != nil {
@@ -241,7 +285,95 @@ func (c *NetIF) ifCollect(ctx context.Context, metrics *cgm.Metrics) error {
 			tagList = append(tagList, s.stags...)
 			_ = c.addMetric(metrics, "", s.name, metricType, v, tagList)
 		}
+
+		seen[iface] = true
+		sample := ifSample{ts: now}
+		sample.rxBytes, _ = strconv.ParseUint(fields[1], 10, 64)
+		sample.txBytes, _ = strconv.ParseUint(fields[9], 10, 64)
+
+		c.sysfsCollect(metrics, iface, sample)
+
+		if c.useEthtool {
+			if err := c.ethtoolCollect(metrics, iface); err != nil {
+				c.logger.Debug().Err(err).Str("iface", iface).Msg("ethtool stats")
+			}
+		}
+	}
+
+	// forget interfaces which no longer exist
+	for iface := range c.prev {
+		if !seen[iface] {
+			delete(c.prev, iface)
+		}
 	}
 
 	return nil
 }
+
+// sysfsCollect gets interface attributes (speed, duplex, mtu, operstate, etc.)
+// from /sys/class/net/<iface> and calculates utilization from speed.
+func (c *NetIF) sysfsCollect(metrics *cgm.Metrics, iface string, sample ifSample) {
+	ifDir := filepath.Join(c.sysFSPath, "class", "net", iface)
+	if _, err := os.Stat(ifDir); err != nil {
+		c.logger.Debug().Err(err).Str("iface", iface).Msg("interface attributes not available")
+		return
+	}
+
+	ifTag := tags.Tag{Category: "network-interface", Value: iface}
+
+	if v, ok := readSysAttr(filepath.Join(ifDir, "operstate")); ok {
+		up := uint32(0)
+		if v == "up" {
+			up = 1
+		}
+		_ = c.addMetric(metrics, "", "up", "I", up, tags.Tags{ifTag})
+		_ = c.addMetric(metrics, "", "operstate", "s", v, tags.Tags{ifTag})
+	}
+
+	if v, ok := readSysAttr(filepath.Join(ifDir, "duplex")); ok {
+		_ = c.addMetric(metrics, "", "duplex", "s", v, tags.Tags{ifTag})
+	}
+
+	if v, ok := readSysAttr(filepath.Join(ifDir, "mtu")); ok {
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			_ = c.addMetric(metrics, "", "mtu", "L", n, tags.Tags{ifTag, tags.Tag{Category: "units", Value: "bytes"}})
+		}
+	}
+
+	if v, ok := readSysAttr(filepath.Join(ifDir, "carrier_changes")); ok {
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			_ = c.addMetric(metrics, "", "carrier_changes", "L", n, tags.Tags{ifTag})
+		}
+	}
+
+	// bond/bridge member, master is a symlink to the bond or bridge interface
+	if link, err := os.Readlink(filepath.Join(ifDir, "master")); err == nil {
+		_ = c.addMetric(metrics, "", "master", "s", filepath.Base(link), tags.Tags{ifTag})
+	}
+
+	// reading speed returns an error (or -1) for virtual interfaces and when there is no link
+	speed := uint64(0)
+	if v, ok := readSysAttr(filepath.Join(ifDir, "speed")); ok {
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			speed = n
+			_ = c.addMetric(metrics, "", "speed", "L", speed, tags.Tags{ifTag, tags.Tag{Category: "units", Value: "megabits_per_second"}})
+		}
+	}
+
+	prev, havePrev := c.prev[iface]
+	c.prev[iface] = sample
+	if speed == 0 || !havePrev {
+		return
+	}
+	elapsed := sample.ts.Sub(prev.ts).Seconds()
+	if elapsed <= 0 || sample.rxBytes < prev.rxBytes || sample.txBytes < prev.txBytes {
+		return // counter reset
+	}
+
+	capacity := float64(speed) * 1000000 / 8 * elapsed // bytes possible in interval
+	unitPercentTag := tags.Tag{Category: "units", Value: "percent"}
+	_ = c.addMetric(metrics, "", "utilization", "n", float64(sample.rxBytes-prev.rxBytes)/capacity*100,
+		tags.Tags{ifTag, tags.Tag{Category: "direction", Value: "in"}, unitPercentTag})
+	_ = c.addMetric(metrics, "", "utilization", "n", float64(sample.txBytes-prev.txBytes)/capacity*100,
+		tags.Tags{ifTag, tags.Tag{Category: "direction", Value: "out"}, unitPercentTag})
+}
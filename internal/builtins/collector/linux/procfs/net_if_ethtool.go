@@ -0,0 +1,127 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"golang.org/x/sys/unix"
+)
+
+// ethtool definitions not provided by x/sys/unix.
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/ethtool.h
+const (
+	ethSSStats       = 1  // ETH_SS_STATS
+	ethGStringLen    = 32 // ETH_GSTRING_LEN
+	ethtoolMaxNStats = 4096
+)
+
+// ethtoolIfreq is struct ifreq with ifr_data.
+type ethtoolIfreq struct {
+	Name [unix.IFNAMSIZ]byte
+	Data uintptr
+	_    [16]byte // pad to sizeof(struct ifreq)
+}
+
+// ethtoolCollect gets driver statistics (e.g. rx_missed_errors, rx_fifo_errors)
+// via the SIOCETHTOOL ioctl (ETHTOOL_GSTRINGS and ETHTOOL_GSTATS).
+func (c *NetIF) ethtoolCollect(metrics *cgm.Metrics, iface string) error {
+	stats, err := ethtoolStats(iface)
+	if err != nil {
+		return fmt.Errorf("%s ethtool: %w", c.pkgID, err)
+	}
+
+	ifTag := tags.Tag{Category: "network-interface", Value: iface}
+	for name, v := range stats {
+		if !c.ethtoolStats.MatchString(name) {
+			continue
+		}
+		_ = c.addMetric(metrics, "ethtool", name, "L", v, tags.Tags{ifTag})
+	}
+
+	return nil
+}
+
+// ethtoolStats returns the driver statistics, by name, for an interface.
+func ethtoolStats(iface string) (map[string]uint64, error) {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	drvinfo, err := unix.IoctlGetEthtoolDrvinfo(fd, iface)
+	if err != nil {
+		return nil, fmt.Errorf("drvinfo: %w", err)
+	}
+	n := drvinfo.N_stats
+	if n == 0 {
+		return map[string]uint64{}, nil
+	}
+	if n > ethtoolMaxNStats {
+		return nil, fmt.Errorf("unexpected number of stats (%d)", n) //nolint:goerr113
+	}
+
+	// struct ethtool_gstrings { u32 cmd; u32 string_set; u32 len; u8 data[len * ETH_GSTRING_LEN]; }
+	gstrings := make([]byte, 12+int(n)*ethGStringLen)
+	*(*uint32)(unsafe.Pointer(&gstrings[0])) = unix.ETHTOOL_GSTRINGS
+	*(*uint32)(unsafe.Pointer(&gstrings[4])) = ethSSStats
+	*(*uint32)(unsafe.Pointer(&gstrings[8])) = n
+	if err := ethtoolIoctl(fd, iface, unsafe.Pointer(&gstrings[0])); err != nil {
+		return nil, fmt.Errorf("gstrings: %w", err)
+	}
+
+	// struct ethtool_stats { u32 cmd; u32 n_stats; u64 data[n_stats]; }
+	gstats := make([]uint64, 1+int(n))
+	*(*uint32)(unsafe.Pointer(&gstats[0])) = unix.ETHTOOL_GSTATS
+	*(*uint32)(unsafe.Pointer(uintptr(unsafe.Pointer(&gstats[0])) + 4)) = n
+	if err := ethtoolIoctl(fd, iface, unsafe.Pointer(&gstats[0])); err != nil {
+		return nil, fmt.Errorf("gstats: %w", err)
+	}
+
+	return parseEthtoolStats(gstrings[12:], gstats[1:]), nil
+}
+
+// parseEthtoolStats pairs the ETH_GSTRING_LEN stat names with their values.
+func parseEthtoolStats(names []byte, values []uint64) map[string]uint64 {
+	stats := make(map[string]uint64, len(values))
+	for i, v := range values {
+		if (i+1)*ethGStringLen > len(names) {
+			break
+		}
+		name := names[i*ethGStringLen : (i+1)*ethGStringLen]
+		if idx := bytes.IndexByte(name, 0); idx >= 0 {
+			name = name[:idx]
+		}
+		if len(name) == 0 {
+			continue
+		}
+		stats[string(bytes.TrimSpace(name))] = v
+	}
+	return stats
+}
+
+// ethtoolIoctl issues a SIOCETHTOOL ioctl with data as ifr_data.
+func ethtoolIoctl(fd int, iface string, data unsafe.Pointer) error {
+	var ifr ethtoolIfreq
+	copy(ifr.Name[:unix.IFNAMSIZ-1], iface)
+	ifr.Data = uintptr(data)
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr)))
+	runtime.KeepAlive(data)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
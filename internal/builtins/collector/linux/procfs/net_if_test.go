@@ -18,6 +18,8 @@ import (
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
 	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/circonus-labs/circonus-agent/internal/release"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
 	"github.com/rs/zerolog"
 )
 
@@ -158,6 +160,34 @@ func TestNewIFCollector(t *testing.T) {
 		}
 	}
 
+	t.Log("config (sysfs path setting)")
+	{
+		c, err := NewNetIFCollector(filepath.Join("testdata", "config_if_sysfs_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "sys")
+		if c.(*NetIF).sysFSPath != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*NetIF).sysFSPath)
+		}
+	}
+
+	t.Log("config (ethtool stats invalid)")
+	{
+		_, err := NewNetIFCollector(filepath.Join("testdata", "config_ethtool_stats_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (ethtool stats regex invalid)")
+	{
+		_, err := NewNetIFCollector(filepath.Join("testdata", "config_ethtool_stats_regex_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
 	t.Log("config (run ttl invalid)")
 	{
 		_, err := NewNetIFCollector(filepath.Join("testdata", "config_run_ttl_invalid_setting"), defaults.HostProc)
@@ -247,4 +277,91 @@ func TestIFCollect(t *testing.T) {
 			t.Fatalf("expected metrics, got %v", metrics)
 		}
 	}
+
+	t.Log("good (sysfs attributes and utilization)")
+	{
+		c, err := NewNetIFCollector(filepath.Join("testdata", "config_if_sysfs_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		// 12.5MB received in 10s on a 1000Mb/s link is 1% utilization
+		c.(*NetIF).prev["enp0s3"] = ifSample{ts: time.Now().Add(-10 * time.Second), rxBytes: 145074383 - 12500000, txBytes: 1340440}
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		baseTags := tags.Tags{
+			tags.Tag{Category: "source", Value: release.NAME},
+			tags.Tag{Category: "collector", Value: NameNetInterface},
+		}
+		ifTags := func(iface string, extra ...tags.Tag) tags.Tags {
+			tl := tags.Tags{tags.Tag{Category: "network-interface", Value: iface}}
+			tl = append(tl, baseTags...)
+			return append(tl, extra...)
+		}
+
+		m, ok := metrics[tags.MetricNameWithStreamTags("speed", ifTags("enp0s3", tags.Tag{Category: "units", Value: "megabits_per_second"}))]
+		if !ok {
+			t.Fatal("expected speed metric for enp0s3")
+		}
+		if m.Value.(uint64) != 1000 {
+			t.Fatalf("expected 1000, got %v", m.Value)
+		}
+
+		m, ok = metrics[tags.MetricNameWithStreamTags("master", ifTags("enp0s3"))]
+		if !ok {
+			t.Fatal("expected master metric for enp0s3")
+		}
+		if m.Value.(string) != "bond0" {
+			t.Fatalf("expected bond0, got %v", m.Value)
+		}
+
+		m, ok = metrics[tags.MetricNameWithStreamTags("utilization", ifTags("enp0s3", tags.Tag{Category: "direction", Value: "in"}, tags.Tag{Category: "units", Value: "percent"}))]
+		if !ok {
+			t.Fatal("expected utilization metric for enp0s3")
+		}
+		if v := m.Value.(float64); v < 0.99 || v > 1.01 {
+			t.Fatalf("expected ~1, got %v", v)
+		}
+
+		m, ok = metrics[tags.MetricNameWithStreamTags("up", ifTags("enp0s8"))]
+		if !ok {
+			t.Fatal("expected up metric for enp0s8")
+		}
+		if m.Value.(uint32) != 0 {
+			t.Fatalf("expected 0, got %v", m.Value)
+		}
+
+		if _, ok := metrics[tags.MetricNameWithStreamTags("speed", ifTags("enp0s8", tags.Tag{Category: "units", Value: "megabits_per_second"}))]; ok {
+			t.Fatal("expected no speed metric for enp0s8 (no link)")
+		}
+	}
+}
+
+func TestParseEthtoolStats(t *testing.T) {
+	t.Log("Testing parseEthtoolStats")
+
+	names := make([]byte, 3*ethGStringLen)
+	copy(names[0:], "rx_missed_errors")
+	copy(names[ethGStringLen:], "rx_fifo_errors")
+	copy(names[2*ethGStringLen:], "tx_packets")
+
+	stats := parseEthtoolStats(names, []uint64{5, 7, 1000})
+	if len(stats) != 3 {
+		t.Fatalf("expected 3 stats, got %v", stats)
+	}
+	if stats["rx_missed_errors"] != 5 || stats["rx_fifo_errors"] != 7 || stats["tx_packets"] != 1000 {
+		t.Fatalf("unexpected stats %v", stats)
+	}
+
+	t.Log("short names buffer")
+	{
+		stats := parseEthtoolStats(names[:ethGStringLen], []uint64{5, 7})
+		if len(stats) != 1 {
+			t.Fatalf("expected 1 stat, got %v", stats)
+		}
+	}
 }
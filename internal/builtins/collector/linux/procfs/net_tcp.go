@@ -0,0 +1,362 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+)
+
+// NetTCP metrics from the Linux ProcFS (net/tcp, net/tcp6 and netlink sock_diag).
+type NetTCP struct {
+	localPorts  map[uint16]bool // OPT server side ports, connections grouped by local port
+	remotePorts map[uint16]bool // OPT client side ports, connections grouped by remote port
+	tcp6File    string
+	common
+	useSockDiag bool // OPT use netlink sock_diag for rtt and retransmits
+}
+
+// netTCPOptions defines what elements can be overridden in a config file.
+type netTCPOptions struct {
+	// common
+	ID         string `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath string `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	RunTTL     string `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+
+	// collector specific
+	UseSockDiag string   `json:"use_sock_diag" toml:"use_sock_diag" yaml:"use_sock_diag"`
+	LocalPorts  []string `json:"local_ports" toml:"local_ports" yaml:"local_ports"`
+	RemotePorts []string `json:"remote_ports" toml:"remote_ports" yaml:"remote_ports"`
+}
+
+// tcpGroup identifies a set of connections metrics are aggregated for.
+type tcpGroup struct {
+	role  string // server (local port) or client (remote port)
+	state string
+	port  uint16
+}
+
+// tcpGroupStats are the aggregated metrics for a group of connections.
+type tcpGroupStats struct {
+	connections  uint64
+	sendQueue    uint64
+	recvQueue    uint64
+	retransmits  uint64
+	rttTotal     uint64
+	rttMax       uint64
+	rttSamples   uint64
+	haveSockDiag bool
+}
+
+const (
+	tcpRoleServer = "server"
+	tcpRoleClient = "client"
+)
+
+// tcpStates maps the kernel's tcp state numbers to names.
+// https://github.com/torvalds/linux/blob/master/include/net/tcp_states.h
+var tcpStates = map[uint8]string{
+	1:  "established",
+	2:  "syn_sent",
+	3:  "syn_recv",
+	4:  "fin_wait1",
+	5:  "fin_wait2",
+	6:  "time_wait",
+	7:  "close",
+	8:  "close_wait",
+	9:  "last_ack",
+	10: "listen",
+	11: "closing",
+	12: "new_syn_recv",
+}
+
+// NewNetTCPCollector creates new procfs tcp collector.
+func NewNetTCPCollector(cfgBaseName, procFSPath string) (collector.Collector, error) {
+	procFile := filepath.Join("net", "tcp")
+	tcp6File := filepath.Join("net", "tcp6")
+
+	c := NetTCP{
+		common: newCommon(NameNetTCP, procFSPath, procFile, tags.FromList(tags.GetBaseTags())),
+	}
+
+	c.localPorts = make(map[uint16]bool)
+	c.remotePorts = make(map[uint16]bool)
+	c.tcp6File = filepath.Join(c.procFSPath, tcp6File)
+	c.useSockDiag = true
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s procfile: %w", c.pkgID, err)
+		}
+		return &c, nil
+	}
+
+	var opts netTCPOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if !strings.Contains(err.Error(), "no config found matching") {
+			c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+			return nil, fmt.Errorf("%s config: %w", c.pkgID, err)
+		}
+	} else {
+		c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+	}
+
+	for _, p := range opts.LocalPorts {
+		v, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing local_ports: %w", c.pkgID, err)
+		}
+		c.localPorts[uint16(v)] = true
+	}
+
+	for _, p := range opts.RemotePorts {
+		v, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing remote_ports: %w", c.pkgID, err)
+		}
+		c.remotePorts[uint16(v)] = true
+	}
+
+	if opts.UseSockDiag != "" {
+		use, err := strconv.ParseBool(opts.UseSockDiag)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing use_sock_diag: %w", c.pkgID, err)
+		}
+		c.useSockDiag = use
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+		c.tcp6File = filepath.Join(c.procFSPath, tcp6File)
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing run_ttl: %w", c.pkgID, err)
+		}
+		c.runTTL = dur
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s procfile: %w", c.pkgID, err)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource.
+func (c *NetTCP) Collect(ctx context.Context) error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	stateTotals := make(map[string]uint64)
+	groups := make(map[tcpGroup]*tcpGroupStats)
+
+	if err := c.tcpCollect(ctx, c.file, stateTotals, groups); err != nil {
+		c.setStatus(metrics, err)
+		return fmt.Errorf("%s tcpCollect: %w", c.pkgID, err)
+	}
+
+	if _, err := os.Stat(c.tcp6File); err == nil {
+		if err := c.tcpCollect(ctx, c.tcp6File, stateTotals, groups); err != nil {
+			c.logger.Warn().Err(err).Msg("tcp6")
+		}
+	}
+
+	if c.useSockDiag && len(groups) > 0 {
+		if err := c.sockDiagCollect(ctx, groups); err != nil {
+			c.logger.Warn().Err(err).Msg("sock_diag")
+		}
+	}
+
+	c.emitMetrics(&metrics, stateTotals, groups)
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// tcpCollect gets connection counts and queue depths from /proc/net/tcp (or tcp6).
+func (c *NetTCP) tcpCollect(ctx context.Context, file string, stateTotals map[string]uint64, groups map[tcpGroup]*tcpGroupStats) error {
+	lines, err := c.readFile(file)
+	if err != nil {
+		return fmt.Errorf("%s read file: %w", c.pkgID, err)
+	}
+
+	// https://github.com/torvalds/linux/blob/master/net/ipv4/tcp_ipv4.c#L2590
+	//  0 sl
+	//  1 local_address (hex addr:port)
+	//  2 rem_address (hex addr:port)
+	//  3 st (hex state)
+	//  4 tx_queue:rx_queue (hex)
+	//  5+ timer, retransmits, uid, timeout, inode, etc. ignored
+	for _, line := range lines {
+		if done(ctx) {
+			return fmt.Errorf("context: %w", ctx.Err())
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] == "sl" {
+			continue // skip header and short lines
+		}
+
+		localPort, err := parseHexPort(fields[1])
+		if err != nil {
+			c.logger.Warn().Err(err).Str("addr", fields[1]).Msg("parsing local address")
+			continue
+		}
+		remotePort, err := parseHexPort(fields[2])
+		if err != nil {
+			c.logger.Warn().Err(err).Str("addr", fields[2]).Msg("parsing remote address")
+			continue
+		}
+		st, err := strconv.ParseUint(fields[3], 16, 8)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("state", fields[3]).Msg("parsing state")
+			continue
+		}
+		state, ok := tcpStates[uint8(st)]
+		if !ok {
+			c.logger.Debug().Uint64("state", st).Msg("unknown tcp state, skipping")
+			continue
+		}
+
+		stateTotals[state]++
+
+		queues := strings.SplitN(fields[4], ":", 2)
+		if len(queues) != 2 {
+			c.logger.Warn().Str("queues", fields[4]).Msg("invalid queue field")
+			continue
+		}
+		txQueue, err := strconv.ParseUint(queues[0], 16, 64)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("tx_queue", queues[0]).Msg("parsing tx_queue")
+			continue
+		}
+		rxQueue, err := strconv.ParseUint(queues[1], 16, 64)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("rx_queue", queues[1]).Msg("parsing rx_queue")
+			continue
+		}
+
+		for _, g := range c.groupsFor(localPort, remotePort, state) {
+			gs, ok := groups[g]
+			if !ok {
+				gs = &tcpGroupStats{}
+				groups[g] = gs
+			}
+			gs.connections++
+			gs.sendQueue += txQueue
+			gs.recvQueue += rxQueue
+		}
+	}
+
+	return nil
+}
+
+// groupsFor returns the group(s), from the configured port allowlists, a connection belongs to.
+func (c *NetTCP) groupsFor(localPort, remotePort uint16, state string) []tcpGroup {
+	var groups []tcpGroup
+	if c.localPorts[localPort] {
+		groups = append(groups, tcpGroup{role: tcpRoleServer, port: localPort, state: state})
+	}
+	if c.remotePorts[remotePort] && state != "listen" {
+		groups = append(groups, tcpGroup{role: tcpRoleClient, port: remotePort, state: state})
+	}
+	return groups
+}
+
+// emitMetrics adds the state totals and per port group metrics.
+func (c *NetTCP) emitMetrics(metrics *cgm.Metrics, stateTotals map[string]uint64, groups map[tcpGroup]*tcpGroupStats) {
+	tagUnitsConnections := tags.Tag{Category: "units", Value: "connections"}
+	tagUnitsBytes := tags.Tag{Category: "units", Value: "bytes"}
+	tagUnitsMicroseconds := tags.Tag{Category: "units", Value: "microseconds"}
+	tagUnitsSegments := tags.Tag{Category: "units", Value: "segments"}
+
+	for state, v := range stateTotals {
+		tagList := tags.Tags{tags.Tag{Category: "state", Value: state}, tagUnitsConnections}
+		_ = c.addMetric(metrics, "", "total_connections", "L", v, tagList)
+	}
+
+	for g, gs := range groups {
+		groupTags := tags.Tags{
+			tags.Tag{Category: "role", Value: g.role},
+			tags.Tag{Category: "port", Value: strconv.FormatUint(uint64(g.port), 10)},
+			tags.Tag{Category: "state", Value: g.state},
+		}
+
+		_ = c.addMetric(metrics, "", "connections", "L", gs.connections, append(tags.Tags{tagUnitsConnections}, groupTags...))
+		if g.state == "listen" {
+			// for listening sockets the kernel reports the current accept
+			// backlog as rx_queue and the max backlog as tx_queue
+			_ = c.addMetric(metrics, "", "backlog", "L", gs.recvQueue, append(tags.Tags{tagUnitsConnections}, groupTags...))
+			_ = c.addMetric(metrics, "", "max_backlog", "L", gs.sendQueue, append(tags.Tags{tagUnitsConnections}, groupTags...))
+		} else {
+			_ = c.addMetric(metrics, "", "send_queue", "L", gs.sendQueue, append(tags.Tags{tagUnitsBytes}, groupTags...))
+			_ = c.addMetric(metrics, "", "recv_queue", "L", gs.recvQueue, append(tags.Tags{tagUnitsBytes}, groupTags...))
+		}
+
+		if !gs.haveSockDiag {
+			continue
+		}
+
+		_ = c.addMetric(metrics, "", "retransmits", "L", gs.retransmits, append(tags.Tags{tagUnitsSegments}, groupTags...))
+		if gs.rttSamples > 0 {
+			_ = c.addMetric(metrics, "", "rtt_avg", "n", float64(gs.rttTotal)/float64(gs.rttSamples), append(tags.Tags{tagUnitsMicroseconds}, groupTags...))
+			_ = c.addMetric(metrics, "", "rtt_max", "L", gs.rttMax, append(tags.Tags{tagUnitsMicroseconds}, groupTags...))
+		}
+	}
+}
+
+// parseHexPort extracts the port from a procfs hex encoded address e.g. 0100007F:0019.
+func parseHexPort(addr string) (uint16, error) {
+	idx := strings.LastIndex(addr, ":")
+	if idx == -1 {
+		return 0, fmt.Errorf("invalid address (%s)", addr) //nolint:goerr113
+	}
+	v, err := strconv.ParseUint(addr[idx+1:], 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("parsing port: %w", err)
+	}
+	return uint16(v), nil
+}
@@ -0,0 +1,226 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// netlink sock_diag definitions not provided by x/sys/unix.
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/inet_diag.h
+const (
+	sockDiagByFamily   = 20 // SOCK_DIAG_BY_FAMILY
+	inetDiagInfo       = 2  // INET_DIAG_INFO
+	sizeofInetDiagReq  = 56 // sizeof(struct inet_diag_req_v2)
+	sizeofInetDiagMsg  = 72 // sizeof(struct inet_diag_msg)
+	sockDiagRecvBuffer = 32768
+	sockDiagTimeout    = 2 // seconds
+)
+
+// inetDiagSockID is struct inet_diag_sockid.
+type inetDiagSockID struct {
+	SPort  [2]byte // big endian
+	DPort  [2]byte // big endian
+	Src    [16]byte
+	Dst    [16]byte
+	If     uint32
+	Cookie [2]uint32
+}
+
+// inetDiagReqV2 is struct inet_diag_req_v2.
+type inetDiagReqV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	Pad      uint8
+	States   uint32
+	ID       inetDiagSockID
+}
+
+// inetDiagMsg is struct inet_diag_msg.
+type inetDiagMsg struct {
+	Family  uint8
+	State   uint8
+	Timer   uint8
+	Retrans uint8
+	ID      inetDiagSockID
+	Expires uint32
+	RQueue  uint32
+	WQueue  uint32
+	UID     uint32
+	Inode   uint32
+}
+
+// diagSocket is the subset of sock_diag information used by the collector.
+type diagSocket struct {
+	localPort    uint16
+	remotePort   uint16
+	state        uint8
+	rtt          uint32 // microseconds
+	totalRetrans uint32
+	haveInfo     bool
+}
+
+// sockDiagCollect adds rtt and retransmits, from netlink sock_diag, to the port groups.
+func (c *NetTCP) sockDiagCollect(ctx context.Context, groups map[tcpGroup]*tcpGroupStats) error {
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		if done(ctx) {
+			return fmt.Errorf("context: %w", ctx.Err())
+		}
+
+		socks, err := sockDiagDump(family)
+		if err != nil {
+			return fmt.Errorf("%s dump (family %d): %w", c.pkgID, family, err)
+		}
+
+		for _, s := range socks {
+			if !s.haveInfo {
+				continue
+			}
+			state, ok := tcpStates[s.state]
+			if !ok {
+				continue
+			}
+			for _, g := range c.groupsFor(s.localPort, s.remotePort, state) {
+				gs, ok := groups[g]
+				if !ok {
+					continue // only augment groups seen in procfs
+				}
+				gs.haveSockDiag = true
+				gs.retransmits += uint64(s.totalRetrans)
+				if s.rtt > 0 {
+					gs.rttSamples++
+					gs.rttTotal += uint64(s.rtt)
+					if uint64(s.rtt) > gs.rttMax {
+						gs.rttMax = uint64(s.rtt)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// sockDiagDump requests all tcp sockets, with tcp_info, for an address family.
+func sockDiagDump(family uint8) ([]diagSocket, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		return nil, fmt.Errorf("socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	tv := unix.Timeval{Sec: sockDiagTimeout}
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return nil, fmt.Errorf("setsockopt: %w", err)
+	}
+
+	req := inetDiagReqV2{
+		Family:   family,
+		Protocol: unix.IPPROTO_TCP,
+		Ext:      1 << (inetDiagInfo - 1),
+		States:   0xffffffff,
+	}
+	hdr := unix.NlMsghdr{
+		Len:   unix.NLMSG_HDRLEN + sizeofInetDiagReq,
+		Type:  sockDiagByFamily,
+		Flags: unix.NLM_F_REQUEST | unix.NLM_F_DUMP,
+		Seq:   1,
+	}
+
+	buf := make([]byte, hdr.Len)
+	copy(buf, (*[unix.NLMSG_HDRLEN]byte)(unsafe.Pointer(&hdr))[:])
+	copy(buf[unix.NLMSG_HDRLEN:], (*[sizeofInetDiagReq]byte)(unsafe.Pointer(&req))[:])
+
+	if err := unix.Sendto(fd, buf, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("sendto: %w", err)
+	}
+
+	var socks []diagSocket
+	rb := make([]byte, sockDiagRecvBuffer)
+	for {
+		n, _, err := unix.Recvfrom(fd, rb, 0)
+		if err != nil {
+			return socks, fmt.Errorf("recvfrom: %w", err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(rb[:n])
+		if err != nil {
+			return socks, fmt.Errorf("parsing netlink message: %w", err)
+		}
+
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case unix.NLMSG_DONE:
+				return socks, nil
+			case unix.NLMSG_ERROR:
+				if len(m.Data) >= 4 {
+					if errno := *(*int32)(unsafe.Pointer(&m.Data[0])); errno != 0 {
+						return socks, fmt.Errorf("netlink: %w", syscall.Errno(-errno))
+					}
+				}
+				return socks, nil
+			}
+
+			if s, ok := parseInetDiagMsg(m.Data); ok {
+				socks = append(socks, s)
+			}
+		}
+	}
+}
+
+// parseInetDiagMsg parses an inet_diag_msg and its INET_DIAG_INFO attribute (struct tcp_info).
+func parseInetDiagMsg(data []byte) (diagSocket, bool) {
+	if len(data) < sizeofInetDiagMsg {
+		return diagSocket{}, false
+	}
+
+	var msg inetDiagMsg
+	copy((*[sizeofInetDiagMsg]byte)(unsafe.Pointer(&msg))[:], data[:sizeofInetDiagMsg])
+
+	s := diagSocket{
+		localPort:  binary.BigEndian.Uint16(msg.ID.SPort[:]),
+		remotePort: binary.BigEndian.Uint16(msg.ID.DPort[:]),
+		state:      msg.State,
+	}
+
+	// attributes (struct rtattr, 4 byte aligned) follow the message
+	attrs := data[sizeofInetDiagMsg:]
+	for len(attrs) >= unix.SizeofRtAttr {
+		attr := (*unix.RtAttr)(unsafe.Pointer(&attrs[0]))
+		alen := int(attr.Len)
+		if alen < unix.SizeofRtAttr || alen > len(attrs) {
+			break
+		}
+		if attr.Type == inetDiagInfo {
+			info := attrs[unix.SizeofRtAttr:alen]
+			var ti unix.TCPInfo
+			// tcp_info grows over kernel versions, only require through total_retrans
+			if len(info) >= int(unsafe.Offsetof(ti.Total_retrans))+4 {
+				copy((*[unix.SizeofTCPInfo]byte)(unsafe.Pointer(&ti))[:], info)
+				s.rtt = ti.Rtt
+				s.totalRetrans = ti.Total_retrans
+				s.haveInfo = true
+			}
+		}
+		alen = (alen + unix.NLA_ALIGNTO - 1) &^ (unix.NLA_ALIGNTO - 1)
+		if alen > len(attrs) {
+			break
+		}
+		attrs = attrs[alen:]
+	}
+
+	return s, true
+}
@@ -0,0 +1,293 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+)
+
+func TestNewNetTCPCollector(t *testing.T) {
+	t.Log("Testing NewNetTCPCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("no config")
+	{
+		_, err := NewNetTCPCollector("", defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (missing)")
+	{
+		_, err := NewNetTCPCollector(filepath.Join("testdata", "missing"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewNetTCPCollector(filepath.Join("testdata", "bad_syntax"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewNetTCPCollector(filepath.Join("testdata", "config_id_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*NetTCP).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewNetTCPCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (ports)")
+	{
+		c, err := NewNetTCPCollector(filepath.Join("testdata", "config_tcp_ports_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		tc := c.(*NetTCP)
+		if !tc.localPorts[22] || !tc.localPorts[8080] || len(tc.localPorts) != 2 {
+			t.Fatalf("expected local ports 22,8080 got (%v)", tc.localPorts)
+		}
+		if !tc.remotePorts[3306] || len(tc.remotePorts) != 1 {
+			t.Fatalf("expected remote port 3306 got (%v)", tc.remotePorts)
+		}
+		if tc.useSockDiag {
+			t.Fatal("expected use_sock_diag false")
+		}
+	}
+
+	t.Log("config (ports invalid)")
+	{
+		_, err := NewNetTCPCollector(filepath.Join("testdata", "config_tcp_ports_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (use sock diag invalid)")
+	{
+		_, err := NewNetTCPCollector(filepath.Join("testdata", "config_use_sock_diag_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewNetTCPCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*NetTCP).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestNetTCPCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewNetTCPCollector(filepath.Join("testdata", "config_tcp_ports_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*NetTCP).running = true
+
+		if err := c.Collect(context.Background()); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good (no ports)")
+	{
+		c, err := NewNetTCPCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		// only totals by state: listen, established, time_wait, close_wait
+		metrics := c.Flush()
+		if len(metrics) != 4 {
+			t.Fatalf("expected 4 metrics, got %d", len(metrics))
+		}
+	}
+
+	t.Log("good (ports)")
+	{
+		c, err := NewNetTCPCollector(filepath.Join("testdata", "config_tcp_ports_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		// 4 state totals + 6 port groups * (connections, send_queue|backlog, recv_queue|max_backlog)
+		metrics := c.Flush()
+		if len(metrics) != 22 {
+			t.Fatalf("expected 22 metrics, got %d", len(metrics))
+		}
+	}
+
+	t.Log("good (listen backlog)")
+	{
+		c, err := NewNetTCPCollector(filepath.Join("testdata", "config_tcp_ports_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		tc := c.(*NetTCP)
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		metrics := c.Flush()
+
+		listenTags := tags.Tags{
+			tags.Tag{Category: "role", Value: tcpRoleServer},
+			tags.Tag{Category: "port", Value: "8080"},
+			tags.Tag{Category: "state", Value: "listen"},
+		}
+		expected := map[string]uint64{"backlog": 3, "max_backlog": 128}
+		for mname, val := range expected {
+			want := cgm.Metrics{}
+			_ = tc.addMetric(&want, "", mname, "L", val, append(tags.Tags{tags.Tag{Category: "units", Value: "connections"}}, listenTags...))
+			for name, m := range want {
+				got, ok := metrics[name]
+				if !ok {
+					t.Fatalf("expected %s metric for listen socket", mname)
+				}
+				if got.Value != m.Value {
+					t.Fatalf("expected %s %v, got %v", mname, m.Value, got.Value)
+				}
+			}
+		}
+
+		for _, mname := range []string{"send_queue", "recv_queue"} {
+			unwanted := cgm.Metrics{}
+			_ = tc.addMetric(&unwanted, "", mname, "L", uint64(0), append(tags.Tags{tags.Tag{Category: "units", Value: "bytes"}}, listenTags...))
+			for name := range unwanted {
+				if _, ok := metrics[name]; ok {
+					t.Fatalf("expected no %s metric for listen socket", mname)
+				}
+			}
+		}
+	}
+}
+
+func TestNetTCPGroups(t *testing.T) {
+	t.Log("Testing tcpCollect groups")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	c, err := NewNetTCPCollector(filepath.Join("testdata", "config_tcp_ports_valid_setting"), defaults.HostProc)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	tc := c.(*NetTCP)
+
+	totals := make(map[string]uint64)
+	groups := make(map[tcpGroup]*tcpGroupStats)
+	if err := tc.tcpCollect(context.Background(), tc.file, totals, groups); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	gs, ok := groups[tcpGroup{role: tcpRoleServer, port: 22, state: "established"}]
+	if !ok {
+		t.Fatal("expected server:22:established group")
+	}
+	if gs.connections != 2 || gs.sendQueue != 36 || gs.recvQueue != 16 {
+		t.Fatalf("unexpected group stats %#v", gs)
+	}
+
+	if _, ok := groups[tcpGroup{role: tcpRoleClient, port: 3306, state: "time_wait"}]; !ok {
+		t.Fatal("expected client:3306:time_wait group")
+	}
+
+	if totals["established"] != 3 {
+		t.Fatalf("expected 3 established, got %d", totals["established"])
+	}
+}
+
+func TestParseInetDiagMsg(t *testing.T) {
+	t.Log("Testing parseInetDiagMsg")
+
+	t.Log("short message")
+	{
+		if _, ok := parseInetDiagMsg(make([]byte, 10)); ok {
+			t.Fatal("expected not ok")
+		}
+	}
+
+	t.Log("message with tcp_info")
+	{
+		msg := inetDiagMsg{State: 1}
+		msg.ID.SPort = [2]byte{0x00, 0x16}
+		msg.ID.DPort = [2]byte{0x0c, 0xea}
+
+		ti := unix.TCPInfo{Rtt: 1250, Total_retrans: 7}
+		attr := unix.RtAttr{Len: unix.SizeofRtAttr + unix.SizeofTCPInfo, Type: inetDiagInfo}
+
+		data := make([]byte, 0, sizeofInetDiagMsg+int(attr.Len))
+		data = append(data, (*[sizeofInetDiagMsg]byte)(unsafe.Pointer(&msg))[:]...)
+		data = append(data, (*[unix.SizeofRtAttr]byte)(unsafe.Pointer(&attr))[:]...)
+		data = append(data, (*[unix.SizeofTCPInfo]byte)(unsafe.Pointer(&ti))[:]...)
+
+		s, ok := parseInetDiagMsg(data)
+		if !ok {
+			t.Fatal("expected ok")
+		}
+		if s.localPort != 22 || s.remotePort != 3306 || s.state != 1 {
+			t.Fatalf("unexpected socket %#v", s)
+		}
+		if !s.haveInfo || s.rtt != 1250 || s.totalRetrans != 7 {
+			t.Fatalf("unexpected tcp_info %#v", s)
+		}
+	}
+}
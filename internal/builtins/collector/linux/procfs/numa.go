@@ -0,0 +1,341 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/spf13/viper"
+)
+
+// NUMA metrics from the Linux ProcFS (buddyinfo) and SysFS (numa nodes and hugepages).
+type NUMA struct {
+	sysFSPath string // OPT sysfs mount point path
+	common
+}
+
+// numaOptions defines what elements can be overridden in a config file.
+type numaOptions struct {
+	// common
+	ID         string `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath string `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	RunTTL     string `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+
+	// collector specific
+	SysFSPath string `json:"sysfs_path" toml:"sysfs_path" yaml:"sysfs_path"`
+}
+
+// numaNodeMeminfo maps the node meminfo fields emitted to metric names.
+var numaNodeMeminfo = map[string]string{
+	"MemTotal":     "memory_total",
+	"MemFree":      "memory_free",
+	"MemUsed":      "memory_used",
+	"Active":       "active",
+	"Inactive":     "inactive",
+	"Dirty":        "dirty",
+	"FilePages":    "file_pages",
+	"Mapped":       "mapped",
+	"AnonPages":    "anon_pages",
+	"Shmem":        "shared",
+	"PageTables":   "page_tables",
+	"Slab":         "slab",
+	"SReclaimable": "slab_reclaimable",
+}
+
+// hugepageFiles maps the hugepages sysfs files to metric names.
+var hugepageFiles = map[string]string{
+	"nr_hugepages":      "hugepages_total",
+	"free_hugepages":    "hugepages_free",
+	"resv_hugepages":    "hugepages_reserved",
+	"surplus_hugepages": "hugepages_surplus",
+}
+
+// NewNUMACollector creates new procfs numa collector.
+func NewNUMACollector(cfgBaseName, procFSPath string) (collector.Collector, error) {
+	procFile := "buddyinfo"
+
+	c := NUMA{
+		common: newCommon(NameNUMA, procFSPath, procFile, tags.FromList(tags.GetBaseTags())),
+	}
+
+	c.sysFSPath = viper.GetString(config.KeyHostSys)
+	if c.sysFSPath == "" {
+		c.sysFSPath = defaults.HostSys
+	}
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s procfile: %w", c.pkgID, err)
+		}
+		return &c, nil
+	}
+
+	var opts numaOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if !strings.Contains(err.Error(), "no config found matching") {
+			c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+			return nil, fmt.Errorf("%s config: %w", c.pkgID, err)
+		}
+	} else {
+		c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+	}
+
+	if opts.SysFSPath != "" {
+		c.sysFSPath = opts.SysFSPath
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing run_ttl: %w", c.pkgID, err)
+		}
+		c.runTTL = dur
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s procfile: %w", c.pkgID, err)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource.
+func (c *NUMA) Collect(ctx context.Context) error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	if err := c.buddyinfoCollect(ctx, &metrics); err != nil {
+		c.setStatus(metrics, err)
+		return fmt.Errorf("%s buddyinfoCollect: %w", c.pkgID, err)
+	}
+
+	// sysfs may not be available (e.g. container without host sys mounted),
+	// log and continue with what is available
+	if err := c.nodesCollect(ctx, &metrics); err != nil {
+		c.logger.Warn().Err(err).Msg("numa nodes")
+	}
+
+	hpDir := filepath.Join(c.sysFSPath, "kernel", "mm", "hugepages")
+	if err := c.hugepagesCollect(ctx, &metrics, hpDir, tags.Tags{}); err != nil {
+		c.logger.Warn().Err(err).Msg("hugepages")
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// buddyinfoCollect gets free blocks per order from /proc/buddyinfo.
+func (c *NUMA) buddyinfoCollect(ctx context.Context, metrics *cgm.Metrics) error {
+	lines, err := c.readFile(c.file)
+	if err != nil {
+		return fmt.Errorf("%s read file: %w", c.pkgID, err)
+	}
+
+	tagUnitsBlocks := tags.Tag{Category: "units", Value: "blocks"}
+	metricType := "L" // uint64
+
+	// Node 0, zone   Normal   6889   2978   2575   1561    744    242     47     16     10      6     21
+	//  0 "Node"
+	//  1 node id (with trailing comma)
+	//  2 "zone"
+	//  3 zone name
+	//  4+ free blocks of order 0..n (block size is 2^order pages)
+	for _, line := range lines {
+		if done(ctx) {
+			return fmt.Errorf("context: %w", ctx.Err())
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "Node" {
+			continue
+		}
+
+		node := strings.TrimSuffix(fields[1], ",")
+		zone := strings.ToLower(fields[3])
+
+		for order, f := range fields[4:] {
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("node", node).Str("zone", zone).Int("order", order).Msg("parsing field")
+				continue
+			}
+			tagList := tags.Tags{
+				tags.Tag{Category: "numa-node", Value: node},
+				tags.Tag{Category: "zone", Value: zone},
+				tags.Tag{Category: "order", Value: strconv.Itoa(order)},
+				tagUnitsBlocks,
+			}
+			_ = c.addMetric(metrics, "", "free_blocks", metricType, v, tagList)
+		}
+	}
+
+	return nil
+}
+
+// nodesCollect gets per node meminfo, numastat and hugepages from sysfs.
+func (c *NUMA) nodesCollect(ctx context.Context, metrics *cgm.Metrics) error {
+	nodeDirs, err := filepath.Glob(filepath.Join(c.sysFSPath, "devices", "system", "node", "node[0-9]*"))
+	if err != nil {
+		return fmt.Errorf("%s glob nodes: %w", c.pkgID, err)
+	}
+	if len(nodeDirs) == 0 {
+		return fmt.Errorf("%s no numa nodes found", c.pkgID) //nolint:goerr113
+	}
+
+	tagUnitsBytes := tags.Tag{Category: "units", Value: "bytes"}
+	tagUnitsPages := tags.Tag{Category: "units", Value: "pages"}
+
+	for _, nodeDir := range nodeDirs {
+		if done(ctx) {
+			return fmt.Errorf("context: %w", ctx.Err())
+		}
+
+		node := strings.TrimPrefix(filepath.Base(nodeDir), "node")
+		nodeTag := tags.Tag{Category: "numa-node", Value: node}
+
+		// Node 0 MemTotal:        5078776 kB
+		if lines, err := c.readFile(filepath.Join(nodeDir, "meminfo")); err != nil {
+			c.logger.Warn().Err(err).Str("node", node).Msg("node meminfo")
+		} else {
+			for _, line := range lines {
+				fields := strings.Fields(line)
+				if len(fields) < 4 {
+					continue
+				}
+				name, ok := numaNodeMeminfo[strings.TrimSuffix(fields[2], ":")]
+				if !ok {
+					continue
+				}
+				v, err := strconv.ParseUint(fields[3], 10, 64)
+				if err != nil {
+					c.logger.Warn().Err(err).Str("node", node).Msg("parsing field " + fields[2])
+					continue
+				}
+				if len(fields) > 4 && strings.ToLower(fields[4]) == "kb" {
+					v *= uint64(1024)
+				}
+				_ = c.addMetric(metrics, "", name, "L", v, tags.Tags{nodeTag, tagUnitsBytes})
+			}
+		}
+
+		// numa_hit 7598854
+		if lines, err := c.readFile(filepath.Join(nodeDir, "numastat")); err != nil {
+			c.logger.Warn().Err(err).Str("node", node).Msg("node numastat")
+		} else {
+			for _, line := range lines {
+				fields := strings.Fields(line)
+				if len(fields) != 2 {
+					continue
+				}
+				v, err := strconv.ParseUint(fields[1], 10, 64)
+				if err != nil {
+					c.logger.Warn().Err(err).Str("node", node).Msg("parsing field " + fields[0])
+					continue
+				}
+				_ = c.addMetric(metrics, "", fields[0], "L", v, tags.Tags{nodeTag, tagUnitsPages})
+			}
+		}
+
+		hpDir := filepath.Join(nodeDir, "hugepages")
+		if _, err := os.Stat(hpDir); err == nil {
+			if err := c.hugepagesCollect(ctx, metrics, hpDir, tags.Tags{nodeTag}); err != nil {
+				c.logger.Warn().Err(err).Str("node", node).Msg("node hugepages")
+			}
+		}
+	}
+
+	return nil
+}
+
+// hugepagesCollect gets hugepage counts, per page size, from a sysfs hugepages directory.
+func (c *NUMA) hugepagesCollect(ctx context.Context, metrics *cgm.Metrics, hpDir string, hpTags tags.Tags) error {
+	sizeDirs, err := filepath.Glob(filepath.Join(hpDir, "hugepages-*kB"))
+	if err != nil {
+		return fmt.Errorf("%s glob hugepages: %w", c.pkgID, err)
+	}
+
+	tagUnitsHugePages := tags.Tag{Category: "units", Value: "hugepages"}
+
+	for _, sizeDir := range sizeDirs {
+		if done(ctx) {
+			return fmt.Errorf("context: %w", ctx.Err())
+		}
+
+		// hugepages-2048kB
+		sz := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(sizeDir), "hugepages-"), "kB")
+		kb, err := strconv.ParseUint(sz, 10, 64)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("dir", sizeDir).Msg("parsing hugepage size")
+			continue
+		}
+
+		tagList := tags.Tags{
+			tags.Tag{Category: "hugepage-size", Value: strconv.FormatUint(kb*1024, 10)},
+			tagUnitsHugePages,
+		}
+		tagList = append(tagList, hpTags...)
+
+		for file, name := range hugepageFiles {
+			data, err := os.ReadFile(filepath.Join(sizeDir, file))
+			if err != nil {
+				if !os.IsNotExist(err) { // per node dirs do not have resv_hugepages
+					c.logger.Warn().Err(err).Str("dir", sizeDir).Str("file", file).Msg("reading hugepages")
+				}
+				continue
+			}
+			v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("dir", sizeDir).Str("file", file).Msg("parsing hugepages")
+				continue
+			}
+			_ = c.addMetric(metrics, "", name, "L", v, tagList)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package procfs
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/rs/zerolog"
+)
+
+func TestNewNUMACollector(t *testing.T) {
+	t.Log("Testing NewNUMACollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("no config")
+	{
+		c, err := NewNUMACollector("", defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*NUMA).sysFSPath != defaults.HostSys {
+			t.Fatalf("expected (%s) got (%s)", defaults.HostSys, c.(*NUMA).sysFSPath)
+		}
+	}
+
+	t.Log("config (missing)")
+	{
+		_, err := NewNUMACollector(filepath.Join("testdata", "missing"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewNUMACollector(filepath.Join("testdata", "bad_syntax"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewNUMACollector(filepath.Join("testdata", "config_id_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*NUMA).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+	}
+
+	t.Log("config (sysfs path setting)")
+	{
+		c, err := NewNUMACollector(filepath.Join("testdata", "config_sysfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "sys")
+		if c.(*NUMA).sysFSPath != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*NUMA).sysFSPath)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewNUMACollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewNUMACollector(filepath.Join("testdata", "config_run_ttl_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*NUMA).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+
+	t.Log("config (run ttl invalid)")
+	{
+		_, err := NewNUMACollector(filepath.Join("testdata", "config_run_ttl_invalid_setting"), defaults.HostProc)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestNUMACollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewNUMACollector(filepath.Join("testdata", "config_sysfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*NUMA).running = true
+
+		if err := c.Collect(context.Background()); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("ttl not expired")
+	{
+		c, err := NewNUMACollector(filepath.Join("testdata", "config_sysfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*NUMA).runTTL = 60 * time.Second
+		c.(*NUMA).lastEnd = time.Now()
+
+		if err := c.Collect(context.Background()); err != nil {
+			if err.Error() != collector.ErrTTLNotExpired.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrTTLNotExpired, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good")
+	{
+		c, err := NewNUMACollector(filepath.Join("testdata", "config_sysfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		// buddyinfo 4*11, node meminfo 2*13, numastat 2*6, node hugepages 2*3, hugepages 2*4
+		metrics := c.Flush()
+		if len(metrics) != 96 {
+			t.Fatalf("expected 96 metrics, got %d", len(metrics))
+		}
+	}
+
+	t.Log("good (no sysfs)")
+	{
+		c, err := NewNUMACollector(filepath.Join("testdata", "config_procfs_path_valid_setting"), defaults.HostProc)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		c.(*NUMA).sysFSPath = filepath.Join("testdata", "missing")
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 44 {
+			t.Fatalf("expected 44 metrics, got %d", len(metrics))
+		}
+	}
+}
@@ -29,12 +29,17 @@ const (
 	PackageName      = "builtins.linux.procfs"
 	NameCPU          = "cpu"
 	NameDisk         = "disk"
+	NameFS           = "fs"
+	NameInterrupts   = "interrupts"
 	NameNetInterface = "if"
 	NameNetProto     = "proto"
 	NameNetSocket    = "socket"
+	NameNetTCP       = "tcp"
 	NameLoad         = "load"
+	NameNUMA         = "numa"
 	NameVM           = "vm"
 	regexPat         = `^(?:%s)$` // fmt pattern used compile include/exclude regular expressions
+	metricNameChar   = "_"        // character used to replace invalid characters in metric names
 )
 
 var (
@@ -44,6 +49,7 @@ var (
 	errInvalidFile         = fmt.Errorf("invalid file, empty")
 	defaultExcludeRegex    = regexp.MustCompile(fmt.Sprintf(regexPat, ""))
 	defaultIncludeRegex    = regexp.MustCompile(fmt.Sprintf(regexPat, ".+"))
+	metricNameRegex        = regexp.MustCompile("[^a-zA-Z0-9._:`-]")
 )
 
 // New creates new ProcFS collector.
@@ -93,6 +99,26 @@ func New(ctx context.Context) ([]collector.Collector, error) {
 				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
 				continue
 			}
+			// block latency tracer, if enabled, runs for the life of the agent
+			if err := c.(*Disk).startLatency(ctx); err != nil {
+				l.Warn().Str("name", name).Err(err).Msg("latency histograms disabled")
+			}
+			collectors = append(collectors, c)
+
+		case NameFS:
+			c, err := NewFSCollector(path.Join(defaults.EtcPath, cfgBase), ProcFSPath)
+			if err != nil {
+				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
+				continue
+			}
+			collectors = append(collectors, c)
+
+		case NameInterrupts:
+			c, err := NewInterruptsCollector(path.Join(defaults.EtcPath, cfgBase), ProcFSPath)
+			if err != nil {
+				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
+				continue
+			}
 			collectors = append(collectors, c)
 
 		case NameNetInterface:
@@ -119,6 +145,14 @@ func New(ctx context.Context) ([]collector.Collector, error) {
 			}
 			collectors = append(collectors, c)
 
+		case NameNetTCP:
+			c, err := NewNetTCPCollector(path.Join(defaults.EtcPath, cfgBase), ProcFSPath)
+			if err != nil {
+				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
+				continue
+			}
+			collectors = append(collectors, c)
+
 		case NameLoad, "loadavg": // cover old, deprecated name
 			c, err := NewLoadCollector(path.Join(defaults.EtcPath, cfgBase), ProcFSPath)
 			if err != nil {
@@ -127,6 +161,14 @@ func New(ctx context.Context) ([]collector.Collector, error) {
 			}
 			collectors = append(collectors, c)
 
+		case NameNUMA:
+			c, err := NewNUMACollector(path.Join(defaults.EtcPath, cfgBase), ProcFSPath)
+			if err != nil {
+				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
+				continue
+			}
+			collectors = append(collectors, c)
+
 		case NameVM:
 			c, err := NewVMCollector(path.Join(defaults.EtcPath, cfgBase), ProcFSPath)
 			if err != nil {
@@ -0,0 +1,96 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+// Package systemd builtin linux-specific collector for systemd units via D-Bus (replaces systemd unit check plugins)
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	CollectorPrefix = "systemd/"
+	PackageName     = "builtins.linux.systemd"
+	NameUnits       = "units"
+	regexPat        = `^(?:%s)$` // fmt pattern used compile include/exclude regular expressions
+)
+
+var (
+	errInvalidMetric       = fmt.Errorf("invalid metric, nil")
+	errInvalidMetricNoName = fmt.Errorf("invalid metric, no name")
+	errInvalidMetricNoType = fmt.Errorf("invalid metric, no type")
+	errNoSocket            = fmt.Errorf("no systemd d-bus socket found")
+	defaultExcludeRegex    = regexp.MustCompile(fmt.Sprintf(regexPat, ""))
+	defaultIncludeRegex    = regexp.MustCompile(fmt.Sprintf(regexPat, `.+\.service`))
+)
+
+// New creates new systemd collectors.
+func New(_ context.Context) ([]collector.Collector, error) {
+	none := []collector.Collector{}
+
+	if runtime.GOOS != "linux" {
+		return none, nil
+	}
+
+	l := log.With().Str("pkg", PackageName).Logger()
+
+	runPath := viper.GetString(config.KeyHostRun)
+	if runPath == "" {
+		runPath = defaults.HostRun
+	}
+
+	enbledCollectors := viper.GetStringSlice(config.KeyCollectors)
+	if len(enbledCollectors) == 0 {
+		l.Info().Msg("no builtin collectors enabled")
+		return none, nil
+	}
+
+	collectors := make([]collector.Collector, 0, len(enbledCollectors))
+	initErrMsg := "initializing builtin collector"
+	for _, name := range enbledCollectors {
+		if !strings.HasPrefix(name, CollectorPrefix) {
+			continue
+		}
+		name = strings.ReplaceAll(name, CollectorPrefix, "")
+		cfgBase := "systemd_" + name + "_collector"
+		switch name {
+		case NameUnits:
+			c, err := NewUnitsCollector(path.Join(defaults.EtcPath, cfgBase), runPath)
+			if err != nil {
+				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
+				continue
+			}
+			collectors = append(collectors, c)
+
+		default:
+			l.Warn().Str("name", name).Msg("unknown builtin collector, ignoring")
+		}
+	}
+
+	return collectors, nil
+}
+
+func done(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	dbusDest           = "org.freedesktop.systemd1"
+	dbusPath           = dbus.ObjectPath("/org/freedesktop/systemd1")
+	dbusListUnits      = "org.freedesktop.systemd1.Manager.ListUnits"
+	dbusGetAll         = "org.freedesktop.DBus.Properties.GetAll"
+	dbusUnitIfacePfx   = "org.freedesktop.systemd1."
+	defaultDBusTimeout = 5 * time.Second
+)
+
+// unitTypeIfaces are the unit types which expose resource accounting
+// properties (MemoryCurrent, CPUUsageNSec) and the interface name for each.
+var unitTypeIfaces = map[string]string{
+	"service": "Service",
+	"socket":  "Socket",
+	"mount":   "Mount",
+	"swap":    "Swap",
+	"slice":   "Slice",
+	"scope":   "Scope",
+}
+
+// Units metrics from systemd via D-Bus.
+type Units struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+	common                // common attributes
+	timeout time.Duration // OPT timeout for d-bus calls
+}
+
+// unitsOptions defines what elements can be overridden in a config file.
+type unitsOptions struct {
+	// common
+	ID      string `json:"id" toml:"id" yaml:"id"`
+	RunPath string `json:"run_path" toml:"run_path" yaml:"run_path"`
+	RunTTL  string `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+
+	// collector specific
+	IncludeRegex string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
+	ExcludeRegex string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+	Timeout      string `json:"timeout" toml:"timeout" yaml:"timeout"`
+}
+
+// unitStatus is the structure returned, per unit, by ListUnits (ssssssouso).
+type unitStatus struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Followed    string
+	Path        dbus.ObjectPath
+	JobID       uint32
+	JobType     string
+	JobPath     dbus.ObjectPath
+}
+
+// NewUnitsCollector creates new systemd units collector.
+func NewUnitsCollector(cfgBaseName, runPath string) (collector.Collector, error) {
+	c := Units{
+		common: newCommon(NameUnits, runPath, tags.FromList(tags.GetBaseTags())),
+	}
+
+	c.include = defaultIncludeRegex
+	c.exclude = defaultExcludeRegex
+	c.timeout = defaultDBusTimeout
+
+	if cfgBaseName == "" {
+		if len(c.sockets()) == 0 {
+			return nil, fmt.Errorf("%s %w (%s)", c.pkgID, errNoSocket, c.runPath)
+		}
+		return &c, nil
+	}
+
+	var opts unitsOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if !strings.Contains(err.Error(), "no config found matching") {
+			c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+			return nil, fmt.Errorf("%s config: %w", c.pkgID, err)
+		}
+	} else {
+		c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+	}
+
+	if opts.IncludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.IncludeRegex))
+		if err != nil {
+			return nil, fmt.Errorf("%s compile include rx: %w", c.pkgID, err)
+		}
+		c.include = rx
+	}
+
+	if opts.ExcludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.ExcludeRegex))
+		if err != nil {
+			return nil, fmt.Errorf("%s compile exclude rx: %w", c.pkgID, err)
+		}
+		c.exclude = rx
+	}
+
+	if opts.Timeout != "" {
+		dur, err := time.ParseDuration(opts.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing timeout: %w", c.pkgID, err)
+		}
+		c.timeout = dur
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.RunPath != "" {
+		c.runPath = opts.RunPath
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, fmt.Errorf("%s parsing run_ttl: %w", c.pkgID, err)
+		}
+		c.runTTL = dur
+	}
+
+	if len(c.sockets()) == 0 {
+		return nil, fmt.Errorf("%s %w (%s)", c.pkgID, errNoSocket, c.runPath)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from systemd.
+func (c *Units) Collect(ctx context.Context) error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	if err := c.unitsCollect(ctx, &metrics); err != nil {
+		c.setStatus(metrics, err)
+		return fmt.Errorf("%s unitsCollect: %w", c.pkgID, err)
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// unitsCollect gets unit states and resource accounting from systemd.
+func (c *Units) unitsCollect(ctx context.Context, metrics *cgm.Metrics) error {
+	cctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	conn, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var units []unitStatus
+	if err := conn.Object(dbusDest, dbusPath).CallWithContext(cctx, dbusListUnits, 0).Store(&units); err != nil {
+		return fmt.Errorf("%s list units: %w", c.pkgID, err)
+	}
+
+	failed := uint32(0)
+	for _, u := range units {
+		if done(ctx) {
+			return fmt.Errorf("context: %w", ctx.Err())
+		}
+
+		if u.ActiveState == "failed" {
+			failed++
+		}
+
+		if c.exclude.MatchString(u.Name) || !c.include.MatchString(u.Name) {
+			continue
+		}
+
+		unitType := u.Name[strings.LastIndex(u.Name, ".")+1:]
+		tagList := tags.Tags{
+			tags.Tag{Category: "unit", Value: u.Name},
+			tags.Tag{Category: "unit-type", Value: unitType},
+		}
+
+		active := uint32(0)
+		if u.ActiveState == "active" {
+			active = 1
+		}
+		_ = c.addMetric(metrics, "", "active", "I", active, tagList)
+		_ = c.addMetric(metrics, "", "active_state", "s", u.ActiveState, tagList)
+		_ = c.addMetric(metrics, "", "sub_state", "s", u.SubState, tagList)
+
+		iface, ok := unitTypeIfaces[unitType]
+		if !ok || u.LoadState != "loaded" {
+			continue
+		}
+
+		var props map[string]dbus.Variant
+		if err := conn.Object(dbusDest, u.Path).CallWithContext(cctx, dbusGetAll, 0, dbusUnitIfacePfx+iface).Store(&props); err != nil {
+			c.logger.Warn().Err(err).Str("unit", u.Name).Msg("getting unit properties")
+			continue
+		}
+
+		if v, ok := props["NRestarts"].Value().(uint32); ok {
+			_ = c.addMetric(metrics, "", "restarts", "I", v, tagList)
+		}
+
+		// systemd reports (uint64)-1 when accounting is not enabled/available for the unit
+		if v, ok := props["MemoryCurrent"].Value().(uint64); ok && v != math.MaxUint64 {
+			_ = c.addMetric(metrics, "", "memory_current", "L", v, append(tagList, tags.Tag{Category: "units", Value: "bytes"}))
+		}
+		if v, ok := props["CPUUsageNSec"].Value().(uint64); ok && v != math.MaxUint64 {
+			_ = c.addMetric(metrics, "", "cpu_usage", "L", v, append(tagList, tags.Tag{Category: "units", Value: "nanoseconds"}))
+		}
+	}
+
+	_ = c.addMetric(metrics, "", "failed_units", "I", failed, tags.Tags{})
+
+	return nil
+}
+
+// dbusSocket is a candidate socket to reach systemd.
+type dbusSocket struct {
+	path string
+	bus  bool // true for the system bus (requires Hello), false for the systemd private (peer-to-peer) socket
+}
+
+// sockets returns the available sockets, in order of preference, under the run path.
+func (c *Units) sockets() []dbusSocket {
+	candidates := []dbusSocket{
+		{path: filepath.Join(c.runPath, "systemd", "private"), bus: false},
+		{path: filepath.Join(c.runPath, "dbus", "system_bus_socket"), bus: true},
+	}
+
+	socks := make([]dbusSocket, 0, len(candidates))
+	for _, s := range candidates {
+		if _, err := os.Stat(s.path); err == nil {
+			socks = append(socks, s)
+		}
+	}
+
+	return socks
+}
+
+// connect to systemd, trying the private socket first (root only) then the system bus.
+func (c *Units) connect() (*dbus.Conn, error) {
+	var lastErr error
+	for _, s := range c.sockets() {
+		conn, err := c.dial(s)
+		if err != nil {
+			c.logger.Debug().Err(err).Str("socket", s.path).Msg("d-bus connect")
+			lastErr = err
+			continue
+		}
+		return conn, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errNoSocket
+	}
+
+	return nil, fmt.Errorf("%s connect: %w", c.pkgID, lastErr)
+}
+
+// dial and authenticate to a d-bus socket.
+func (c *Units) dial(s dbusSocket) (*dbus.Conn, error) {
+	conn, err := dbus.Dial("unix:path=" + s.path)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+
+	if s.bus {
+		if err := conn.Hello(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("hello: %w", err)
+		}
+	}
+
+	return conn, nil
+}
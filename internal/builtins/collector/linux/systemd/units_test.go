@@ -0,0 +1,418 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build linux
+// +build linux
+
+package systemd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	"github.com/godbus/dbus/v5"
+	"github.com/rs/zerolog"
+)
+
+// fakeSystemd is a minimal peer-to-peer d-bus service answering the
+// ListUnits and Properties.GetAll calls made by the units collector.
+type fakeSystemd struct {
+	listener net.Listener
+	units    []unitStatus
+	props    map[dbus.ObjectPath]map[string]dbus.Variant
+}
+
+func newFakeSystemd(t *testing.T, runPath string) *fakeSystemd {
+	t.Helper()
+
+	sockDir := filepath.Join(runPath, "systemd")
+	if err := os.MkdirAll(sockDir, 0o755); err != nil {
+		t.Fatalf("creating socket dir: %s", err)
+	}
+	l, err := net.Listen("unix", filepath.Join(sockDir, "private"))
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	f := &fakeSystemd{
+		listener: l,
+		units: []unitStatus{
+			{Name: "nginx.service", LoadState: "loaded", ActiveState: "active", SubState: "running", Path: "/org/freedesktop/systemd1/unit/nginx_2eservice"},
+			{Name: "cron.service", LoadState: "loaded", ActiveState: "active", SubState: "running", Path: "/org/freedesktop/systemd1/unit/cron_2eservice"},
+			{Name: "broken.service", LoadState: "loaded", ActiveState: "failed", SubState: "failed", Path: "/org/freedesktop/systemd1/unit/broken_2eservice"},
+			{Name: "old.mount", LoadState: "loaded", ActiveState: "failed", SubState: "failed", Path: "/org/freedesktop/systemd1/unit/old_2emount"},
+			{Name: "multi-user.target", LoadState: "loaded", ActiveState: "active", SubState: "active", Path: "/org/freedesktop/systemd1/unit/multi_2duser_2etarget"},
+		},
+		props: map[dbus.ObjectPath]map[string]dbus.Variant{
+			"/org/freedesktop/systemd1/unit/nginx_2eservice": {
+				"NRestarts":     dbus.MakeVariant(uint32(3)),
+				"MemoryCurrent": dbus.MakeVariant(uint64(10485760)),
+				"CPUUsageNSec":  dbus.MakeVariant(uint64(123456789)),
+			},
+			"/org/freedesktop/systemd1/unit/cron_2eservice": {
+				"NRestarts":     dbus.MakeVariant(uint32(0)),
+				"MemoryCurrent": dbus.MakeVariant(uint64(math.MaxUint64)),
+				"CPUUsageNSec":  dbus.MakeVariant(uint64(math.MaxUint64)),
+			},
+			"/org/freedesktop/systemd1/unit/broken_2eservice": {
+				"NRestarts": dbus.MakeVariant(uint32(5)),
+			},
+		},
+	}
+
+	// units without a queued job have a job path of "/"
+	for i := range f.units {
+		f.units[i].JobPath = "/"
+	}
+
+	go f.serve()
+
+	return f
+}
+
+func (f *fakeSystemd) Close() {
+	f.listener.Close()
+}
+
+func (f *fakeSystemd) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeSystemd) handle(conn net.Conn) {
+	defer conn.Close()
+
+	in := bufio.NewReader(conn)
+
+	// sasl: null byte, AUTH, AUTH EXTERNAL, [NEGOTIATE_UNIX_FD], BEGIN
+	if _, err := in.ReadByte(); err != nil {
+		return
+	}
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.Fields(line)
+		if len(cmd) == 0 {
+			return
+		}
+		switch {
+		case cmd[0] == "AUTH" && len(cmd) == 1:
+			_, err = conn.Write([]byte("REJECTED EXTERNAL\r\n"))
+		case cmd[0] == "AUTH":
+			_, err = conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+		case cmd[0] == "NEGOTIATE_UNIX_FD":
+			_, err = conn.Write([]byte("ERROR\r\n"))
+		case cmd[0] == "BEGIN":
+			f.messages(conn, in)
+			return
+		default:
+			_, err = conn.Write([]byte("ERROR\r\n"))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeSystemd) messages(conn net.Conn, in *bufio.Reader) {
+	for {
+		msg, err := dbus.DecodeMessage(in)
+		if err != nil {
+			return
+		}
+		if msg.Type != dbus.TypeMethodCall {
+			continue
+		}
+
+		path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+		iface, _ := msg.Headers[dbus.FieldInterface].Value().(string)
+		member, _ := msg.Headers[dbus.FieldMember].Value().(string)
+
+		var body []interface{}
+		errName := ""
+		switch iface + "." + member {
+		case dbusListUnits:
+			body = []interface{}{f.units}
+		case dbusGetAll:
+			props, ok := f.props[path]
+			if !ok {
+				errName = "org.freedesktop.DBus.Error.UnknownObject"
+				break
+			}
+			body = []interface{}{props}
+		default:
+			errName = "org.freedesktop.DBus.Error.UnknownMethod"
+		}
+
+		reply := &dbus.Message{
+			Type: dbus.TypeMethodReply,
+			Headers: map[dbus.HeaderField]dbus.Variant{
+				dbus.FieldReplySerial: dbus.MakeVariant(msg.Serial()),
+			},
+			Body: body,
+		}
+		if errName != "" {
+			reply.Type = dbus.TypeError
+			reply.Headers[dbus.FieldErrorName] = dbus.MakeVariant(errName)
+			reply.Body = []interface{}{"fake systemd: " + errName}
+		}
+		reply.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(reply.Body...))
+
+		if err := reply.EncodeTo(conn, binary.LittleEndian); err != nil {
+			return
+		}
+	}
+}
+
+func TestNewUnitsCollector(t *testing.T) {
+	t.Log("Testing NewUnitsCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	runPath := filepath.Join("testdata", "run")
+
+	t.Log("no config")
+	{
+		_, err := NewUnitsCollector("", runPath)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("no config (no socket)")
+	{
+		_, err := NewUnitsCollector("", filepath.Join("testdata", "missing"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (missing)")
+	{
+		_, err := NewUnitsCollector(filepath.Join("testdata", "missing"), runPath)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewUnitsCollector(filepath.Join("testdata", "bad_syntax"), runPath)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewUnitsCollector(filepath.Join("testdata", "config_id_setting"), "")
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Units).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+		if c.(*Units).runPath != runPath {
+			t.Fatalf("expected (%s) got (%s)", runPath, c.(*Units).runPath)
+		}
+	}
+
+	t.Log("config (run path setting invalid)")
+	{
+		_, err := NewUnitsCollector(filepath.Join("testdata", "config_run_path_invalid_setting"), runPath)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (include regex setting invalid)")
+	{
+		_, err := NewUnitsCollector(filepath.Join("testdata", "config_include_regex_invalid_setting"), runPath)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (exclude regex setting invalid)")
+	{
+		_, err := NewUnitsCollector(filepath.Join("testdata", "config_exclude_regex_invalid_setting"), runPath)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (timeout setting invalid)")
+	{
+		_, err := NewUnitsCollector(filepath.Join("testdata", "config_timeout_invalid_setting"), runPath)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl setting)")
+	{
+		c, err := NewUnitsCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"), runPath)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Units).runTTL.String() != "5m0s" {
+			t.Fatalf("expected 5m0s, got (%s)", c.(*Units).runTTL.String())
+		}
+	}
+
+	t.Log("config (run ttl setting invalid)")
+	{
+		_, err := NewUnitsCollector(filepath.Join("testdata", "config_run_ttl_invalid_setting"), runPath)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestUnitsFlush(t *testing.T) {
+	t.Log("Testing Flush")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	c, err := NewUnitsCollector("", filepath.Join("testdata", "run"))
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	metrics := c.Flush()
+	if metrics == nil {
+		t.Fatal("expected metrics")
+	}
+	if len(metrics) > 0 {
+		t.Fatalf("expected empty metrics, got %v", metrics)
+	}
+}
+
+func TestUnitsCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	runPath := t.TempDir()
+	srv := newFakeSystemd(t, runPath)
+	defer srv.Close()
+
+	c, err := NewUnitsCollector("", runPath)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	t.Log("default include (services)")
+	{
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if metrics == nil {
+			t.Fatal("expected error")
+		}
+
+		// nginx: 3 state + restarts, memory, cpu = 6
+		// cron: 3 state + restarts (accounting not enabled) = 4
+		// broken: 3 state + restarts = 4
+		// failed_units = 1
+		if len(metrics) != 15 {
+			t.Fatalf("expected 15 metrics, got %d", len(metrics))
+		}
+
+		baseTags := tags.Tags{
+			tags.Tag{Category: "source", Value: "circonus-agent"},
+			tags.Tag{Category: "collector", Value: NameUnits},
+		}
+
+		failedName := tags.MetricNameWithStreamTags("failed_units", baseTags)
+		m, ok := metrics[failedName]
+		if !ok {
+			t.Fatalf("expected failed_units metric (%s)", failedName)
+		}
+		if v := m.Value.(uint32); v != 2 {
+			t.Fatalf("expected 2 failed units, got %d", v)
+		}
+
+		unitTags := append(baseTags, tags.Tags{ //nolint:gocritic
+			tags.Tag{Category: "unit", Value: "nginx.service"},
+			tags.Tag{Category: "unit-type", Value: "service"},
+		}...)
+
+		restartsName := tags.MetricNameWithStreamTags("restarts", unitTags)
+		m, ok = metrics[restartsName]
+		if !ok {
+			t.Fatalf("expected restarts metric (%s)", restartsName)
+		}
+		if v := m.Value.(uint32); v != 3 {
+			t.Fatalf("expected 3 restarts, got %d", v)
+		}
+
+		subStateName := tags.MetricNameWithStreamTags("sub_state", unitTags)
+		m, ok = metrics[subStateName]
+		if !ok {
+			t.Fatalf("expected sub_state metric (%s)", subStateName)
+		}
+		if v := m.Value.(string); v != "running" {
+			t.Fatalf("expected running, got %s", v)
+		}
+	}
+
+	t.Log("include all, exclude targets")
+	{
+		c.(*Units).include = regexp.MustCompile(fmt.Sprintf(regexPat, ".+"))
+		c.(*Units).exclude = regexp.MustCompile(fmt.Sprintf(regexPat, `.+\.target`))
+
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+
+		// services (15) + old.mount 3 state (no properties available) = 18
+		metrics := c.Flush()
+		if len(metrics) != 18 {
+			t.Fatalf("expected 18 metrics, got %d", len(metrics))
+		}
+	}
+
+	t.Log("already running")
+	{
+		c.(*Units).running = true
+		err := c.Collect(context.Background())
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if err.Error() != collector.ErrAlreadyRunning.Error() {
+			t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+		}
+		c.(*Units).running = false
+	}
+
+	t.Log("no socket listening")
+	{
+		srv.Close()
+		if err := c.Collect(context.Background()); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultURLTimeout = 30 * time.Second
+
+var (
+	errInvalidCAFile     = fmt.Errorf("no certificates found in ca_file")
+	errInvalidClientCert = fmt.Errorf("cert_file and key_file must both be set")
+	errInvalidAuth       = fmt.Errorf("only one of bearer_token, bearer_token_file or username may be set")
+)
+
+// configure validates the URL options and creates the http client used to scrape it.
+func (u *URLDef) configure() error {
+	u.timeout = defaultURLTimeout
+	switch {
+	case u.Timeout != "":
+		dur, err := time.ParseDuration(u.Timeout)
+		if err != nil {
+			return fmt.Errorf("parsing timeout: %w", err)
+		}
+		u.timeout = dur
+	case u.TTL != "":
+		// before timeout was added, ttl was used as the request timeout
+		dur, err := time.ParseDuration(u.TTL)
+		if err != nil {
+			return fmt.Errorf("parsing ttl: %w", err)
+		}
+		u.timeout = dur
+	}
+
+	auths := 0
+	for _, v := range []string{u.BearerToken, u.BearerTokenFile, u.Username} {
+		if v != "" {
+			auths++
+		}
+	}
+	if auths > 1 {
+		return errInvalidAuth
+	}
+
+	if u.Exemplars != "" {
+		switch strings.ToLower(u.Exemplars) {
+		case "true", "yes", "on":
+			u.exemplars = true
+		case "false", "no", "off":
+			u.exemplars = false
+		default:
+			return fmt.Errorf("invalid exemplars setting (%s)", u.Exemplars) //nolint:goerr113
+		}
+	}
+
+	for i := range u.Relabel {
+		if err := u.Relabel[i].compile(); err != nil {
+			return fmt.Errorf("relabel rule %d: %w", i, err)
+		}
+	}
+
+	tlsConfig, err := u.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	u.client = &http.Client{
+		Transport: &http.Transport{
+			DisableCompression:  false,
+			DisableKeepAlives:   true,
+			MaxIdleConnsPerHost: 1,
+			TLSClientConfig:     tlsConfig,
+		},
+	}
+
+	return nil
+}
+
+// tlsConfig returns the tls config for the URL, nil if no tls options are set.
+func (u *URLDef) tlsConfig() (*tls.Config, error) {
+	if u.CAFile == "" && u.CertFile == "" && u.KeyFile == "" && u.InsecureSkipVerify == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if u.CAFile != "" {
+		cert, err := os.ReadFile(u.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %w", err)
+		}
+		cp := x509.NewCertPool()
+		if !cp.AppendCertsFromPEM(cert) {
+			return nil, fmt.Errorf("%s: %w", u.CAFile, errInvalidCAFile)
+		}
+		tlsConfig.RootCAs = cp
+	}
+
+	if u.CertFile != "" || u.KeyFile != "" {
+		if u.CertFile == "" || u.KeyFile == "" {
+			return nil, errInvalidClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(u.CertFile, u.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if u.InsecureSkipVerify != "" {
+		switch strings.ToLower(u.InsecureSkipVerify) {
+		case "true", "yes", "on":
+			tlsConfig.InsecureSkipVerify = true //nolint:gosec
+		case "false", "no", "off":
+			tlsConfig.InsecureSkipVerify = false
+		default:
+			return nil, fmt.Errorf("invalid insecure_skip_verify setting (%s)", u.InsecureSkipVerify) //nolint:goerr113
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// newRequest creates the scrape request with the configured headers and authentication.
+func (u *URLDef) newRequest(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("prepare request: %w", err)
+	}
+
+	req.Header.Set("Accept", scrapeAccept)
+	for k, v := range u.Headers {
+		req.Header.Set(k, v)
+	}
+
+	switch {
+	case u.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+u.BearerToken)
+	case u.BearerTokenFile != "":
+		// read on every request, tokens (e.g. service account tokens) are rotated
+		token, err := os.ReadFile(u.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read bearer_token_file: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	case u.Username != "":
+		req.SetBasicAuth(u.Username, u.Password)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,191 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestURLOptions(t *testing.T) {
+	t.Log("Testing URL options")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("valid")
+	{
+		c, err := New(filepath.Join("testdata", "config_url_options_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		urls := c.(*Prom).urls
+		if len(urls) != 3 {
+			t.Fatalf("expected 3 URLs, got %d", len(urls))
+		}
+		if urls[0].timeout != 5*time.Second {
+			t.Fatalf("expected 5s timeout, got %s", urls[0].timeout)
+		}
+		if urls[0].Headers["X-Scope-OrgID"] != "tenant1" {
+			t.Fatalf("expected header, got %#v", urls[0].Headers)
+		}
+		if urls[0].client == nil {
+			t.Fatal("expected client")
+		}
+		tr := urls[1].client.Transport.(*http.Transport)
+		if tr.TLSClientConfig == nil || !tr.TLSClientConfig.InsecureSkipVerify {
+			t.Fatal("expected insecure skip verify")
+		}
+		if urls[2].timeout != 15*time.Second {
+			t.Fatalf("expected 15s timeout from ttl, got %s", urls[2].timeout)
+		}
+	}
+
+	t.Log("invalid (all but one ignored)")
+	{
+		c, err := New(filepath.Join("testdata", "config_url_options_invalid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		urls := c.(*Prom).urls
+		if len(urls) != 1 || urls[0].ID != "ok" {
+			t.Fatalf("expected 1 URL (ok), got %#v", urls)
+		}
+	}
+
+	t.Log("multiple auth")
+	{
+		u := URLDef{URL: "http://localhost", BearerToken: "a", Username: "b"}
+		if err := u.configure(); !errors.Is(err, errInvalidAuth) {
+			t.Fatalf("expected (%s) got (%v)", errInvalidAuth, err)
+		}
+	}
+
+	t.Log("key without cert")
+	{
+		u := URLDef{URL: "http://localhost", KeyFile: "foo"}
+		if err := u.configure(); !errors.Is(err, errInvalidClientCert) {
+			t.Fatalf("expected (%s) got (%v)", errInvalidClientCert, err)
+		}
+	}
+}
+
+func TestCollectAuth(t *testing.T) {
+	t.Log("Testing Collect w/authentication and headers")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "foo" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); ok {
+			if user != "user" || pass != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		} else if r.Header.Get("Authorization") != "Bearer abc123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintln(w, "test 1234")
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("abc123\n"), 0o600); err != nil {
+		t.Fatalf("writing token file: %s", err)
+	}
+
+	tests := []struct {
+		url    URLDef
+		expect int
+	}{
+		{URLDef{ID: "token", BearerToken: "abc123"}, 1},
+		{URLDef{ID: "token_file", BearerTokenFile: tokenFile}, 1},
+		{URLDef{ID: "basic", Username: "user", Password: "pass"}, 1},
+		{URLDef{ID: "bad_token", BearerToken: "xyz"}, 0},
+		{URLDef{ID: "bad_basic", Username: "user", Password: "xyz"}, 0},
+		{URLDef{ID: "no_header", BearerToken: "abc123", Headers: map[string]string{}}, 0},
+	}
+
+	for _, tst := range tests {
+		t.Log(tst.url.ID)
+		u := tst.url
+		u.URL = ts.URL
+		if u.Headers == nil {
+			u.Headers = map[string]string{"X-Test": "foo"}
+		}
+		if err := u.configure(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		c := &Prom{urls: []URLDef{u}, metricNameRegex: regexp.MustCompile("[\r\n\"']")}
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if n := len(c.Flush()) - scrapeMetrics(tst.expect); n != tst.expect {
+			t.Fatalf("expected %d metrics, got %d", tst.expect, n)
+		}
+	}
+}
+
+func TestCollectTLS(t *testing.T) {
+	t.Log("Testing Collect w/TLS")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "test 1234")
+	}))
+	defer ts.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o600); err != nil {
+		t.Fatalf("writing ca file: %s", err)
+	}
+
+	tests := []struct {
+		url    URLDef
+		expect int
+	}{
+		{URLDef{ID: "no_ca"}, 0},
+		{URLDef{ID: "ca_file", CAFile: caFile}, 1},
+		{URLDef{ID: "insecure", InsecureSkipVerify: "true"}, 1},
+	}
+
+	for _, tst := range tests {
+		t.Log(tst.url.ID)
+		u := tst.url
+		u.URL = ts.URL
+		if err := u.configure(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		c := &Prom{urls: []URLDef{u}, metricNameRegex: regexp.MustCompile("[\r\n\"']")}
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if n := len(c.Flush()) - scrapeMetrics(tst.expect); n != tst.expect {
+			t.Fatalf("expected %d metrics, got %d", tst.expect, n)
+		}
+	}
+}
+
+// scrapeMetrics returns the number of scrape metrics expected for a single url
+// (up and scrape_duration, + last_success_timestamp if metrics were scraped).
+func scrapeMetrics(expect int) int {
+	if expect > 0 {
+		return 3
+	}
+	return 2
+}
@@ -16,14 +16,41 @@ import (
 	"github.com/rs/zerolog"
 )
 
-// Flush returns last metrics collected.
+// Flush returns last metrics collected. Histograms (samples since the
+// previous flush) are only returned once.
 func (c *Prom) Flush() cgm.Metrics {
 	c.Lock()
 	defer c.Unlock()
 	if c.lastMetrics == nil {
 		c.lastMetrics = cgm.Metrics{}
 	}
-	return c.lastMetrics
+	c.flushes++
+	metrics := c.lastMetrics
+	for _, mv := range metrics {
+		if mv.Type != histogramType {
+			continue
+		}
+		c.lastMetrics = make(cgm.Metrics, len(metrics))
+		for mn, mv := range metrics {
+			if mv.Type != histogramType {
+				c.lastMetrics[mn] = mv
+			}
+		}
+		break
+	}
+	return metrics
+}
+
+// Snapshot returns a copy of the last metrics collected, histograms are
+// returned again until flushed.
+func (c *Prom) Snapshot() cgm.Metrics {
+	c.Lock()
+	defer c.Unlock()
+	metrics := make(cgm.Metrics, len(c.lastMetrics))
+	for mn, mv := range c.lastMetrics {
+		metrics[mn] = mv
+	}
+	return metrics
 }
 
 // ID returns the id of the instance.
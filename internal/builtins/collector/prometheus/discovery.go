@@ -0,0 +1,229 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultFileSDID      = "file_sd"
+	defaultMetricsPath   = "/metrics"
+	defaultScheme        = "http"
+	labelMetaPrefix      = "__"               // target labels with this prefix are not used as stream tags
+	labelMetaScheme      = "__scheme__"       // target label overriding the scheme
+	labelMetaMetricsPath = "__metrics_path__" // target label overriding the metrics path
+	labelInstance        = "instance"         // label added to discovered targets (host:port)
+	fileSDMaxFileSize    = 10 * 1024 * 1024   // sanity limit for target files
+	fileSDExtensions     = ".json|.yaml|.yml" // supported target file extensions (for docs/errors)
+)
+
+var (
+	errFileSDNoFiles      = fmt.Errorf("file_sd 'files' is required")
+	errFileSDUnsupported  = fmt.Errorf("unsupported target file extension, expected " + fileSDExtensions)
+	errFileSDFileTooLarge = fmt.Errorf("target file too large")
+)
+
+// FileSDConfig defines a set of Prometheus file_sd compatible target files.
+type FileSDConfig struct {
+	mtimes      map[string]time.Time
+	ID          string   `json:"id" toml:"id" yaml:"id"`
+	Scheme      string   `json:"scheme" toml:"scheme" yaml:"scheme"`
+	MetricsPath string   `json:"metrics_path" toml:"metrics_path" yaml:"metrics_path"`
+	Files       []string `json:"files" toml:"files" yaml:"files"`
+	targets     []URLDef
+	Options     URLDef `json:"target_options" toml:"target_options" yaml:"target_options"`
+}
+
+// targetGroup is a group of targets in a file_sd target file.
+type targetGroup struct {
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+	Targets []string          `json:"targets" yaml:"targets"`
+}
+
+// init validates the file_sd configuration.
+func (sd *FileSDConfig) init() error {
+	if len(sd.Files) == 0 {
+		return errFileSDNoFiles
+	}
+	for _, pat := range sd.Files {
+		if _, err := filepath.Match(pat, ""); err != nil {
+			return fmt.Errorf("invalid file pattern (%s): %w", pat, err)
+		}
+	}
+	if sd.ID == "" {
+		sd.ID = defaultFileSDID
+	}
+	if sd.Scheme == "" {
+		sd.Scheme = defaultScheme
+	}
+	if sd.MetricsPath == "" {
+		sd.MetricsPath = defaultMetricsPath
+	}
+	// validate the options applied to targets
+	opts := sd.Options
+	opts.URL = sd.Scheme + "://localhost" + sd.MetricsPath
+	if err := opts.configure(); err != nil {
+		return fmt.Errorf("target_options: %w", err)
+	}
+	sd.mtimes = make(map[string]time.Time)
+	return nil
+}
+
+// refresh re-reads the target files if any were added, removed or modified
+// since the last refresh and returns the current targets.
+func (sd *FileSDConfig) refresh(logger zerolog.Logger) []URLDef {
+	mtimes := make(map[string]time.Time)
+	for _, pat := range sd.Files {
+		files, _ := filepath.Glob(pat) // pattern validated in init
+		for _, fn := range files {
+			fi, err := os.Stat(fn)
+			if err != nil || fi.IsDir() {
+				continue
+			}
+			mtimes[fn] = fi.ModTime()
+		}
+	}
+
+	changed := len(mtimes) != len(sd.mtimes)
+	if !changed {
+		for fn, mt := range mtimes {
+			if prev, ok := sd.mtimes[fn]; !ok || !prev.Equal(mt) {
+				changed = true
+				break
+			}
+		}
+	}
+	if !changed {
+		return sd.targets
+	}
+
+	files := make([]string, 0, len(mtimes))
+	for fn := range mtimes {
+		files = append(files, fn)
+	}
+	sort.Strings(files)
+
+	var targets []URLDef
+	for _, fn := range files {
+		groups, err := readTargetFile(fn)
+		if err != nil {
+			logger.Warn().Err(err).Str("file", fn).Msg("reading target file, ignoring")
+			continue
+		}
+		for _, tg := range groups {
+			for _, target := range tg.Targets {
+				u, err := sd.targetURL(target, tg.Labels)
+				if err != nil {
+					logger.Warn().Err(err).Str("file", fn).Str("target", target).Msg("invalid target, ignoring")
+					continue
+				}
+				targets = append(targets, u)
+			}
+		}
+	}
+
+	logger.Debug().Str("id", sd.ID).Int("files", len(files)).Int("targets", len(targets)).Msg("refreshed file_sd targets")
+
+	sd.mtimes = mtimes
+	sd.targets = targets
+	return targets
+}
+
+// targetURL creates the url definition for a target (host:port) from a target file.
+func (sd *FileSDConfig) targetURL(target string, labels map[string]string) (URLDef, error) {
+	scheme := sd.Scheme
+	metricsPath := sd.MetricsPath
+	tlabels := map[string]string{labelInstance: target}
+	for k, v := range sd.Options.Labels {
+		tlabels[k] = v
+	}
+	for k, v := range labels {
+		switch {
+		case k == labelMetaScheme:
+			scheme = v
+		case k == labelMetaMetricsPath:
+			metricsPath = v
+		case strings.HasPrefix(k, labelMetaPrefix):
+			// other meta labels are not used
+		default:
+			tlabels[k] = v
+		}
+	}
+
+	return newTargetURL(sd.ID, sd.Options, scheme, target, metricsPath, tlabels)
+}
+
+// newTargetURL creates and configures a url definition for a discovered target.
+func newTargetURL(id string, opts URLDef, scheme, target, metricsPath string, labels map[string]string) (URLDef, error) {
+	if target == "" {
+		return URLDef{}, fmt.Errorf("empty target") //nolint:goerr113
+	}
+	tu := url.URL{Scheme: scheme, Host: target, Path: metricsPath}
+	if _, err := url.Parse(tu.String()); err != nil {
+		return URLDef{}, fmt.Errorf("target url: %w", err)
+	}
+
+	u := opts
+	u.ID = id
+	u.URL = tu.String()
+	u.Labels = labels
+	if u.TTL != "" {
+		if ttl, err := time.ParseDuration(u.TTL); err == nil {
+			u.uttl = ttl
+		}
+	}
+	if u.uttl == time.Duration(0) {
+		u.uttl = 30 * time.Second
+	}
+	if err := u.configure(); err != nil {
+		return URLDef{}, err
+	}
+
+	return u, nil
+}
+
+// readTargetFile reads a file_sd target file (json or yaml).
+func readTargetFile(fn string) ([]targetGroup, error) {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return nil, fmt.Errorf("stat: %w", err)
+	}
+	if fi.Size() > fileSDMaxFileSize {
+		return nil, errFileSDFileTooLarge
+	}
+
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	var groups []targetGroup
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".json":
+		if err := json.Unmarshal(data, &groups); err != nil {
+			return nil, fmt.Errorf("parse: %w", err)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &groups); err != nil {
+			return nil, fmt.Errorf("parse: %w", err)
+		}
+	default:
+		return nil, errFileSDUnsupported
+	}
+
+	return groups, nil
+}
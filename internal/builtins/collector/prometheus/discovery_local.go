@@ -0,0 +1,308 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultLocalID            = "local"
+	defaultLocalInterval      = 5 * time.Minute
+	defaultLocalProbeTimeout  = 2 * time.Second
+	localProbeConcurrency     = 10
+	tcpStateListen            = "0A"
+	localProbeMaxResponseSize = 64 * 1024 * 1024
+)
+
+var errLocalNoPorts = fmt.Errorf("include_ports is required, or probe_all to probe every listening port")
+
+// LocalDiscoveryConfig defines discovery of local exporters by probing the
+// metrics path on listening tcp ports (from procfs).
+type LocalDiscoveryConfig struct {
+	lastScan     time.Time
+	exclude      map[uint16]bool
+	include      map[uint16]bool
+	Labels       map[string]string `json:"labels" toml:"labels" yaml:"labels"`
+	procFSPath   string
+	ID           string   `json:"id" toml:"id" yaml:"id"`
+	MetricsPath  string   `json:"metrics_path" toml:"metrics_path" yaml:"metrics_path"`
+	Interval     string   `json:"interval" toml:"interval" yaml:"interval"`
+	ProbeTimeout string   `json:"probe_timeout" toml:"probe_timeout" yaml:"probe_timeout"`
+	IncludePorts []uint16 `json:"include_ports" toml:"include_ports" yaml:"include_ports"`
+	ExcludePorts []uint16 `json:"exclude_ports" toml:"exclude_ports" yaml:"exclude_ports"`
+	targets      []URLDef
+	Options      URLDef `json:"target_options" toml:"target_options" yaml:"target_options"`
+	interval     time.Duration
+	probeTimeout time.Duration
+	ProbeAll     bool `json:"probe_all" toml:"probe_all" yaml:"probe_all"`
+	sameNetNS    bool // agent is in the network namespace the ports are read from
+}
+
+// listenAddr is a local tcp listening address.
+type listenAddr struct {
+	ip   net.IP
+	port uint16
+}
+
+// init validates the local discovery configuration.
+func (ld *LocalDiscoveryConfig) init() error {
+	if ld.ID == "" {
+		ld.ID = defaultLocalID
+	}
+	if ld.MetricsPath == "" {
+		ld.MetricsPath = defaultMetricsPath
+	}
+
+	ld.interval = defaultLocalInterval
+	if ld.Interval != "" {
+		dur, err := time.ParseDuration(ld.Interval)
+		if err != nil {
+			return fmt.Errorf("parsing interval: %w", err)
+		}
+		ld.interval = dur
+	}
+
+	ld.probeTimeout = defaultLocalProbeTimeout
+	if ld.ProbeTimeout != "" {
+		dur, err := time.ParseDuration(ld.ProbeTimeout)
+		if err != nil {
+			return fmt.Errorf("parsing probe_timeout: %w", err)
+		}
+		ld.probeTimeout = dur
+	}
+
+	if len(ld.IncludePorts) == 0 && !ld.ProbeAll {
+		return errLocalNoPorts
+	}
+
+	ld.include = make(map[uint16]bool)
+	for _, p := range ld.IncludePorts {
+		ld.include[p] = true
+	}
+	// do not discover the agent itself
+	ld.exclude = map[uint16]bool{defaults.ListenPort: true}
+	for _, p := range ld.ExcludePorts {
+		ld.exclude[p] = true
+	}
+
+	opts := ld.Options
+	opts.URL = defaultScheme + "://localhost" + ld.MetricsPath
+	if err := opts.configure(); err != nil {
+		return fmt.Errorf("target_options: %w", err)
+	}
+
+	// in host mode, the host's network namespace is pid 1's
+	ld.procFSPath = viper.GetString(config.KeyHostProc)
+	if ld.procFSPath == "" || filepath.Clean(ld.procFSPath) == defaults.HostProc {
+		ld.procFSPath = defaults.HostProc
+		ld.sameNetNS = true
+	} else {
+		ld.procFSPath = filepath.Join(ld.procFSPath, "1")
+		ld.sameNetNS = sameNetNS(ld.procFSPath)
+	}
+
+	return nil
+}
+
+// refresh scans local listening ports and probes them for metrics, no more
+// frequently than the interval, and returns the current targets.
+func (ld *LocalDiscoveryConfig) refresh(ctx context.Context, logger zerolog.Logger) []URLDef {
+	if !ld.lastScan.IsZero() && time.Since(ld.lastScan) < ld.interval {
+		return ld.targets
+	}
+	ld.lastScan = time.Now()
+
+	var addrs []listenAddr
+	for _, fn := range []string{"tcp", "tcp6"} {
+		la, err := readListenAddrs(filepath.Join(ld.procFSPath, "net", fn))
+		if err != nil {
+			logger.Debug().Err(err).Str("file", fn).Msg("reading listening ports")
+			continue
+		}
+		addrs = append(addrs, la...)
+	}
+
+	candidates := make(map[string]bool)
+	unreachable := 0
+	for _, a := range addrs {
+		if ld.exclude[a.port] || (len(ld.include) > 0 && !ld.include[a.port]) {
+			continue
+		}
+		// loopback and wildcard listeners in another network namespace (e.g.
+		// the host's, from a container) cannot be reached on loopback
+		if !ld.sameNetNS && (a.ip.IsLoopback() || a.ip.IsUnspecified()) {
+			unreachable++
+			continue
+		}
+		candidates[net.JoinHostPort(probeHost(a.ip), strconv.Itoa(int(a.port)))] = true
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	found := make([]string, 0, len(candidates))
+	sem := make(chan struct{}, localProbeConcurrency)
+	for target := range candidates {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if ld.probe(ctx, target) {
+				mu.Lock()
+				found = append(found, target)
+				mu.Unlock()
+			}
+		}(target)
+	}
+	wg.Wait()
+	sort.Strings(found)
+
+	targets := make([]URLDef, 0, len(found))
+	for _, target := range found {
+		labels := map[string]string{labelInstance: target}
+		for k, v := range ld.Options.Labels {
+			labels[k] = v
+		}
+		for k, v := range ld.Labels {
+			labels[k] = v
+		}
+		u, err := newTargetURL(ld.ID, ld.Options, defaultScheme, target, ld.MetricsPath, labels)
+		if err != nil {
+			logger.Warn().Err(err).Str("target", target).Msg("invalid target, ignoring")
+			continue
+		}
+		targets = append(targets, u)
+	}
+
+	logger.Debug().Str("id", ld.ID).Int("ports", len(candidates)).Int("unreachable", unreachable).Int("targets", len(targets)).Msg("refreshed local targets")
+
+	ld.targets = targets
+	return targets
+}
+
+// probe returns true if the target responds to the metrics path with prometheus metrics.
+func (ld *LocalDiscoveryConfig) probe(pctx context.Context, target string) bool {
+	ctx, cancel := context.WithTimeout(pctx, ld.probeTimeout)
+	defer cancel()
+
+	u := ld.Options
+	u.URL = defaultScheme + "://" + target + ld.MetricsPath
+	if err := u.configure(); err != nil {
+		return false
+	}
+	req, err := u.newRequest(ctx)
+	if err != nil {
+		return false
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+
+	mfs, _, err := decodeMetricFamilies(io.LimitReader(resp.Body, localProbeMaxResponseSize), responseFormat(resp.Header))
+	return err == nil && len(mfs) > 0
+}
+
+// sameNetNS returns true if the process at pidPath (e.g. /host/proc/1) is in
+// the agent's network namespace. False if either namespace cannot be read.
+func sameNetNS(pidPath string) bool {
+	self, err := os.Readlink(filepath.Join(defaults.HostProc, "self", "ns", "net"))
+	if err != nil {
+		return false
+	}
+	other, err := os.Readlink(filepath.Join(pidPath, "ns", "net"))
+	if err != nil {
+		return false
+	}
+	return self == other
+}
+
+// probeHost returns the host to probe for a listening address, wildcard
+// addresses are probed on loopback.
+func probeHost(ip net.IP) string {
+	if ip.IsUnspecified() {
+		return "127.0.0.1"
+	}
+	return ip.String()
+}
+
+// readListenAddrs returns the listening addresses from a procfs net/tcp or net/tcp6 file.
+//
+//	sl  local_address rem_address   st tx_queue rx_queue ...
+//	 0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 ...
+func readListenAddrs(fn string) ([]listenAddr, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	var addrs []listenAddr
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != tcpStateListen {
+			continue
+		}
+		a, err := parseProcNetAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, a)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	return addrs, nil
+}
+
+// parseProcNetAddr parses a procfs net address (hex ip in host byte order, per 32 bit word, and hex port).
+func parseProcNetAddr(s string) (listenAddr, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return listenAddr{}, fmt.Errorf("invalid address (%s)", s) //nolint:goerr113
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return listenAddr{}, fmt.Errorf("invalid port (%s): %w", s, err)
+	}
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return listenAddr{}, fmt.Errorf("invalid ip (%s)", s) //nolint:goerr113
+	}
+	// each 32 bit word is in host (little endian) byte order
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	return listenAddr{ip: ip, port: uint16(port)}, nil
+}
@@ -0,0 +1,287 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestFileSD(t *testing.T) {
+	t.Log("Testing file_sd")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("invalid (no files)")
+	{
+		_, err := New(filepath.Join("testdata", "config_file_sd_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("valid")
+	{
+		c, err := New(filepath.Join("testdata", "config_file_sd_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		p := c.(*Prom)
+		if len(p.fileSD) != 1 {
+			t.Fatalf("expected 1 file_sd, got %d", len(p.fileSD))
+		}
+		targets := p.targets(context.Background())
+		if len(targets) != 3 {
+			t.Fatalf("expected 3 targets, got %d", len(targets))
+		}
+		expect := map[string]map[string]string{
+			"http://localhost:9100/node/metrics": {"instance": "localhost:9100", "job": "node", "env": "test"},
+			"http://localhost:9101/node/metrics": {"instance": "localhost:9101", "job": "node", "env": "test"},
+			"https://localhost:9200/metrics":     {"instance": "localhost:9200", "job": "app", "env": "test"},
+		}
+		for _, u := range targets {
+			labels, ok := expect[u.URL]
+			if !ok {
+				t.Fatalf("unexpected target %s", u.URL)
+			}
+			if fmt.Sprint(labels) != fmt.Sprint(u.Labels) {
+				t.Fatalf("%s expected labels %v got %v", u.URL, labels, u.Labels)
+			}
+			if u.ID != "targets" || u.uttl != 10*time.Second || u.client == nil {
+				t.Fatalf("unexpected target settings %#v", u)
+			}
+		}
+	}
+}
+
+func TestFileSDRefresh(t *testing.T) {
+	t.Log("Testing file_sd refresh on change")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "targets.json")
+	write := func(data string, mtime time.Time) {
+		if err := os.WriteFile(fn, []byte(data), 0o600); err != nil {
+			t.Fatalf("writing target file: %s", err)
+		}
+		if err := os.Chtimes(fn, mtime, mtime); err != nil {
+			t.Fatalf("setting mtime: %s", err)
+		}
+	}
+
+	sd := FileSDConfig{Files: []string{filepath.Join(dir, "*.json")}}
+	if err := sd.init(); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	t.Log("no files")
+	if n := len(sd.refresh(log.Logger)); n != 0 {
+		t.Fatalf("expected 0 targets, got %d", n)
+	}
+
+	t.Log("new file")
+	write(`[{"targets":["a:1"]}]`, time.Now().Add(-time.Hour))
+	if n := len(sd.refresh(log.Logger)); n != 1 {
+		t.Fatalf("expected 1 target, got %d", n)
+	}
+
+	t.Log("modified file")
+	write(`[{"targets":["a:1","b:2"]}]`, time.Now())
+	if n := len(sd.refresh(log.Logger)); n != 2 {
+		t.Fatalf("expected 2 targets, got %d", n)
+	}
+
+	t.Log("unchanged (cached)")
+	sd.targets = sd.targets[:1]
+	if n := len(sd.refresh(log.Logger)); n != 1 {
+		t.Fatalf("expected cached targets (1), got %d", n)
+	}
+
+	t.Log("removed file")
+	if err := os.Remove(fn); err != nil {
+		t.Fatalf("removing target file: %s", err)
+	}
+	if n := len(sd.refresh(log.Logger)); n != 0 {
+		t.Fatalf("expected 0 targets, got %d", n)
+	}
+}
+
+func TestReadTargetFile(t *testing.T) {
+	t.Log("Testing readTargetFile")
+
+	t.Log("unsupported")
+	{
+		if _, err := readTargetFile(filepath.Join("testdata", "file_sd", "targets.txt")); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("yaml")
+	{
+		groups, err := readTargetFile(filepath.Join("testdata", "file_sd", "targets.yaml"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(groups) != 1 || len(groups[0].Targets) != 1 || groups[0].Labels["job"] != "app" {
+			t.Fatalf("unexpected groups %#v", groups)
+		}
+	}
+}
+
+func TestReadListenAddrs(t *testing.T) {
+	t.Log("Testing readListenAddrs")
+
+	t.Log("tcp")
+	{
+		addrs, err := readListenAddrs(filepath.Join("testdata", "proc", "net", "tcp"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(addrs) != 2 {
+			t.Fatalf("expected 2 listening addrs, got %#v", addrs)
+		}
+		if addrs[0].ip.String() != "127.0.0.1" || addrs[0].port != 8080 {
+			t.Fatalf("expected 127.0.0.1:8080, got %s:%d", addrs[0].ip, addrs[0].port)
+		}
+		if probeHost(addrs[1].ip) != "127.0.0.1" || addrs[1].port != 2609 {
+			t.Fatalf("expected 127.0.0.1:2609, got %s:%d", probeHost(addrs[1].ip), addrs[1].port)
+		}
+	}
+
+	t.Log("tcp6")
+	{
+		addrs, err := readListenAddrs(filepath.Join("testdata", "proc", "net", "tcp6"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(addrs) != 1 || addrs[0].ip.String() != "::1" || addrs[0].port != 9090 {
+			t.Fatalf("expected [::1]:9090, got %#v", addrs)
+		}
+	}
+
+	t.Log("missing")
+	{
+		if _, err := readListenAddrs(filepath.Join("testdata", "proc", "net", "missing")); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestLocalDiscovery(t *testing.T) {
+	t.Log("Testing local discovery")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("invalid config")
+	{
+		_, err := New(filepath.Join("testdata", "config_local_discovery_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("valid config")
+	{
+		c, err := New(filepath.Join("testdata", "config_local_discovery_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		ld := c.(*Prom).localSD
+		if ld == nil || ld.interval != time.Minute || ld.probeTimeout != time.Second {
+			t.Fatalf("unexpected local discovery settings %#v", ld)
+		}
+		if !ld.include[9100] || !ld.exclude[9200] || !ld.exclude[2609] {
+			t.Fatalf("unexpected include/exclude %v %v", ld.include, ld.exclude)
+		}
+	}
+
+	exporter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintln(w, "test 1234")
+	}))
+	defer exporter.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "<html>not metrics</html>")
+	}))
+	defer other.Close()
+
+	// fake procfs net/tcp with both servers listening
+	procDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procDir, "net"), 0o750); err != nil {
+		t.Fatalf("mkdir: %s", err)
+	}
+	tcp := "  sl  local_address rem_address   st\n"
+	for i, s := range []*httptest.Server{exporter, other} {
+		_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+		p, _ := strconv.Atoi(port)
+		tcp += fmt.Sprintf("   %d: 0100007F:%04X 00000000:0000 0A\n", i, p)
+	}
+	if err := os.WriteFile(filepath.Join(procDir, "net", "tcp"), []byte(tcp), 0o600); err != nil {
+		t.Fatalf("writing tcp: %s", err)
+	}
+
+	t.Log("no include_ports or probe_all")
+	{
+		ld := LocalDiscoveryConfig{}
+		if err := ld.init(); !errors.Is(err, errLocalNoPorts) {
+			t.Fatalf("expected (%s) got (%v)", errLocalNoPorts, err)
+		}
+	}
+
+	t.Log("other network namespace, loopback not probed")
+	{
+		ld := LocalDiscoveryConfig{ProbeAll: true}
+		if err := ld.init(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		ld.procFSPath = procDir
+		ld.sameNetNS = false
+		if targets := ld.refresh(context.Background(), log.Logger); len(targets) != 0 {
+			t.Fatalf("expected no targets, got %#v", targets)
+		}
+	}
+
+	ld := LocalDiscoveryConfig{Labels: map[string]string{"env": "test"}, ProbeAll: true}
+	if err := ld.init(); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	ld.procFSPath = procDir
+
+	targets := ld.refresh(context.Background(), log.Logger)
+	if len(targets) != 1 {
+		t.Fatalf("expected 1 target, got %#v", targets)
+	}
+	instance := exporter.Listener.Addr().String()
+	if targets[0].URL != "http://"+instance+"/metrics" {
+		t.Fatalf("unexpected target url %s", targets[0].URL)
+	}
+	if targets[0].Labels["instance"] != instance || targets[0].Labels["env"] != "test" || targets[0].ID != "local" {
+		t.Fatalf("unexpected target %#v", targets[0])
+	}
+
+	c := newTestProm()
+	c.localSD = &ld
+	if err := c.Collect(context.Background()); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	// test + up, scrape_duration, last_success_timestamp
+	if n := len(c.Flush()); n != 4 {
+		t.Fatalf("expected 4 metrics, got %d", n)
+	}
+}
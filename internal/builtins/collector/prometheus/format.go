@@ -0,0 +1,95 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// scrapeAccept is the Accept header sent with scrape requests, preferring
+// delimited protobuf (least parsing overhead), then OpenMetrics, then the
+// text format. A custom Accept header in the URL's headers overrides it.
+const scrapeAccept = "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.6," +
+	"application/openmetrics-text;version=1.0.0;q=0.5," +
+	"application/openmetrics-text;version=0.0.1;q=0.4," +
+	"text/plain;version=0.0.4;q=0.3," +
+	"*/*;q=0.1"
+
+const (
+	formatText        = "text"
+	formatProtobuf    = "protobuf"
+	formatOpenMetrics = "openmetrics"
+)
+
+// responseFormat returns the exposition format of a response based on its
+// content type, the text format is assumed if it is missing or unknown.
+func responseFormat(h http.Header) string {
+	mediatype, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return formatText
+	}
+	switch mediatype {
+	case expfmt.ProtoType:
+		if p, ok := params["proto"]; ok && p != expfmt.ProtoProtocol {
+			return formatText
+		}
+		if e, ok := params["encoding"]; ok && e != "delimited" {
+			return formatText
+		}
+		return formatProtobuf
+	case expfmt.OpenMetricsType:
+		return formatOpenMetrics
+	}
+	return formatText
+}
+
+// decodeMetricFamilies decodes the metric families in a response body in the
+// given format. For OpenMetrics, the units (by metric family) are also returned.
+func decodeMetricFamilies(data io.Reader, format string) (map[string]*dto.MetricFamily, map[string]string, error) {
+	switch format {
+	case formatProtobuf:
+		// the decoder only reuses the reader (keeping buffered data between
+		// metric families) if it is already a bufio.Reader
+		dec := expfmt.NewDecoder(bufio.NewReader(data), expfmt.FmtProtoDelim)
+		families := make(map[string]*dto.MetricFamily)
+		for {
+			mf := &dto.MetricFamily{}
+			if err := dec.Decode(mf); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, nil, fmt.Errorf("decode protobuf: %w", err)
+			}
+			if prev, ok := families[mf.GetName()]; ok {
+				prev.Metric = append(prev.Metric, mf.GetMetric()...)
+				continue
+			}
+			families[mf.GetName()] = mf
+		}
+		return families, nil, nil
+	case formatOpenMetrics:
+		families, units, err := parseOpenMetrics(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse openmetrics: %w", err)
+		}
+		return families, units, nil
+	default:
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse text: %w", err)
+		}
+		return families, nil, nil
+	}
+}
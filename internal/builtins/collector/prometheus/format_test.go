@@ -0,0 +1,211 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestResponseFormat(t *testing.T) {
+	t.Log("Testing responseFormat")
+
+	tests := []struct {
+		contentType string
+		expect      string
+	}{
+		{"", formatText},
+		{"text/plain; version=0.0.4; charset=utf-8", formatText},
+		{"text/html", formatText},
+		{"application/openmetrics-text; version=1.0.0; charset=utf-8", formatOpenMetrics},
+		{"application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited", formatProtobuf},
+		{"application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=text", formatText},
+		{"application/vnd.google.protobuf; proto=foo.Bar; encoding=delimited", formatText},
+	}
+
+	for _, tst := range tests {
+		t.Logf("content type (%s)", tst.contentType)
+		h := http.Header{}
+		h.Set("Content-Type", tst.contentType)
+		if f := responseFormat(h); f != tst.expect {
+			t.Fatalf("expected %s got %s", tst.expect, f)
+		}
+	}
+}
+
+func encodeProtobuf(t *testing.T, families ...*dto.MetricFamily) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtProtoDelim)
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			t.Fatalf("encode: %s", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeMetricFamiliesProtobuf(t *testing.T) {
+	t.Log("Testing decodeMetricFamilies protobuf")
+
+	data := encodeProtobuf(t,
+		&dto.MetricFamily{
+			Name:   proto.String("foo_total"),
+			Type:   dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{Counter: &dto.Counter{Value: proto.Float64(3)}}},
+		},
+		&dto.MetricFamily{
+			Name:   proto.String("bar"),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(1.5)}}},
+		},
+	)
+
+	families, units, err := decodeMetricFamilies(bytes.NewReader(data), formatProtobuf)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	if len(families) != 2 || units != nil {
+		t.Fatalf("unexpected result %v %v", families, units)
+	}
+	if v := families["foo_total"].GetMetric()[0].GetCounter().GetValue(); v != 3 {
+		t.Fatalf("expected 3 got %v", v)
+	}
+
+	t.Log("invalid")
+	{
+		if _, _, err := decodeMetricFamilies(bytes.NewReader([]byte{0x05, 0x01}), formatProtobuf); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestCollectFormats(t *testing.T) {
+	t.Log("Testing Collect format negotiation")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	omData, err := os.ReadFile(filepath.Join("testdata", "formats", "openmetrics.txt"))
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	pbData := encodeProtobuf(t, &dto.MetricFamily{
+		Name:   proto.String("foo_total"),
+		Type:   dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{{Counter: &dto.Counter{Value: proto.Float64(3)}}},
+	})
+
+	var accept string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		switch r.URL.Path {
+		case "/om":
+			w.Header().Set("Content-Type", string(expfmt.FmtOpenMetrics_1_0_0))
+			_, _ = w.Write(omData)
+		case "/pb":
+			w.Header().Set("Content-Type", string(expfmt.FmtProtoDelim))
+			_, _ = w.Write(pbData)
+		}
+	}))
+	defer ts.Close()
+
+	baseTags := cgm.Tags{
+		cgm.Tag{Category: "collector", Value: "promfetch"},
+		cgm.Tag{Category: "prom_id", Value: "foo"},
+		cgm.Tag{Category: "source", Value: "circonus-agent"},
+	}
+
+	t.Log("protobuf")
+	{
+		c := newTestProm(URLDef{ID: "foo", URL: ts.URL + "/pb", uttl: time.Nanosecond, timeout: time.Second})
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !strings.HasPrefix(accept, expfmt.ProtoType) {
+			t.Fatalf("expected protobuf preferred in accept (%s)", accept)
+		}
+		m := c.Flush()
+		mn := tags.MetricNameWithStreamTags("foo_total", baseTags)
+		if _, ok := m[mn]; !ok {
+			t.Fatalf("expected %s in %v", mn, m)
+		}
+	}
+
+	t.Log("openmetrics")
+	{
+		c := newTestProm(URLDef{ID: "foo", URL: ts.URL + "/om", uttl: time.Nanosecond, timeout: time.Second})
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		m := c.Flush()
+
+		expect := []string{
+			tags.MetricNameWithStreamTags("temperature", append(cgm.Tags{
+				cgm.Tag{Category: "room", Value: "kitchen"},
+				cgm.Tag{Category: "units", Value: "celsius"},
+			}, baseTags...)),
+			tags.MetricNameWithStreamTags("request_latency_seconds_created", append(cgm.Tags{
+				cgm.Tag{Category: "units", Value: "seconds"},
+			}, baseTags...)),
+			tags.MetricNameWithStreamTags("request_latency_seconds_count", baseTags),
+			tags.MetricNameWithStreamTags("build_info", append(cgm.Tags{
+				cgm.Tag{Category: "version", Value: "1.2.3"},
+			}, baseTags...)),
+		}
+		for _, mn := range expect {
+			if _, ok := m[mn]; !ok {
+				t.Fatalf("expected %s in %v", mn, m)
+			}
+		}
+		for mn, mv := range m {
+			if strings.HasPrefix(mn, "http_requests_created") {
+				if mv.Value.(uint64) != 1700000000 {
+					t.Fatalf("unexpected created value %v", mv.Value)
+				}
+				return
+			}
+		}
+		t.Fatal("expected http_requests_created")
+	}
+}
+
+func TestNewRequestAccept(t *testing.T) {
+	t.Log("Testing newRequest accept header")
+
+	u := URLDef{URL: "http://localhost/metrics"}
+	req, err := u.newRequest(context.Background())
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	if req.Header.Get("Accept") != scrapeAccept {
+		t.Fatalf("unexpected accept (%s)", req.Header.Get("Accept"))
+	}
+
+	t.Log("override with headers")
+	{
+		u.Headers = map[string]string{"accept": "text/plain"}
+		req, err := u.newRequest(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if req.Header.Get("Accept") != "text/plain" {
+			t.Fatalf("unexpected accept (%s)", req.Header.Get("Accept"))
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/openhistogram/circonusllhist"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// histogramType is the circonus metric type of converted histograms.
+const histogramType = "h"
+
+// histBins are histogram samples as representative value -> count. Prometheus
+// histogram counts are cumulative (since the exporter started), the samples
+// recorded in a scrape interval are the difference from the previous scrape.
+type histBins map[float64]uint64
+
+// isNativeHistogram returns true for native (sparse, exponential bucket) histograms.
+func isNativeHistogram(h *dto.Histogram) bool {
+	return len(h.GetPositiveSpan()) > 0 || len(h.GetNegativeSpan()) > 0 || h.GetZeroThreshold() > 0
+}
+
+// getHistBins returns the bins for a classic or native histogram.
+func getHistBins(h *dto.Histogram) histBins {
+	if isNativeHistogram(h) {
+		return nativeBins(h)
+	}
+	return classicBins(h)
+}
+
+// classicBins converts classic histogram buckets (cumulative counts per upper
+// bound, same as getBuckets) to bins. Samples are placed at the midpoint of
+// the bucket, samples in the +Inf bucket at the largest finite bound.
+func classicBins(h *dto.Histogram) histBins {
+	buckets := h.GetBucket()
+	sorted := make([]*dto.Bucket, 0, len(buckets))
+	sorted = append(sorted, buckets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GetUpperBound() < sorted[j].GetUpperBound() })
+
+	bins := make(histBins)
+	if len(sorted) == 0 {
+		return bins
+	}
+
+	lower := math.Min(0, sorted[0].GetUpperBound())
+	prevCount := uint64(0)
+	for _, b := range sorted {
+		cum := b.GetCumulativeCount()
+		if cum == 0 && b.GetCumulativeCountFloat() > 0 {
+			cum = uint64(b.GetCumulativeCountFloat())
+		}
+		upper := b.GetUpperBound()
+		if cum > prevCount {
+			v := lower
+			if !math.IsInf(upper, +1) {
+				v = (lower + upper) / 2
+			}
+			bins[v] += cum - prevCount
+			prevCount = cum
+		}
+		if !math.IsInf(upper, +1) {
+			lower = upper
+		}
+	}
+
+	return bins
+}
+
+// nativeBins converts native histogram spans (exponential buckets) to bins.
+// Samples are placed at the midpoint of the bucket.
+func nativeBins(h *dto.Histogram) histBins {
+	bins := make(histBins)
+
+	zero := h.GetZeroCount()
+	if zero == 0 && h.GetZeroCountFloat() > 0 {
+		zero = uint64(h.GetZeroCountFloat())
+	}
+	if zero > 0 {
+		bins[0] += zero
+	}
+
+	addNativeSpans(bins, h.GetSchema(), h.GetPositiveSpan(), h.GetPositiveDelta(), h.GetPositiveCount(), 1)
+	addNativeSpans(bins, h.GetSchema(), h.GetNegativeSpan(), h.GetNegativeDelta(), h.GetNegativeCount(), -1)
+
+	return bins
+}
+
+// addNativeSpans adds the buckets described by spans. Counts are either delta
+// encoded (integer histograms) or absolute (float histograms). Bucket i has
+// the upper bound 2^(i * 2^-schema).
+func addNativeSpans(bins histBins, schema int32, spans []*dto.BucketSpan, deltas []int64, counts []float64, sign float64) {
+	factor := math.Exp2(-float64(schema))
+	idx := int32(0)
+	pos := 0
+	cur := int64(0)
+	for _, span := range spans {
+		idx += span.GetOffset()
+		for i := uint32(0); i < span.GetLength(); i++ {
+			var n uint64
+			switch {
+			case pos < len(deltas):
+				cur += deltas[pos]
+				if cur > 0 {
+					n = uint64(cur)
+				}
+			case pos < len(counts):
+				if counts[pos] > 0 {
+					n = uint64(counts[pos])
+				}
+			}
+			pos++
+			if n > 0 {
+				upper := math.Exp2(float64(idx) * factor)
+				lower := math.Exp2(float64(idx-1) * factor)
+				bins[sign*(lower+upper)/2] += n
+			}
+			idx++
+		}
+	}
+}
+
+// deltaBins returns the samples recorded since the previous (cumulative) bins.
+// If any count decreased the exporter was restarted (counter reset) and the
+// current bins are used.
+func deltaBins(cur, prev histBins) histBins {
+	delta := make(histBins, len(cur))
+	for v, n := range cur {
+		p := prev[v]
+		if n < p {
+			return cur
+		}
+		if n > p {
+			delta[v] = n - p
+		}
+	}
+	for v := range prev {
+		if _, ok := cur[v]; !ok {
+			return cur
+		}
+	}
+	return delta
+}
+
+// histValue returns the bins as a serialized (base64) circonus log linear histogram.
+func histValue(bins histBins) (string, error) {
+	h := circonusllhist.New(circonusllhist.NoLocks())
+	for v, n := range bins {
+		if n == 0 {
+			continue
+		}
+		if err := h.RecordValues(v, int64(n)); err != nil {
+			return "", fmt.Errorf("record %v: %w", v, err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := h.SerializeB64(&buf); err != nil {
+		return "", fmt.Errorf("serialize: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// histExemplars returns the (per bucket) exemplars for a histogram.
+func histExemplars(h *dto.Histogram) []*dto.Exemplar {
+	exemplars := []*dto.Exemplar{}
+	for _, b := range h.GetBucket() {
+		if ex := b.GetExemplar(); ex != nil {
+			exemplars = append(exemplars, ex)
+		}
+	}
+	return exemplars
+}
@@ -0,0 +1,380 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/openhistogram/circonusllhist"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+)
+
+func classicHist(counts map[float64]uint64) *dto.Histogram {
+	h := &dto.Histogram{}
+	for ub, c := range counts {
+		h.Bucket = append(h.Bucket, &dto.Bucket{UpperBound: proto.Float64(ub), CumulativeCount: proto.Uint64(c)})
+	}
+	return h
+}
+
+// deserializeHist decodes a base64 serialized histogram (histValue).
+func deserializeHist(v string) (*circonusllhist.Histogram, error) {
+	data, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, err
+	}
+	return circonusllhist.Deserialize(bytes.NewReader(data))
+}
+
+func TestClassicBins(t *testing.T) {
+	t.Log("Testing classicBins")
+
+	tests := []struct {
+		name   string
+		counts map[float64]uint64
+		expect histBins
+	}{
+		{"empty", map[float64]uint64{}, histBins{}},
+		{"positive", map[float64]uint64{1: 2, 2: 5, 4: 5, math.Inf(+1): 6}, histBins{0.5: 2, 1.5: 3, 4: 1}},
+		{"negative first", map[float64]uint64{-1: 1, 1: 3}, histBins{-1: 1, 0: 2}},
+	}
+
+	for _, tst := range tests {
+		t.Log(tst.name)
+		bins := classicBins(classicHist(tst.counts))
+		if !reflect.DeepEqual(bins, tst.expect) {
+			t.Fatalf("expected %v got %v", tst.expect, bins)
+		}
+	}
+}
+
+func TestNativeBins(t *testing.T) {
+	t.Log("Testing nativeBins")
+
+	// schema 0, buckets are powers of 2: (0.5,1], (1,2], (2,4] ... (8,16]
+	h := &dto.Histogram{
+		Schema:        proto.Int32(0),
+		ZeroThreshold: proto.Float64(0.001),
+		ZeroCount:     proto.Uint64(2),
+		PositiveSpan: []*dto.BucketSpan{
+			{Offset: proto.Int32(0), Length: proto.Uint32(2)}, // idx 0, 1
+			{Offset: proto.Int32(2), Length: proto.Uint32(1)}, // idx 4
+		},
+		PositiveDelta: []int64{1, 2, -1}, // 1, 3, 2
+		NegativeSpan:  []*dto.BucketSpan{{Offset: proto.Int32(1), Length: proto.Uint32(1)}},
+		NegativeDelta: []int64{4},
+	}
+	if !isNativeHistogram(h) {
+		t.Fatal("expected native histogram")
+	}
+
+	expect := histBins{0: 2, 0.75: 1, 1.5: 3, 12: 2, -1.5: 4}
+	bins := nativeBins(h)
+	if !reflect.DeepEqual(bins, expect) {
+		t.Fatalf("expected %v got %v", expect, bins)
+	}
+
+	t.Log("float counts")
+	{
+		fh := &dto.Histogram{
+			Schema:        proto.Int32(1),
+			PositiveSpan:  []*dto.BucketSpan{{Offset: proto.Int32(2), Length: proto.Uint32(1)}},
+			PositiveCount: []float64{3},
+		}
+		// schema 1, idx 2: (2^0.5, 2]
+		v := (math.Sqrt2 + 2) / 2
+		bins := nativeBins(fh)
+		if len(bins) != 1 || bins[v] != 3 {
+			t.Fatalf("expected {%v:3} got %v", v, bins)
+		}
+	}
+}
+
+func TestDeltaBins(t *testing.T) {
+	t.Log("Testing deltaBins")
+
+	tests := []struct {
+		name   string
+		cur    histBins
+		prev   histBins
+		expect histBins
+	}{
+		{"no change", histBins{1: 2}, histBins{1: 2}, histBins{}},
+		{"increase", histBins{1: 5, 2: 1}, histBins{1: 2}, histBins{1: 3, 2: 1}},
+		{"reset (decrease)", histBins{1: 1}, histBins{1: 2}, histBins{1: 1}},
+		{"reset (bin removed)", histBins{1: 3}, histBins{1: 2, 2: 1}, histBins{1: 3}},
+	}
+
+	for _, tst := range tests {
+		t.Log(tst.name)
+		d := deltaBins(tst.cur, tst.prev)
+		if !reflect.DeepEqual(d, tst.expect) {
+			t.Fatalf("expected %v got %v", tst.expect, d)
+		}
+	}
+}
+
+func TestHistValue(t *testing.T) {
+	t.Log("Testing histValue")
+
+	v, err := histValue(histBins{0.5: 2, 1.5: 3, 4: 0})
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	h, err := deserializeHist(v)
+	if err != nil {
+		t.Fatalf("deserialize: %s", err)
+	}
+	if h.Count() != 5 {
+		t.Fatalf("expected 5 samples, got %d", h.Count())
+	}
+}
+
+func TestCollectHistogram(t *testing.T) {
+	t.Log("Testing Collect histogram/summary conversion")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	var scrapes int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&scrapes, 1)
+		fmt.Fprintln(w, "# TYPE req_seconds histogram")
+		fmt.Fprintf(w, "req_seconds_bucket{le=\"0.1\"} %d\n", 10*n)
+		fmt.Fprintf(w, "req_seconds_bucket{le=\"1\"} %d\n", 15*n)
+		fmt.Fprintf(w, "req_seconds_bucket{le=\"+Inf\"} %d\n", 15*n)
+		fmt.Fprintf(w, "req_seconds_sum %d\n", 5*n)
+		fmt.Fprintf(w, "req_seconds_count %d\n", 15*n)
+		fmt.Fprintln(w, "# TYPE rpc_seconds summary")
+		fmt.Fprintln(w, "rpc_seconds{quantile=\"0.5\"} 0.2")
+		fmt.Fprintln(w, "rpc_seconds{quantile=\"0.99\"} 0.9")
+		fmt.Fprintln(w, "rpc_seconds_sum 10")
+		fmt.Fprintln(w, "rpc_seconds_count 20")
+	}))
+	defer ts.Close()
+
+	c := newTestProm(URLDef{ID: "foo", URL: ts.URL, uttl: time.Nanosecond, timeout: time.Second})
+	baseTags := cgm.Tags{
+		cgm.Tag{Category: "collector", Value: "promfetch"},
+		cgm.Tag{Category: "prom_id", Value: "foo"},
+		cgm.Tag{Category: "source", Value: "circonus-agent"},
+	}
+	histName := tags.MetricNameWithStreamTags("req_seconds", baseTags)
+
+	t.Log("first scrape (baseline)")
+	{
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		m := c.Flush()
+		if _, ok := m[histName]; ok {
+			t.Fatal("expected no histogram on first scrape")
+		}
+		for _, q := range []string{"0.5", "0.99"} {
+			qtags := append(cgm.Tags{cgm.Tag{Category: "quantile", Value: q}}, baseTags...)
+			if _, ok := m[tags.MetricNameWithStreamTags("rpc_seconds", qtags)]; !ok {
+				t.Fatalf("expected quantile %s gauge", q)
+			}
+		}
+		for mn := range m {
+			if strings.Contains(mn, "_bucket") {
+				t.Fatal("expected no bucket metrics")
+			}
+		}
+	}
+
+	t.Log("second scrape (delta)")
+	{
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		m := c.Flush()
+		hm, ok := m[histName]
+		if !ok {
+			t.Fatalf("expected histogram %s", histName)
+		}
+		if hm.Type != "h" {
+			t.Fatalf("expected type h, got %s", hm.Type)
+		}
+		h, err := deserializeHist(hm.Value.(string))
+		if err != nil {
+			t.Fatalf("deserialize: %s", err)
+		}
+		if h.Count() != 15 {
+			t.Fatalf("expected 15 samples since previous scrape, got %d", h.Count())
+		}
+	}
+}
+
+func TestCollectHistogramTTL(t *testing.T) {
+	t.Log("Testing Collect histogram within url ttl")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	var scrapes int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&scrapes, 1)
+		fmt.Fprintln(w, "# TYPE req_seconds histogram")
+		fmt.Fprintf(w, "req_seconds_bucket{le=\"0.1\"} %d\n", 10*n)
+		fmt.Fprintf(w, "req_seconds_bucket{le=\"+Inf\"} %d\n", 10*n)
+		fmt.Fprintf(w, "req_seconds_sum %d\n", n)
+		fmt.Fprintf(w, "req_seconds_count %d\n", 10*n)
+	}))
+	defer ts.Close()
+
+	u := URLDef{ID: "foo", URL: ts.URL, uttl: time.Nanosecond, timeout: time.Second}
+	c := newTestProm(u)
+	baseTags := cgm.Tags{
+		cgm.Tag{Category: "collector", Value: "promfetch"},
+		cgm.Tag{Category: "prom_id", Value: "foo"},
+		cgm.Tag{Category: "source", Value: "circonus-agent"},
+	}
+	histName := tags.MetricNameWithStreamTags("req_seconds", baseTags)
+
+	// baseline scrape, then a scrape with a histogram delta
+	for i := 0; i < 2; i++ {
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("histogram flushed once")
+	{
+		if _, ok := c.Flush()[histName]; !ok {
+			t.Fatalf("expected histogram %s", histName)
+		}
+		if _, ok := c.Flush()[histName]; ok {
+			t.Fatal("expected histogram only on first flush")
+		}
+	}
+
+	t.Log("histogram not re-emitted within ttl")
+	{
+		c.urls[0].uttl = time.Minute
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if n := atomic.LoadInt32(&scrapes); n != 2 {
+			t.Fatalf("expected 2 scrapes, got %d", n)
+		}
+		if _, ok := c.Flush()[histName]; ok {
+			t.Fatal("expected no histogram from cached scrape")
+		}
+	}
+}
+
+func TestAddExemplars(t *testing.T) {
+	t.Log("Testing addExemplars")
+
+	c := newTestProm()
+	metrics := cgm.Metrics{}
+	ex := &dto.Exemplar{
+		Label: []*dto.LabelPair{{Name: proto.String("trace_id"), Value: proto.String("abc123")}},
+		Value: proto.Float64(0.25),
+	}
+	c.addExemplars(&metrics, "", "req_seconds", tags.Tags{}, []*dto.Exemplar{ex})
+
+	mn := tags.MetricNameWithStreamTags("req_seconds_exemplar", cgm.Tags{
+		cgm.Tag{Category: "collector", Value: "promfetch"},
+		cgm.Tag{Category: "source", Value: "circonus-agent"},
+		cgm.Tag{Category: "trace_id", Value: "abc123"},
+	})
+	m, ok := metrics[mn]
+	if !ok {
+		t.Fatalf("expected %s in %v", mn, metrics)
+	}
+	if m.Value.(float64) != 0.25 {
+		t.Fatalf("expected 0.25 got %v", m.Value)
+	}
+}
+
+func TestCollectHistogramSnapshot(t *testing.T) {
+	t.Log("Testing Collect histogram w/snapshot between flushes")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	var scrapes int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&scrapes, 1)
+		fmt.Fprintln(w, "# TYPE req_seconds histogram")
+		fmt.Fprintf(w, "req_seconds_bucket{le=\"0.1\"} %d\n", 10*n)
+		fmt.Fprintf(w, "req_seconds_bucket{le=\"+Inf\"} %d\n", 10*n)
+		fmt.Fprintf(w, "req_seconds_sum %d\n", n)
+		fmt.Fprintf(w, "req_seconds_count %d\n", 10*n)
+	}))
+	defer ts.Close()
+
+	c := newTestProm(URLDef{ID: "foo", URL: ts.URL, uttl: time.Nanosecond, timeout: time.Second})
+	baseTags := cgm.Tags{
+		cgm.Tag{Category: "collector", Value: "promfetch"},
+		cgm.Tag{Category: "prom_id", Value: "foo"},
+		cgm.Tag{Category: "source", Value: "circonus-agent"},
+	}
+	histName := tags.MetricNameWithStreamTags("req_seconds", baseTags)
+
+	count := func(t *testing.T, m cgm.Metrics) uint64 {
+		t.Helper()
+		hm, ok := m[histName]
+		if !ok {
+			t.Fatalf("expected histogram %s", histName)
+		}
+		h, err := deserializeHist(hm.Value.(string))
+		if err != nil {
+			t.Fatalf("deserialize: %s", err)
+		}
+		return h.Count()
+	}
+
+	// baseline
+	if err := c.Collect(context.Background()); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	_ = c.Flush()
+
+	t.Log("snapshot does not take samples")
+	{
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if n := count(t, c.Snapshot()); n != 10 {
+			t.Fatalf("expected 10 samples, got %d", n)
+		}
+	}
+
+	t.Log("flush gets samples since the last flush")
+	{
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if n := count(t, c.Flush()); n != 20 {
+			t.Fatalf("expected 20 samples, got %d", n)
+		}
+		if _, ok := c.Snapshot()[histName]; ok {
+			t.Fatal("expected no histogram after flush")
+		}
+	}
+
+	t.Log("next flush starts from the flushed samples")
+	{
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if n := count(t, c.Flush()); n != 10 {
+			t.Fatalf("expected 10 samples, got %d", n)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// OpenMetrics metric types, see https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md
+const (
+	omTypeCounter        = "counter"
+	omTypeGauge          = "gauge"
+	omTypeHistogram      = "histogram"
+	omTypeGaugeHistogram = "gaugehistogram"
+	omTypeSummary        = "summary"
+	omTypeInfo           = "info"
+	omTypeStateSet       = "stateset"
+	omTypeUnknown        = "unknown"
+	omMaxLineSize        = 1024 * 1024
+)
+
+var (
+	errOMInvalidLine   = fmt.Errorf("invalid line")
+	errOMInvalidLabels = fmt.Errorf("invalid labels")
+	errOMInvalidValue  = fmt.Errorf("invalid value")
+)
+
+// omSuffixes are the sample name suffixes valid for each metric type.
+var omSuffixes = map[string][]string{
+	omTypeCounter:        {"_total", "_created"},
+	omTypeHistogram:      {"_bucket", "_count", "_sum", "_created"},
+	omTypeGaugeHistogram: {"_bucket", "_gcount", "_gsum"},
+	omTypeSummary:        {"_count", "_sum", "_created"},
+	omTypeInfo:           {"_info"},
+}
+
+// omParser parses the OpenMetrics text format into metric families (the same
+// representation as the prometheus text and protobuf formats).
+type omParser struct {
+	families map[string]*dto.MetricFamily // by exposed name (e.g. counters include _total)
+	series   map[string]*dto.Metric       // by exposed name and labels
+	types    map[string]string            // metric type by OpenMetrics family name
+	help     map[string]string            // help by OpenMetrics family name
+	omUnits  map[string]string            // unit by OpenMetrics family name
+	units    map[string]string            // unit by exposed name
+}
+
+// omSample is a parsed sample line.
+type omSample struct {
+	exemplar *dto.Exemplar
+	name     string
+	labels   []*dto.LabelPair
+	value    float64
+}
+
+// parseOpenMetrics parses OpenMetrics text and returns the metric families
+// and the units (from UNIT metadata) by metric family.
+func parseOpenMetrics(r io.Reader) (map[string]*dto.MetricFamily, map[string]string, error) {
+	p := &omParser{
+		families: make(map[string]*dto.MetricFamily),
+		series:   make(map[string]*dto.Metric),
+		types:    make(map[string]string),
+		help:     make(map[string]string),
+		omUnits:  make(map[string]string),
+		units:    make(map[string]string),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), omMaxLineSize)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "# EOF" {
+			break
+		}
+		if err := p.parseLine(line); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("scan: %w", err)
+	}
+
+	return p.families, p.units, nil
+}
+
+// parseLine parses a metadata (TYPE, UNIT, HELP) or sample line.
+func (p *omParser) parseLine(line string) error {
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(line, "#") {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 3 {
+			return nil // other comments are ignored
+		}
+		name, value := fields[2], ""
+		if len(fields) == 4 {
+			value = fields[3]
+		}
+		switch fields[1] {
+		case "TYPE":
+			p.types[name] = value
+		case "UNIT":
+			p.omUnits[name] = value
+		case "HELP":
+			p.help[name] = value
+		}
+		return nil
+	}
+
+	s, err := parseOMSample(line)
+	if err != nil {
+		return err
+	}
+	p.addSample(s)
+	return nil
+}
+
+// family returns the OpenMetrics family name, type and suffix for a sample name.
+func (p *omParser) family(name string) (string, string, string) {
+	if t, ok := p.types[name]; ok {
+		return name, t, ""
+	}
+	for t, suffixes := range omSuffixes {
+		for _, sfx := range suffixes {
+			if !strings.HasSuffix(name, sfx) {
+				continue
+			}
+			fn := strings.TrimSuffix(name, sfx)
+			if p.types[fn] == t {
+				return fn, t, sfx
+			}
+		}
+	}
+	return name, omTypeUnknown, ""
+}
+
+// metric returns the series for a sample, creating the metric family and series as needed.
+func (p *omParser) metric(famName, name string, mtype dto.MetricType, labels []*dto.LabelPair, skipLabel string) *dto.Metric {
+	mf, ok := p.families[name]
+	if !ok {
+		mf = &dto.MetricFamily{Name: proto.String(name), Type: mtype.Enum()}
+		if help, ok := p.help[famName]; ok {
+			mf.Help = proto.String(help)
+		}
+		if unit, ok := p.omUnits[famName]; ok && unit != "" {
+			p.units[name] = unit
+		}
+		p.families[name] = mf
+	}
+
+	seriesLabels := make([]*dto.LabelPair, 0, len(labels))
+	for _, l := range labels {
+		if l.GetName() != skipLabel {
+			seriesLabels = append(seriesLabels, l)
+		}
+	}
+	sort.Slice(seriesLabels, func(i, j int) bool { return seriesLabels[i].GetName() < seriesLabels[j].GetName() })
+
+	var key strings.Builder
+	key.WriteString(name)
+	for _, l := range seriesLabels {
+		key.WriteString("\xff" + l.GetName() + "\xff" + l.GetValue())
+	}
+
+	m, ok := p.series[key.String()]
+	if !ok {
+		m = &dto.Metric{Label: seriesLabels}
+		mf.Metric = append(mf.Metric, m)
+		p.series[key.String()] = m
+	}
+	return m
+}
+
+// addSample adds a sample to its metric family and series.
+func (p *omParser) addSample(s omSample) {
+	famName, omType, sfx := p.family(s.name)
+
+	switch omType {
+	case omTypeCounter:
+		// counters are exposed with _total, the same name as the prometheus text format
+		m := p.metric(famName, famName+"_total", dto.MetricType_COUNTER, s.labels, "")
+		if m.Counter == nil {
+			m.Counter = &dto.Counter{}
+		}
+		switch sfx {
+		case "_created":
+			m.Counter.CreatedTimestamp = omTimestamp(s.value)
+		default:
+			m.Counter.Value = proto.Float64(s.value)
+			if s.exemplar != nil {
+				m.Counter.Exemplar = s.exemplar
+			}
+		}
+	case omTypeGauge, omTypeStateSet:
+		m := p.metric(famName, famName, dto.MetricType_GAUGE, s.labels, "")
+		m.Gauge = &dto.Gauge{Value: proto.Float64(s.value)}
+	case omTypeInfo:
+		m := p.metric(famName, famName+"_info", dto.MetricType_GAUGE, s.labels, "")
+		m.Gauge = &dto.Gauge{Value: proto.Float64(s.value)}
+	case omTypeSummary:
+		m := p.metric(famName, famName, dto.MetricType_SUMMARY, s.labels, "quantile")
+		if m.Summary == nil {
+			m.Summary = &dto.Summary{}
+		}
+		switch sfx {
+		case "_count":
+			m.Summary.SampleCount = proto.Uint64(omCount(s.value))
+		case "_sum":
+			m.Summary.SampleSum = proto.Float64(s.value)
+		case "_created":
+			m.Summary.CreatedTimestamp = omTimestamp(s.value)
+		default:
+			q, err := strconv.ParseFloat(labelValue(s.labels, "quantile"), 64)
+			if err != nil {
+				return
+			}
+			m.Summary.Quantile = append(m.Summary.Quantile, &dto.Quantile{Quantile: proto.Float64(q), Value: proto.Float64(s.value)})
+		}
+	case omTypeHistogram, omTypeGaugeHistogram:
+		mtype := dto.MetricType_HISTOGRAM
+		if omType == omTypeGaugeHistogram {
+			mtype = dto.MetricType_GAUGE_HISTOGRAM
+		}
+		m := p.metric(famName, famName, mtype, s.labels, "le")
+		if m.Histogram == nil {
+			m.Histogram = &dto.Histogram{}
+		}
+		switch sfx {
+		case "_bucket":
+			le, err := strconv.ParseFloat(labelValue(s.labels, "le"), 64)
+			if err != nil {
+				return
+			}
+			m.Histogram.Bucket = append(m.Histogram.Bucket, &dto.Bucket{
+				UpperBound:      proto.Float64(le),
+				CumulativeCount: proto.Uint64(omCount(s.value)),
+				Exemplar:        s.exemplar,
+			})
+		case "_count", "_gcount":
+			m.Histogram.SampleCount = proto.Uint64(omCount(s.value))
+		case "_sum", "_gsum":
+			m.Histogram.SampleSum = proto.Float64(s.value)
+		case "_created":
+			m.Histogram.CreatedTimestamp = omTimestamp(s.value)
+		}
+	default:
+		m := p.metric(famName, s.name, dto.MetricType_UNTYPED, s.labels, "")
+		m.Untyped = &dto.Untyped{Value: proto.Float64(s.value)}
+	}
+}
+
+// parseOMSample parses a sample line:
+//
+//	name{label="value",...} value [timestamp] [# {label="value",...} value [timestamp]]
+func parseOMSample(line string) (omSample, error) {
+	var s omSample
+
+	end := strings.IndexAny(line, "{ ")
+	if end < 1 {
+		return s, errOMInvalidLine
+	}
+	s.name = line[:end]
+
+	labels, rest, err := parseOMLabels(line[end:])
+	if err != nil {
+		return s, err
+	}
+	s.labels = labels
+
+	sample, exemplar := rest, ""
+	if i := strings.Index(rest, "#"); i >= 0 {
+		sample, exemplar = rest[:i], rest[i+1:]
+	}
+
+	fields := strings.Fields(sample)
+	if len(fields) < 1 || len(fields) > 2 {
+		return s, errOMInvalidLine
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("%s: %w", fields[0], errOMInvalidValue)
+	}
+	s.value = v
+
+	if exemplar != "" {
+		ex, err := parseOMExemplar(exemplar)
+		if err != nil {
+			return s, err
+		}
+		s.exemplar = ex
+	}
+
+	return s, nil
+}
+
+// parseOMExemplar parses an exemplar ({label="value",...} value [timestamp]).
+func parseOMExemplar(s string) (*dto.Exemplar, error) {
+	labels, rest, err := parseOMLabels(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return nil, fmt.Errorf("exemplar: %w", errOMInvalidLine)
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("exemplar %s: %w", fields[0], errOMInvalidValue)
+	}
+	ex := &dto.Exemplar{Label: labels, Value: proto.Float64(v)}
+	if len(fields) == 2 {
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("exemplar timestamp %s: %w", fields[1], errOMInvalidValue)
+		}
+		ex.Timestamp = omTimestamp(ts)
+	}
+	return ex, nil
+}
+
+// parseOMLabels parses a label set ({label="value",...}) if present and
+// returns the labels and the remainder of the line.
+func parseOMLabels(s string) ([]*dto.LabelPair, string, error) {
+	if !strings.HasPrefix(s, "{") {
+		return nil, s, nil
+	}
+	s = s[1:]
+
+	var labels []*dto.LabelPair
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return nil, "", errOMInvalidLabels
+		}
+		if s[0] == '}' {
+			return labels, s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq < 1 {
+			return nil, "", errOMInvalidLabels
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		if !strings.HasPrefix(s, `"`) {
+			return nil, "", errOMInvalidLabels
+		}
+
+		var value strings.Builder
+		closed := false
+		i := 1
+		for ; i < len(s); i++ {
+			ch := s[i]
+			if ch == '\\' && i+1 < len(s) {
+				i++
+				if s[i] == 'n' {
+					value.WriteByte('\n')
+				} else {
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			if ch == '"' {
+				closed = true
+				break
+			}
+			value.WriteByte(ch)
+		}
+		if !closed {
+			return nil, "", errOMInvalidLabels
+		}
+		labels = append(labels, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value.String())})
+
+		s = strings.TrimLeft(s[i+1:], " ")
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		}
+	}
+}
+
+// labelValue returns the value of a label, empty if not found.
+func labelValue(labels []*dto.LabelPair, name string) string {
+	for _, l := range labels {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// omCount converts a (float) sample value to a count.
+func omCount(v float64) uint64 {
+	if v <= 0 || math.IsNaN(v) {
+		return 0
+	}
+	return uint64(v)
+}
+
+// omTimestamp converts a unix epoch (float seconds) timestamp.
+func omTimestamp(v float64) *timestamppb.Timestamp {
+	sec, frac := math.Modf(v)
+	return &timestamppb.Timestamp{Seconds: int64(sec), Nanos: int32(frac * 1e9)}
+}
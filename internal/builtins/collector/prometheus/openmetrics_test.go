@@ -0,0 +1,157 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseOpenMetrics(t *testing.T) {
+	t.Log("Testing parseOpenMetrics")
+
+	f, err := os.Open(filepath.Join("testdata", "formats", "openmetrics.txt"))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer f.Close()
+
+	families, units, err := parseOpenMetrics(f)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	expectTypes := map[string]dto.MetricType{
+		"http_requests_total":     dto.MetricType_COUNTER,
+		"temperature":             dto.MetricType_GAUGE,
+		"request_latency_seconds": dto.MetricType_HISTOGRAM,
+		"queue_size":              dto.MetricType_GAUGE_HISTOGRAM,
+		"rpc_seconds":             dto.MetricType_SUMMARY,
+		"build_info":              dto.MetricType_GAUGE,
+		"feature":                 dto.MetricType_GAUGE,
+		"mystery":                 dto.MetricType_UNTYPED,
+		"untyped_value":           dto.MetricType_UNTYPED,
+	}
+	if len(families) != len(expectTypes) {
+		t.Fatalf("expected %d families, got %d (%v)", len(expectTypes), len(families), families)
+	}
+	for name, mt := range expectTypes {
+		mf, ok := families[name]
+		if !ok {
+			t.Fatalf("expected family %s", name)
+		}
+		if mf.GetType() != mt {
+			t.Fatalf("%s: expected type %s, got %s", name, mt, mf.GetType())
+		}
+	}
+
+	t.Log("units")
+	{
+		if units["temperature"] != "celsius" || units["request_latency_seconds"] != "seconds" || len(units) != 2 {
+			t.Fatalf("unexpected units %v", units)
+		}
+	}
+
+	t.Log("counter (_total, _created, exemplar, escaped label)")
+	{
+		mf := families["http_requests_total"]
+		if mf.GetHelp() != "Total requests." {
+			t.Fatalf("unexpected help (%s)", mf.GetHelp())
+		}
+		if len(mf.GetMetric()) != 1 {
+			t.Fatalf("expected 1 series, got %d", len(mf.GetMetric()))
+		}
+		m := mf.GetMetric()[0]
+		if labelValue(m.GetLabel(), "path") != `/a"b` {
+			t.Fatalf("unexpected labels %v", m.GetLabel())
+		}
+		c := m.GetCounter()
+		if c.GetValue() != 1027 {
+			t.Fatalf("expected 1027, got %v", c.GetValue())
+		}
+		if c.GetCreatedTimestamp().GetSeconds() != 1700000000 || c.GetCreatedTimestamp().GetNanos() != 250000000 {
+			t.Fatalf("unexpected created %v", c.GetCreatedTimestamp())
+		}
+		ex := c.GetExemplar()
+		if ex == nil || ex.GetValue() != 1 || labelValue(ex.GetLabel(), "trace_id") != "abc123" || ex.GetTimestamp().GetSeconds() != 1700000000 {
+			t.Fatalf("unexpected exemplar %v", ex)
+		}
+	}
+
+	t.Log("histogram")
+	{
+		h := families["request_latency_seconds"].GetMetric()[0].GetHistogram()
+		if len(h.GetBucket()) != 3 || h.GetSampleCount() != 16 || h.GetSampleSum() != 7.5 {
+			t.Fatalf("unexpected histogram %v", h)
+		}
+		if h.GetBucket()[1].GetExemplar() == nil {
+			t.Fatal("expected bucket exemplar")
+		}
+		if h.GetCreatedTimestamp().GetSeconds() != 1700000000 {
+			t.Fatalf("unexpected created %v", h.GetCreatedTimestamp())
+		}
+		gh := families["queue_size"].GetMetric()[0].GetHistogram()
+		if len(gh.GetBucket()) != 2 || gh.GetSampleCount() != 4 || gh.GetSampleSum() != 25 {
+			t.Fatalf("unexpected gauge histogram %v", gh)
+		}
+	}
+
+	t.Log("summary")
+	{
+		mf := families["rpc_seconds"]
+		if len(mf.GetMetric()) != 1 {
+			t.Fatalf("expected 1 series, got %d", len(mf.GetMetric()))
+		}
+		s := mf.GetMetric()[0].GetSummary()
+		if len(s.GetQuantile()) != 2 || s.GetSampleCount() != 20 || s.GetSampleSum() != 10 {
+			t.Fatalf("unexpected summary %v", s)
+		}
+	}
+
+	t.Log("stateset")
+	{
+		if n := len(families["feature"].GetMetric()); n != 2 {
+			t.Fatalf("expected 2 series, got %d", n)
+		}
+	}
+}
+
+func TestParseOpenMetricsInvalid(t *testing.T) {
+	t.Log("Testing parseOpenMetrics invalid")
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"no value", "foo\n"},
+		{"bad value", "foo abc\n"},
+		{"unterminated labels", "foo{a=\"b\" 1\n"},
+		{"unquoted label", "foo{a=b} 1\n"},
+		{"bad exemplar", "# TYPE foo counter\nfoo_total 1 # {a=\"b\"} x\n"},
+	}
+
+	for _, tst := range tests {
+		t.Log(tst.name)
+		if _, _, err := parseOpenMetrics(strings.NewReader(tst.data)); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("stops at EOF")
+	{
+		families, _, err := parseOpenMetrics(strings.NewReader("foo 1\n# EOF\nnot valid\n"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(families) != 1 {
+			t.Fatalf("expected 1 family, got %d", len(families))
+		}
+	}
+}
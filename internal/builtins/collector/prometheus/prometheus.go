@@ -16,6 +16,7 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,17 +26,33 @@ import (
 	"github.com/circonus-labs/circonus-agent/internal/tags"
 	cgm "github.com/circonus-labs/circonus-gometrics/v3"
 	dto "github.com/prometheus/client_model/go"
-	"github.com/prometheus/common/expfmt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // URLDef defines a url to fetch text formatted prom metrics from.
 type URLDef struct {
-	ID   string `json:"id" toml:"id" yaml:"id"`
-	URL  string `json:"url" toml:"url" yaml:"url"`
-	TTL  string `json:"ttl" toml:"ttl" yaml:"ttl"`
-	uttl time.Duration
+	Headers            map[string]string `json:"headers" toml:"headers" yaml:"headers"`
+	Labels             map[string]string `json:"labels" toml:"labels" yaml:"labels"`
+	client             *http.Client
+	ID                 string        `json:"id" toml:"id" yaml:"id"`
+	URL                string        `json:"url" toml:"url" yaml:"url"`
+	TTL                string        `json:"ttl" toml:"ttl" yaml:"ttl"`
+	Timeout            string        `json:"timeout" toml:"timeout" yaml:"timeout"`
+	BearerToken        string        `json:"bearer_token" toml:"bearer_token" yaml:"bearer_token"`
+	BearerTokenFile    string        `json:"bearer_token_file" toml:"bearer_token_file" yaml:"bearer_token_file"`
+	Username           string        `json:"username" toml:"username" yaml:"username"`
+	Password           string        `json:"password" toml:"password" yaml:"password"`
+	CAFile             string        `json:"ca_file" toml:"ca_file" yaml:"ca_file"`
+	CertFile           string        `json:"cert_file" toml:"cert_file" yaml:"cert_file"`
+	KeyFile            string        `json:"key_file" toml:"key_file" yaml:"key_file"`
+	InsecureSkipVerify string        `json:"insecure_skip_verify" toml:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+	Exemplars          string        `json:"exemplars" toml:"exemplars" yaml:"exemplars"`
+	Relabel            []RelabelRule `json:"relabel" toml:"relabel" yaml:"relabel"`
+	uttl               time.Duration
+	timeout            time.Duration
+	exemplars          bool
 }
 
 // Prom defines prom collector.
@@ -45,12 +62,16 @@ type Prom struct {
 	lastStart       time.Time
 	metricNameRegex *regexp.Regexp
 	lastMetrics     cgm.Metrics
+	scrapes         map[string]*scrapeState
+	localSD         *LocalDiscoveryConfig
+	fileSD          []*FileSDConfig
 	lastError       string
 	pkgID           string
 	urls            []URLDef
 	baseTags        []string
 	lastRunDuration time.Duration
 	runTTL          time.Duration
+	flushes         uint64 // number of flushes, histograms are the samples since the last flush
 	sync.Mutex
 	running bool
 }
@@ -73,15 +94,18 @@ type Prom struct {
 
 // promOptions defines what elements can be overridden in a config file.
 type promOptions struct {
-	RunTTL string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
-	URLs   []URLDef `json:"urls" toml:"urls" yaml:"urls"`
+	LocalDiscovery *LocalDiscoveryConfig `json:"local_discovery" toml:"local_discovery" yaml:"local_discovery"`
+	RunTTL         string                `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	URLs           []URLDef              `json:"urls" toml:"urls" yaml:"urls"`
+	FileSD         []FileSDConfig        `json:"file_sd" toml:"file_sd" yaml:"file_sd"`
 }
 
 var (
 	errInvalidMetric       = fmt.Errorf("invalid metric, nil")
 	errInvalidMetricNoName = fmt.Errorf("invalid metric, no name")
 	errInvalidMetricNoType = fmt.Errorf("invalid metric, no type")
-	errInvalidURLs         = fmt.Errorf("'urls' is REQUIRED in configuration")
+	errInvalidURLs         = fmt.Errorf("'urls', 'file_sd' or 'local_discovery' is REQUIRED in configuration")
+	errBadStatus           = fmt.Errorf("unexpected response status")
 )
 
 // New creates new prom collector.
@@ -113,29 +137,30 @@ func New(cfgBaseName string) (collector.Collector, error) {
 		return nil, fmt.Errorf("%s config: %w", c.pkgID, err)
 	}
 
-	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+	// NOTE: url definitions may contain credentials, do not log them
+	c.logger.Debug().Str("base", cfgBaseName).Int("urls", len(opts.URLs)).Msg("loaded config")
 
-	if len(opts.URLs) == 0 {
+	if len(opts.URLs) == 0 && len(opts.FileSD) == 0 && opts.LocalDiscovery == nil {
 		return nil, errInvalidURLs
 	}
 	for i, u := range opts.URLs {
 		if u.ID == "" {
-			c.logger.Warn().Int("item", i).Interface("url", u).Msg("invalid id (empty), ignoring URL entry")
+			c.logger.Warn().Int("item", i).Str("id", u.ID).Str("url", u.URL).Msg("invalid id (empty), ignoring URL entry")
 			continue
 		}
 		if u.URL == "" {
-			c.logger.Warn().Int("item", i).Interface("url", u).Msg("invalid URL (empty), ignoring URL entry")
+			c.logger.Warn().Int("item", i).Str("id", u.ID).Str("url", u.URL).Msg("invalid URL (empty), ignoring URL entry")
 			continue
 		}
 		_, err := url.Parse(u.URL)
 		if err != nil {
-			c.logger.Warn().Err(err).Int("item", i).Interface("url", u).Msg("invalid URL, ignoring URL entry")
+			c.logger.Warn().Err(err).Int("item", i).Str("id", u.ID).Str("url", u.URL).Msg("invalid URL, ignoring URL entry")
 			continue
 		}
 		if u.TTL != "" {
 			ttl, err := time.ParseDuration(u.TTL)
 			if err != nil {
-				c.logger.Warn().Err(err).Int("item", i).Interface("url", u).Msg("invalid TTL, ignoring")
+				c.logger.Warn().Err(err).Int("item", i).Str("id", u.ID).Str("url", u.URL).Msg("invalid TTL, ignoring")
 			} else {
 				u.uttl = ttl
 			}
@@ -143,10 +168,29 @@ func New(cfgBaseName string) (collector.Collector, error) {
 		if u.uttl == time.Duration(0) {
 			u.uttl = 30 * time.Second
 		}
-		c.logger.Debug().Int("item", i).Interface("url", u).Msg("enabling prom collection URL")
+		if err := u.configure(); err != nil {
+			c.logger.Warn().Err(err).Int("item", i).Str("id", u.ID).Str("url", u.URL).Msg("invalid URL options, ignoring URL entry")
+			continue
+		}
+		c.logger.Debug().Int("item", i).Str("id", u.ID).Str("url", u.URL).Msg("enabling prom collection URL")
 		c.urls = append(c.urls, u)
 	}
 
+	for i := range opts.FileSD {
+		sd := opts.FileSD[i]
+		if err := sd.init(); err != nil {
+			return nil, fmt.Errorf("%s file_sd %d: %w", c.pkgID, i, err)
+		}
+		c.fileSD = append(c.fileSD, &sd)
+	}
+
+	if opts.LocalDiscovery != nil {
+		if err := opts.LocalDiscovery.init(); err != nil {
+			return nil, fmt.Errorf("%s local_discovery: %w", c.pkgID, err)
+		}
+		c.localSD = opts.LocalDiscovery
+	}
+
 	if opts.RunTTL != "" {
 		dur, err := time.ParseDuration(opts.RunTTL)
 		if err != nil {
@@ -160,7 +204,6 @@ func New(cfgBaseName string) (collector.Collector, error) {
 
 // Collect returns collector metrics.
 func (c *Prom) Collect(ctx context.Context) error {
-	metrics := cgm.Metrics{}
 	c.Lock()
 
 	if c.running {
@@ -181,53 +224,58 @@ func (c *Prom) Collect(ctx context.Context) error {
 	c.lastStart = time.Now()
 	c.Unlock()
 
-	for _, u := range c.urls {
-		c.logger.Debug().Str("id", u.ID).Str("url", u.URL).Msg("prom fetch request")
-		err := c.fetchPromMetrics(ctx, u, &metrics)
-		if err != nil {
-			c.logger.Error().Err(err).Interface("url", u).Msg("fetching prom metrics")
-		}
-	}
+	metrics := c.scrapeAll(ctx, c.targets(ctx))
 
 	c.setStatus(metrics, nil)
 	return nil
 }
 
-func (c *Prom) fetchPromMetrics(pctx context.Context, u URLDef, metrics *cgm.Metrics) error {
-	req, err := http.NewRequest("GET", u.URL, nil)
-	if err != nil {
-		return fmt.Errorf("prepare request: %w", err)
+func (c *Prom) fetchPromMetrics(pctx context.Context, u URLDef, st *scrapeState, metrics *cgm.Metrics) error {
+	timeout := u.timeout
+	if timeout == time.Duration(0) {
+		timeout = u.uttl
 	}
 
 	var ctx context.Context
 	var cancel context.CancelFunc
 
-	if u.uttl > time.Duration(0) {
-		ctx, cancel = context.WithTimeout(pctx, u.uttl)
+	if timeout > time.Duration(0) {
+		ctx, cancel = context.WithTimeout(pctx, timeout)
 	} else {
 		ctx, cancel = context.WithCancel(pctx)
 	}
-
-	req = req.WithContext(ctx)
 	defer cancel()
 
-	ec := make(chan error, 1)
+	req, err := u.newRequest(ctx)
+	if err != nil {
+		return err
+	}
 
-	go func() {
-		client := &http.Client{
+	client := u.client
+	if client == nil {
+		client = &http.Client{
 			Transport: &http.Transport{
 				DisableCompression:  false,
 				DisableKeepAlives:   true,
 				MaxIdleConnsPerHost: 1,
 			},
 		}
+	}
+
+	ec := make(chan error, 1)
+
+	go func() {
 		resp, err := client.Do(req)
 		if err != nil {
 			ec <- err
 			return
 		}
 		defer resp.Body.Close()
-		ec <- c.parse(u.ID, resp.Body, metrics)
+		if resp.StatusCode != http.StatusOK {
+			ec <- fmt.Errorf("%s: %w", resp.Status, errBadStatus)
+			return
+		}
+		ec <- c.parse(u, st, resp.Body, responseFormat(resp.Header), metrics)
 	}()
 
 	select {
@@ -239,63 +287,152 @@ func (c *Prom) fetchPromMetrics(pctx context.Context, u URLDef, metrics *cgm.Met
 	}
 }
 
-func (c *Prom) parse(id string, data io.Reader, metrics *cgm.Metrics) error {
-	var parser expfmt.TextParser
-
+func (c *Prom) parse(u URLDef, st *scrapeState, data io.Reader, format string, metrics *cgm.Metrics) error {
 	// formats supported from https://prometheus.io/docs/instrumenting/exposition_formats/
+	// and https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md
 
-	metricFamilies, err := parser.TextToMetricFamilies(data)
+	metricFamilies, units, err := decodeMetricFamilies(data, format)
 	if err != nil {
 		return fmt.Errorf("parser - metric families: %w", err)
 	}
 
+	// cumulative histogram bins (and created timestamps) by series, used to
+	// calculate the samples since the last flush
+	hists := make(map[string]histBins)
+	created := make(map[string]int64)
+	if st.base == nil {
+		st.base = make(map[string]histBins)
+		st.baseCreated = make(map[string]int64)
+	}
+
 	pfx := ""
 	for mn, mf := range metricFamilies {
 		for _, m := range mf.GetMetric() {
 			metricName := mn
-			tags := c.getLabels(m)
-			tags = append(tags, cgm.Tag{Category: "prom_id", Value: id})
+			labels := make(map[string]string, len(u.Labels)+len(m.GetLabel()))
+			for ln, lv := range u.Labels {
+				labels[ln] = lv
+			}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if !relabel(u.Relabel, metricName, labels) {
+				continue
+			}
+			tags := c.getLabels(labels)
+			tags = append(tags, cgm.Tag{Category: "prom_id", Value: u.ID})
+			// units (OpenMetrics UNIT metadata) apply to values, not counts or timestamps
+			utags := tags
+			if unit := units[mn]; unit != "" {
+				utags = append(cgm.Tags{cgm.Tag{Category: "units", Value: unit}}, tags...)
+			}
 			switch mf.GetType() {
 			case dto.MetricType_SUMMARY:
 				_ = c.addMetric(metrics, pfx, metricName+"_count", tags, "n", float64(m.GetSummary().GetSampleCount()))
-				_ = c.addMetric(metrics, pfx, metricName+"_sum", tags, "n", m.GetSummary().GetSampleSum())
+				_ = c.addMetric(metrics, pfx, metricName+"_sum", utags, "n", m.GetSummary().GetSampleSum())
 				for qn, qv := range c.getQuantiles(m) {
-					_ = c.addMetric(metrics, pfx, metricName+"_"+qn, tags, "n", qv)
+					qtags := append(utags, cgm.Tag{Category: "quantile", Value: qn}) //nolint:gocritic
+					_ = c.addMetric(metrics, pfx, metricName, qtags, "n", qv)
+				}
+				c.addCreated(metrics, pfx, metricName, tags, m.GetSummary().GetCreatedTimestamp())
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				count := float64(h.GetSampleCount())
+				if count == 0 && h.GetSampleCountFloat() > 0 {
+					count = h.GetSampleCountFloat()
 				}
-			case dto.MetricType_HISTOGRAM:
-				_ = c.addMetric(metrics, pfx, metricName+"_count", tags, "n", float64(m.GetHistogram().GetSampleCount()))
-				_ = c.addMetric(metrics, pfx, metricName+"_sum", tags, "n", m.GetHistogram().GetSampleSum())
-				for bn, bv := range c.getBuckets(m) {
-					_ = c.addMetric(metrics, pfx, metricName+"_"+bn, tags, "n", bv)
+				_ = c.addMetric(metrics, pfx, metricName+"_count", tags, "n", count)
+				_ = c.addMetric(metrics, pfx, metricName+"_sum", utags, "n", h.GetSampleSum())
+				c.addCreated(metrics, pfx, metricName, tags, h.GetCreatedTimestamp())
+				bins := getHistBins(h)
+				if mf.GetType() == dto.MetricType_HISTOGRAM {
+					// counts are cumulative, send the samples since the last flush
+					key := seriesKey(metricName, tags)
+					hists[key] = bins
+					created[key] = h.GetCreatedTimestamp().GetSeconds()
+					prev, ok := st.base[key]
+					if !ok {
+						// first scrape of series, baseline only
+						st.base[key] = bins
+						st.baseCreated[key] = created[key]
+						continue
+					}
+					if created[key] != st.baseCreated[key] {
+						// series was (re)created since the last flush, all samples are new
+						prev = histBins{}
+					}
+					bins = deltaBins(bins, prev)
+				}
+				hv, err := histValue(bins)
+				if err != nil {
+					c.logger.Warn().Err(err).Str("metric", metricName).Msg("converting histogram")
+					continue
+				}
+				_ = c.addMetric(metrics, pfx, metricName, utags, histogramType, hv)
+				if u.exemplars {
+					c.addExemplars(metrics, pfx, metricName, tags, histExemplars(h))
 				}
 			case dto.MetricType_COUNTER:
-				_ = c.addMetric(metrics, pfx, metricName, tags, "n", m.GetCounter().GetValue())
+				_ = c.addMetric(metrics, pfx, metricName, utags, "n", m.GetCounter().GetValue())
+				if ex := m.GetCounter().GetExemplar(); ex != nil && u.exemplars {
+					c.addExemplars(metrics, pfx, metricName, tags, []*dto.Exemplar{ex})
+				}
+				c.addCreated(metrics, pfx, strings.TrimSuffix(metricName, "_total"), tags, m.GetCounter().GetCreatedTimestamp())
 			case dto.MetricType_GAUGE:
-				_ = c.addMetric(metrics, pfx, metricName, tags, "n", m.GetGauge().GetValue())
+				_ = c.addMetric(metrics, pfx, metricName, utags, "n", m.GetGauge().GetValue())
 			case dto.MetricType_UNTYPED:
 				v := m.GetUntyped().GetValue()
 				if v == math.Inf(+1) {
 					c.logger.Warn().Str("metric", metricName).Str("type", mf.GetType().String()).Str("value", (*m).GetUntyped().String()).Msg("cannot coerce +Inf to numeric")
 					continue
 				}
-				_ = c.addMetric(metrics, pfx, metricName, tags, "n", mf)
-			case dto.MetricType_GAUGE_HISTOGRAM:
-				// not currently supported
+				_ = c.addMetric(metrics, pfx, metricName, utags, "n", v)
 			}
 		}
 	}
 
+	st.hists = hists
+	st.created = created
+
 	return nil
 }
 
-func (c *Prom) getLabels(m *dto.Metric) tags.Tags {
+// seriesKey returns a unique key for a series (metric name and tags).
+func seriesKey(name string, tagList tags.Tags) string {
+	return tags.MetricNameWithStreamTags(name, tagList)
+}
+
+// addCreated adds the series created timestamp (OpenMetrics _created, or from protobuf), if set.
+func (c *Prom) addCreated(metrics *cgm.Metrics, pfx, metricName string, mtags tags.Tags, ts *timestamppb.Timestamp) {
+	if ts == nil || ts.GetSeconds() <= 0 {
+		return
+	}
+	ctags := append(tags.Tags{tags.Tag{Category: "units", Value: "seconds"}}, mtags...)
+	_ = c.addMetric(metrics, pfx, metricName+"_created", ctags, "L", uint64(ts.GetSeconds()))
+}
+
+// addExemplars adds exemplar values, tagged with the exemplar labels (e.g. trace_id).
+func (c *Prom) addExemplars(metrics *cgm.Metrics, pfx, metricName string, mtags tags.Tags, exemplars []*dto.Exemplar) {
+	for _, ex := range exemplars {
+		etags := make(tags.Tags, 0, len(mtags)+len(ex.GetLabel()))
+		etags = append(etags, mtags...)
+		for _, l := range ex.GetLabel() {
+			if l.GetName() != "" && l.GetValue() != "" {
+				etags = append(etags, tags.Tag{Category: c.cleanName(l.GetName()), Value: c.cleanName(l.GetValue())})
+			}
+		}
+		_ = c.addMetric(metrics, pfx, metricName+"_exemplar", etags, "n", ex.GetValue())
+	}
+}
+
+func (c *Prom) getLabels(metricLabels map[string]string) tags.Tags {
 	// Need to use cgm.Tags format and return a converted stream tags string
 	labels := []string{}
 
-	for _, label := range m.GetLabel() {
-		if label.GetName() != "" && label.GetValue() != "" {
-			ln := c.metricNameRegex.ReplaceAllString(label.GetName(), "")
-			lv := c.metricNameRegex.ReplaceAllString(label.GetValue(), "")
+	for name, value := range metricLabels {
+		if name != "" && value != "" {
+			ln := c.metricNameRegex.ReplaceAllString(name, "")
+			lv := c.metricNameRegex.ReplaceAllString(value, "")
 			labels = append(labels, ln+tags.Delimiter+lv) // stream tags take form cat:val
 		}
 	}
@@ -321,13 +458,3 @@ func (c *Prom) getQuantiles(m *dto.Metric) map[string]float64 {
 	}
 	return ret
 }
-
-func (c *Prom) getBuckets(m *dto.Metric) map[string]uint64 {
-	ret := make(map[string]uint64)
-	for _, b := range m.GetHistogram().GetBucket() {
-		if b.CumulativeCount != nil { //nolint:protogetter
-			ret[fmt.Sprint(*b.UpperBound)] = *b.CumulativeCount //nolint:protogetter
-		}
-	}
-	return ret
-}
@@ -157,7 +157,8 @@ func TestCollect(t *testing.T) {
 	}
 
 	m := c.Flush()
-	numExpected := 21
+	// histogram buckets are converted to a circonus histogram, sent starting with the second scrape
+	numExpected := 15 + 3 // + up, scrape_duration, last_success_timestamp
 	if len(m) != numExpected {
 		t.Fatalf("expected %d metrics, got %d", numExpected, len(m))
 	}
@@ -213,6 +214,7 @@ func TestCollectTimeout(t *testing.T) {
 	// collection timing out should be benign
 	// return 0 metrics, not throw or cause an error
 	// the fact that the timeout was exceeded is logged
+	// and reflected in the up metric
 	//
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -232,7 +234,7 @@ func TestCollectTimeout(t *testing.T) {
 	}
 
 	m := c.Flush()
-	numExpected := 0
+	numExpected := 2 // up (0) and scrape_duration
 	if len(m) != numExpected {
 		t.Fatalf("expected %d metrics, got %d", numExpected, len(m))
 	}
@@ -0,0 +1,132 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	relabelNameLabel        = "__name__" // source label referring to the metric name
+	relabelDefaultSeparator = ";"
+	relabelDefaultReplace   = "$1"
+)
+
+var (
+	errRelabelInvalidAction = fmt.Errorf("invalid relabel action")
+	errRelabelNoRegex       = fmt.Errorf("relabel regex is required")
+)
+
+// RelabelRule defines a Prometheus style relabel rule applied to scraped metrics.
+//
+// Actions:
+//
+//	keep        - keep metrics where the source label values match regex
+//	drop        - drop metrics where the source label values match regex
+//	labelkeep   - keep only labels with names matching regex
+//	labeldrop   - drop labels with names matching regex
+//	labelmap    - copy labels with names matching regex to the name from replacement
+//	labelrename - rename labels with names matching regex to the name from replacement
+type RelabelRule struct {
+	rx           *regexp.Regexp
+	Action       string   `json:"action" toml:"action" yaml:"action"`
+	Regex        string   `json:"regex" toml:"regex" yaml:"regex"`
+	Separator    string   `json:"separator" toml:"separator" yaml:"separator"`
+	Replacement  string   `json:"replacement" toml:"replacement" yaml:"replacement"`
+	SourceLabels []string `json:"source_labels" toml:"source_labels" yaml:"source_labels"`
+}
+
+// compile validates the rule and compiles the (anchored) regex.
+func (r *RelabelRule) compile() error {
+	r.Action = strings.ToLower(r.Action)
+	switch r.Action {
+	case "keep", "drop", "labelkeep", "labeldrop", "labelmap", "labelrename":
+	default:
+		return fmt.Errorf("%w (%s)", errRelabelInvalidAction, r.Action)
+	}
+
+	if r.Regex == "" {
+		return errRelabelNoRegex
+	}
+	rx, err := regexp.Compile("^(?:" + r.Regex + ")$")
+	if err != nil {
+		return fmt.Errorf("compile relabel regex: %w", err)
+	}
+	r.rx = rx
+
+	if len(r.SourceLabels) == 0 {
+		r.SourceLabels = []string{relabelNameLabel}
+	}
+	if r.Separator == "" {
+		r.Separator = relabelDefaultSeparator
+	}
+	if r.Replacement == "" {
+		r.Replacement = relabelDefaultReplace
+	}
+
+	return nil
+}
+
+// sourceValue returns the source label values joined with the separator.
+func (r *RelabelRule) sourceValue(name string, labels map[string]string) string {
+	vals := make([]string, 0, len(r.SourceLabels))
+	for _, l := range r.SourceLabels {
+		if l == relabelNameLabel {
+			vals = append(vals, name)
+			continue
+		}
+		vals = append(vals, labels[l])
+	}
+	return strings.Join(vals, r.Separator)
+}
+
+// relabel applies the rules, in order, to a metric's labels (modified in place).
+// Returns false if the metric should be dropped.
+func relabel(rules []RelabelRule, name string, labels map[string]string) bool {
+	for _, r := range rules {
+		switch r.Action {
+		case "keep":
+			if !r.rx.MatchString(r.sourceValue(name, labels)) {
+				return false
+			}
+		case "drop":
+			if r.rx.MatchString(r.sourceValue(name, labels)) {
+				return false
+			}
+		case "labelkeep":
+			for ln := range labels {
+				if !r.rx.MatchString(ln) {
+					delete(labels, ln)
+				}
+			}
+		case "labeldrop":
+			for ln := range labels {
+				if r.rx.MatchString(ln) {
+					delete(labels, ln)
+				}
+			}
+		case "labelmap", "labelrename":
+			mapped := make(map[string]string)
+			for ln, lv := range labels {
+				if !r.rx.MatchString(ln) {
+					continue
+				}
+				if nn := r.rx.ReplaceAllString(ln, r.Replacement); nn != "" && nn != ln {
+					mapped[nn] = lv
+					if r.Action == "labelrename" {
+						delete(labels, ln)
+					}
+				}
+			}
+			for ln, lv := range mapped {
+				labels[ln] = lv
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/rs/zerolog"
+)
+
+func TestRelabelCompile(t *testing.T) {
+	t.Log("Testing RelabelRule compile")
+
+	t.Log("invalid action")
+	{
+		r := RelabelRule{Action: "replace", Regex: "foo"}
+		if err := r.compile(); !errors.Is(err, errRelabelInvalidAction) {
+			t.Fatalf("expected (%s) got (%v)", errRelabelInvalidAction, err)
+		}
+	}
+
+	t.Log("no regex")
+	{
+		r := RelabelRule{Action: "drop"}
+		if err := r.compile(); !errors.Is(err, errRelabelNoRegex) {
+			t.Fatalf("expected (%s) got (%v)", errRelabelNoRegex, err)
+		}
+	}
+
+	t.Log("defaults")
+	{
+		r := RelabelRule{Action: "KEEP", Regex: "foo"}
+		if err := r.compile(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if r.Action != "keep" || r.Separator != ";" || r.Replacement != "$1" || !reflect.DeepEqual(r.SourceLabels, []string{"__name__"}) {
+			t.Fatalf("unexpected defaults %#v", r)
+		}
+		if r.rx.MatchString("foobar") {
+			t.Fatal("expected regex to be anchored")
+		}
+	}
+
+	t.Log("invalid config (all urls ignored)")
+	{
+		c, err := New(filepath.Join("testdata", "config_relabel_invalid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if n := len(c.(*Prom).urls); n != 0 {
+			t.Fatalf("expected 0 urls, got %d", n)
+		}
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	t.Log("Testing relabel")
+
+	tests := []struct {
+		name   string
+		rules  []RelabelRule
+		labels map[string]string
+		expect map[string]string
+		keep   bool
+	}{
+		{"no rules", nil, map[string]string{"a": "1"}, map[string]string{"a": "1"}, true},
+		{"drop name", []RelabelRule{{Action: "drop", Regex: "foo_.*"}}, map[string]string{}, nil, false},
+		{"keep name", []RelabelRule{{Action: "keep", Regex: "foo_.*"}}, map[string]string{}, map[string]string{}, true},
+		{"keep label", []RelabelRule{{Action: "keep", SourceLabels: []string{"a"}, Regex: "2"}}, map[string]string{"a": "1"}, nil, false},
+		{"labeldrop", []RelabelRule{{Action: "labeldrop", Regex: "a|b"}}, map[string]string{"a": "1", "b": "2", "c": "3"}, map[string]string{"c": "3"}, true},
+		{"labelkeep", []RelabelRule{{Action: "labelkeep", Regex: "a|b"}}, map[string]string{"a": "1", "b": "2", "c": "3"}, map[string]string{"a": "1", "b": "2"}, true},
+		{"labelmap", []RelabelRule{{Action: "labelmap", Regex: "k8s_(.+)"}}, map[string]string{"k8s_pod": "x"}, map[string]string{"k8s_pod": "x", "pod": "x"}, true},
+		{"labelrename", []RelabelRule{{Action: "labelrename", Regex: "k8s_(.+)"}}, map[string]string{"k8s_pod": "x"}, map[string]string{"pod": "x"}, true},
+	}
+
+	for _, tst := range tests {
+		t.Log(tst.name)
+		for i := range tst.rules {
+			if err := tst.rules[i].compile(); err != nil {
+				t.Fatalf("compile: %s", err)
+			}
+		}
+		keep := relabel(tst.rules, "foo_bar", tst.labels)
+		if keep != tst.keep {
+			t.Fatalf("expected keep %v, got %v", tst.keep, keep)
+		}
+		if keep && !reflect.DeepEqual(tst.labels, tst.expect) {
+			t.Fatalf("expected %v got %v", tst.expect, tst.labels)
+		}
+	}
+}
+
+func TestCollectRelabel(t *testing.T) {
+	t.Log("Testing Collect w/relabel")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, promData)
+		fmt.Fprintln(w, "# TYPE go_goroutines gauge\ngo_goroutines 10")
+	}))
+	defer ts.Close()
+
+	c, err := New(filepath.Join("testdata", "config_relabel_valid_setting"))
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	p := c.(*Prom)
+	if len(p.urls) != 1 {
+		t.Fatalf("expected 1 url, got %d", len(p.urls))
+	}
+	p.urls[0].URL = ts.URL
+
+	if err := c.Collect(context.Background()); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	m := c.Flush()
+	// http_requests_total{method="post"} x2 and test, + up, scrape_duration, last_success_timestamp
+	if len(m) != 6 {
+		t.Fatalf("expected 6 metrics, got %d %v", len(m), m)
+	}
+
+	mn := tags.MetricNameWithStreamTags("http_requests_total", cgm.Tags{
+		cgm.Tag{Category: "collector", Value: "promfetch"},
+		cgm.Tag{Category: "env", Value: "prod"},
+		cgm.Tag{Category: "prom_id", Value: "foo"},
+		cgm.Tag{Category: "source", Value: "circonus-agent"},
+		cgm.Tag{Category: "status_code", Value: "400"},
+	})
+	if _, ok := m[mn]; !ok {
+		t.Fatalf("expected metric '%s', %#v", mn, m)
+	}
+}
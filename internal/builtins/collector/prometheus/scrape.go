@@ -0,0 +1,203 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+)
+
+// scrapeState is the result of the last scrape of a URL, reused until the URL's TTL expires.
+type scrapeState struct {
+	lastScrape  time.Time
+	lastSuccess time.Time
+	metrics     cgm.Metrics
+	histograms  cgm.Metrics         // histogram samples since the last flush, from the last scrape
+	hists       map[string]histBins // cumulative histogram bins by series from the last scrape
+	created     map[string]int64    // histogram created timestamps by series from the last scrape
+	base        map[string]histBins // cumulative histogram bins by series when last flushed
+	baseCreated map[string]int64    // histogram created timestamps by series when last flushed
+	emitted     map[string]histBins // cumulative histogram bins of the histograms last collected
+	emittedCrtd map[string]int64    // histogram created timestamps of the histograms last collected
+	flushes     uint64              // collector flushes seen, see flushed
+	lastError   error
+	duration    time.Duration
+	up          bool
+}
+
+// flushed moves the histogram baseline to the histograms last collected, if
+// the collector was flushed since the previous collection. Until then the
+// histograms (samples since the baseline) are collected again, so consumers
+// which do not flush (e.g. /metrics) do not take samples from those which do.
+func (st *scrapeState) flushed(flushes uint64) {
+	if st.flushes == flushes {
+		return
+	}
+	st.flushes = flushes
+	if st.emitted != nil {
+		st.base = st.emitted
+		st.baseCreated = st.emittedCrtd
+	}
+	st.histograms = nil
+	st.emitted = nil
+	st.emittedCrtd = nil
+}
+
+// scrapeKey identifies the state for a URL definition.
+func scrapeKey(u URLDef) string {
+	return u.ID + "|" + u.URL
+}
+
+// getScrapeState returns the scrape state for a URL, creating it if needed.
+func (c *Prom) getScrapeState(u URLDef) *scrapeState {
+	c.Lock()
+	defer c.Unlock()
+	if c.scrapes == nil {
+		c.scrapes = make(map[string]*scrapeState)
+	}
+	key := scrapeKey(u)
+	st, ok := c.scrapes[key]
+	if !ok {
+		st = &scrapeState{}
+		c.scrapes[key] = st
+	}
+	return st
+}
+
+// targets returns the static and discovered URLs to scrape.
+func (c *Prom) targets(ctx context.Context) []URLDef {
+	targets := make([]URLDef, 0, len(c.urls))
+	targets = append(targets, c.urls...)
+	for _, sd := range c.fileSD {
+		targets = append(targets, sd.refresh(c.logger)...)
+	}
+	if c.localSD != nil {
+		targets = append(targets, c.localSD.refresh(ctx, c.logger)...)
+	}
+	return targets
+}
+
+// scrapeAll scrapes all URLs concurrently (each URL no more frequently than
+// its TTL) and returns the combined metrics, including the scrape metrics
+// (up, duration, last success) for each URL.
+func (c *Prom) scrapeAll(ctx context.Context, targets []URLDef) cgm.Metrics {
+	c.pruneScrapeStates(targets)
+
+	c.Lock()
+	flushes := c.flushes
+	c.Unlock()
+
+	var wg sync.WaitGroup
+	states := make([]*scrapeState, len(targets))
+	for i, u := range targets {
+		states[i] = c.getScrapeState(u)
+		wg.Add(1)
+		go func(u URLDef, st *scrapeState) {
+			defer wg.Done()
+			st.flushed(flushes)
+			c.scrape(ctx, u, st)
+		}(u, states[i])
+	}
+	wg.Wait()
+
+	metrics := cgm.Metrics{}
+	for i, u := range targets {
+		st := states[i]
+		for mn, mv := range st.metrics {
+			metrics[mn] = mv
+		}
+		// histograms are the samples since the last flush, once flushed the
+		// baseline moves to the bins they were calculated from (see flushed)
+		for mn, mv := range st.histograms {
+			metrics[mn] = mv
+		}
+		st.emitted, st.emittedCrtd = nil, nil
+		if st.histograms != nil {
+			st.emitted, st.emittedCrtd = st.hists, st.created
+		}
+		c.addScrapeMetrics(&metrics, u, st)
+	}
+
+	return metrics
+}
+
+// pruneScrapeStates removes the state of URLs which are no longer targets (e.g. removed from a target file).
+func (c *Prom) pruneScrapeStates(targets []URLDef) {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.scrapes) == 0 {
+		return
+	}
+	current := make(map[string]bool, len(targets))
+	for _, u := range targets {
+		current[scrapeKey(u)] = true
+	}
+	for key := range c.scrapes {
+		if !current[key] {
+			delete(c.scrapes, key)
+		}
+	}
+}
+
+// scrape fetches metrics from a URL if its TTL has expired.
+func (c *Prom) scrape(ctx context.Context, u URLDef, st *scrapeState) {
+	if !st.lastScrape.IsZero() && u.uttl > time.Duration(0) && time.Since(st.lastScrape) < u.uttl {
+		c.logger.Debug().Str("id", u.ID).Str("url", u.URL).Msg("ttl not expired, using last scrape")
+		return
+	}
+
+	c.logger.Debug().Str("id", u.ID).Str("url", u.URL).Msg("prom fetch request")
+
+	start := time.Now()
+	metrics := cgm.Metrics{}
+	err := c.fetchPromMetrics(ctx, u, st, &metrics)
+
+	st.lastScrape = start
+	st.duration = time.Since(start)
+	st.lastError = err
+	if err != nil {
+		c.logger.Error().Err(err).Str("id", u.ID).Str("url", u.URL).Msg("fetching prom metrics")
+		// do not keep forwarding metrics from a target which is down, up=0 indicates the failure
+		st.up = false
+		st.metrics = cgm.Metrics{}
+		st.histograms = nil
+		return
+	}
+
+	st.up = true
+	st.lastSuccess = time.Now()
+	st.metrics = cgm.Metrics{}
+	st.histograms = cgm.Metrics{}
+	for mn, mv := range metrics {
+		if mv.Type == histogramType {
+			st.histograms[mn] = mv
+			continue
+		}
+		st.metrics[mn] = mv
+	}
+}
+
+// addScrapeMetrics adds the scrape health metrics for a URL.
+func (c *Prom) addScrapeMetrics(metrics *cgm.Metrics, u URLDef, st *scrapeState) {
+	urlTags := c.getLabels(u.Labels)
+	urlTags = append(urlTags, tags.Tag{Category: "prom_id", Value: u.ID})
+
+	up := uint32(0)
+	if st.up {
+		up = 1
+	}
+	_ = c.addMetric(metrics, "", "up", urlTags, "I", up)
+
+	secTags := append(tags.Tags{tags.Tag{Category: "units", Value: "seconds"}}, urlTags...)
+	_ = c.addMetric(metrics, "", "scrape_duration", secTags, "n", st.duration.Seconds())
+	if !st.lastSuccess.IsZero() {
+		_ = c.addMetric(metrics, "", "last_success_timestamp", secTags, "L", uint64(st.lastSuccess.Unix()))
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/rs/zerolog"
+)
+
+func newTestProm(urls ...URLDef) *Prom {
+	return &Prom{
+		urls:            urls,
+		metricNameRegex: regexp.MustCompile("[\r\n\"']"),
+	}
+}
+
+func scrapeMetricName(name, id string, extra ...tags.Tag) string {
+	tagList := cgm.Tags{
+		cgm.Tag{Category: "collector", Value: "promfetch"},
+		cgm.Tag{Category: "prom_id", Value: id},
+		cgm.Tag{Category: "source", Value: "circonus-agent"},
+	}
+	tagList = append(tagList, extra...)
+	return tags.MetricNameWithStreamTags(name, tagList)
+}
+
+func TestScrapeTTL(t *testing.T) {
+	t.Log("Testing per URL ttl")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fmt.Fprintln(w, "test 1234")
+	}))
+	defer ts.Close()
+
+	c := newTestProm(
+		URLDef{ID: "cached", URL: ts.URL, uttl: time.Minute, timeout: time.Second},
+		URLDef{ID: "always", URL: ts.URL + "/always", uttl: time.Nanosecond, timeout: time.Second},
+	)
+
+	for i := 0; i < 3; i++ {
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		m := c.Flush()
+		if _, ok := m[scrapeMetricName("test", "cached")]; !ok {
+			t.Fatalf("run %d expected cached metric, %#v", i, m)
+		}
+	}
+
+	// 1 for cached, 3 for always
+	if n := atomic.LoadInt32(&hits); n != 4 {
+		t.Fatalf("expected 4 requests, got %d", n)
+	}
+}
+
+func TestScrapeConcurrent(t *testing.T) {
+	t.Log("Testing concurrent scraping")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	delay := 200 * time.Millisecond
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		fmt.Fprintln(w, "test 1234")
+	}))
+	defer ts.Close()
+
+	var urls []URLDef
+	for i := 0; i < 5; i++ {
+		urls = append(urls, URLDef{ID: fmt.Sprintf("u%d", i), URL: ts.URL, uttl: time.Nanosecond, timeout: time.Second})
+	}
+	c := newTestProm(urls...)
+
+	start := time.Now()
+	if err := c.Collect(context.Background()); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	if d := time.Since(start); d >= 2*delay {
+		t.Fatalf("expected concurrent scrapes, took %s", d)
+	}
+
+	m := c.Flush()
+	for _, u := range urls {
+		if _, ok := m[scrapeMetricName("test", u.ID)]; !ok {
+			t.Fatalf("expected metric for %s", u.ID)
+		}
+	}
+}
+
+func TestScrapeUp(t *testing.T) {
+	t.Log("Testing up/last success metrics")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	var fail int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "test 1234")
+	}))
+	defer ts.Close()
+
+	c := newTestProm(URLDef{ID: "foo", URL: ts.URL, uttl: time.Nanosecond, timeout: time.Second})
+	upName := scrapeMetricName("up", "foo")
+	lastName := scrapeMetricName("last_success_timestamp", "foo", tags.Tag{Category: "units", Value: "seconds"})
+	durName := scrapeMetricName("scrape_duration", "foo", tags.Tag{Category: "units", Value: "seconds"})
+
+	t.Log("up")
+	{
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		m := c.Flush()
+		if v, ok := m[upName]; !ok || v.Value.(uint32) != 1 {
+			t.Fatalf("expected up 1, got %#v", m[upName])
+		}
+		if _, ok := m[lastName]; !ok {
+			t.Fatal("expected last success")
+		}
+		if _, ok := m[durName]; !ok {
+			t.Fatal("expected scrape duration")
+		}
+	}
+
+	t.Log("down")
+	{
+		atomic.StoreInt32(&fail, 1)
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		m := c.Flush()
+		if v, ok := m[upName]; !ok || v.Value.(uint32) != 0 {
+			t.Fatalf("expected up 0, got %#v", m[upName])
+		}
+		if _, ok := m[lastName]; !ok {
+			t.Fatal("expected last success from previous scrape")
+		}
+		if _, ok := m[scrapeMetricName("test", "foo")]; ok {
+			t.Fatal("expected no metrics from down target")
+		}
+	}
+}
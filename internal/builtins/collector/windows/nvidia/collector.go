@@ -42,6 +42,13 @@ func (c *common) Flush() cgm.Metrics {
 	return *metrics
 }
 
+// Snapshot returns the metrics accumulated since the last flush, without resetting them.
+func (c *common) Snapshot() cgm.Metrics {
+	c.Lock()
+	defer c.Unlock()
+	return *c.metrics.FlushMetricsNoReset()
+}
+
 // ID returns id of collector.
 func (c *common) ID() string {
 	c.Lock()
@@ -44,6 +44,17 @@ func (c *wmicommon) Flush() cgm.Metrics {
 	return c.lastMetrics
 }
 
+// Snapshot returns a copy of the last metrics collected.
+func (c *wmicommon) Snapshot() cgm.Metrics {
+	c.Lock()
+	defer c.Unlock()
+	metrics := make(cgm.Metrics, len(c.lastMetrics))
+	for mn, mv := range c.lastMetrics {
+		metrics[mn] = mv
+	}
+	return metrics
+}
+
 // ID returns id of collector.
 func (c *wmicommon) ID() string {
 	c.Lock()
@@ -14,6 +14,7 @@ import (
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector/generic"
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector/linux/procfs"
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector/linux/systemd"
 	appstats "github.com/maier/go-appstats"
 	"github.com/rs/zerolog/log"
 )
@@ -38,6 +39,20 @@ func (b *Builtins) configure(ctx context.Context) error {
 		}
 	}
 
+	{
+		// Systemd
+		l.Debug().Msg("calling systemd.New")
+		collectors, err := systemd.New(ctx)
+		if err != nil {
+			return fmt.Errorf("systemd collectors: %w", err)
+		}
+		for _, c := range collectors {
+			b.logger.Info().Str("id", c.ID()).Msg("enabled systemd builtin")
+			b.collectors[c.ID()] = c
+			_ = appstats.IncrementInt("builtins.total")
+		}
+	}
+
 	{
 		// PSUtils
 		// NOTE: psutils does not use the same metric names nor does it expose
@@ -145,6 +145,18 @@ func (cb *Bundle) CID() (string, error) {
 	return "", ErrUninitialized
 }
 
+// Status returns the check bundle status (e.g. active).
+func (cb *Bundle) Status() (string, error) {
+	cb.Lock()
+	defer cb.Unlock()
+
+	if cb.bundle != nil {
+		return cb.bundle.Status, nil
+	}
+
+	return "", ErrUninitialized
+}
+
 // Period returns check bundle period (intetrval between when broker should make requests).
 func (cb *Bundle) Period() (uint, error) {
 	cb.Lock()
@@ -0,0 +1,218 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package bundle
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+)
+
+// metric filter rule types.
+const (
+	filterAllow = "allow"
+	filterDeny  = "deny"
+	filterTags  = "tags" // [type, regex, "tags", tag filter, comment]
+)
+
+var (
+	errInvalidFilterRule = fmt.Errorf(`invalid metric filter rule, expected [allow|deny, regex, comment] or [allow|deny, regex, "tags", tag filter, comment]`)
+	errInvalidTagFilter  = fmt.Errorf("invalid tag filter")
+)
+
+// MetricFilterRuleResult is the evaluation of a metric filter rule.
+type MetricFilterRuleResult struct {
+	Filter []string `json:"filter"`
+	Error  string   `json:"error,omitempty"`
+	Index  int      `json:"index"`
+	Match  bool     `json:"match"`
+}
+
+// MetricFilterResult explains whether a metric is allowed by the metric filters.
+// Rules are evaluated in order, the first matching rule allows or denies the
+// metric. A metric not matching any rule is denied.
+type MetricFilterResult struct {
+	Metric  string                   `json:"metric"`
+	Reason  string                   `json:"reason"`
+	Filters [][]string               `json:"filters"`
+	Rules   []MetricFilterRuleResult `json:"rules"` // rules evaluated, up to the first match
+	Allowed bool                     `json:"allowed"`
+}
+
+// TestMetricFilters evaluates a metric name (with stream tags, if any) against
+// the configured metric filters (see getMetricFilters).
+func (cb *Bundle) TestMetricFilters(metricName string) (*MetricFilterResult, error) {
+	filters, err := cb.getMetricFilters()
+	if err != nil {
+		return nil, fmt.Errorf("getting metric filters: %w", err)
+	}
+
+	return evalMetricFilters(filters, metricName), nil
+}
+
+// evalMetricFilters evaluates a metric name against metric filter rules,
+// [type, regex, comment] or [type, regex, "tags", tag filter, comment]. The
+// regex is matched against the base metric name, the tag filter against the
+// stream tags.
+func evalMetricFilters(filters [][]string, metricName string) *MetricFilterResult {
+	res := &MetricFilterResult{
+		Metric:  metricName,
+		Filters: filters,
+		Rules:   []MetricFilterRuleResult{},
+	}
+
+	name, mtags := tags.ParseMetricName(metricName)
+
+	for i, rule := range filters {
+		rr := MetricFilterRuleResult{Index: i, Filter: rule}
+		match, err := matchFilterRule(rule, name, mtags)
+		if err != nil {
+			rr.Error = err.Error()
+		}
+		rr.Match = match
+		res.Rules = append(res.Rules, rr)
+		if !match {
+			continue
+		}
+		res.Allowed = strings.EqualFold(rule[0], filterAllow)
+		if res.Allowed {
+			res.Reason = fmt.Sprintf("allowed by rule %d", i)
+		} else {
+			res.Reason = fmt.Sprintf("denied by rule %d", i)
+		}
+		return res
+	}
+
+	res.Reason = "no rule matched, metric not collected"
+	return res
+}
+
+// matchFilterRule returns true if the rule's regex matches the metric name and
+// the rule's tag filter (if any) matches the metric's stream tags.
+func matchFilterRule(rule []string, name string, mtags tags.Tags) (bool, error) {
+	if len(rule) < 2 {
+		return false, errInvalidFilterRule
+	}
+	switch strings.ToLower(rule[0]) {
+	case filterAllow, filterDeny:
+	default:
+		return false, fmt.Errorf("type (%s): %w", rule[0], errInvalidFilterRule)
+	}
+
+	rx, err := regexp.Compile(rule[1])
+	if err != nil {
+		return false, fmt.Errorf("regex (%s): %w", rule[1], err)
+	}
+	if !rx.MatchString(name) {
+		return false, nil
+	}
+
+	// the third element is a comment, unless it is "tags" followed by a tag filter
+	if len(rule) < 4 || !strings.EqualFold(rule[2], filterTags) || strings.TrimSpace(rule[3]) == "" {
+		return true, nil
+	}
+
+	return matchTagFilter(strings.TrimSpace(rule[3]), mtags)
+}
+
+// matchTagFilter evaluates a tag filter, and(...), or(...), not(...) or a
+// category[:value] term (value may contain * wildcards), against tags.
+func matchTagFilter(filter string, mtags tags.Tags) (bool, error) {
+	lf := strings.ToLower(filter)
+	for _, op := range []string{"and", "or", "not"} {
+		if !strings.HasPrefix(lf, op+"(") {
+			continue
+		}
+		if !strings.HasSuffix(filter, ")") {
+			return false, fmt.Errorf("%s: %w", filter, errInvalidTagFilter)
+		}
+		args, err := splitTagFilterArgs(filter[len(op)+1 : len(filter)-1])
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", filter, err)
+		}
+		if op == "not" && len(args) != 1 {
+			return false, fmt.Errorf("%s: %w", filter, errInvalidTagFilter)
+		}
+		for _, arg := range args {
+			match, err := matchTagFilter(arg, mtags)
+			if err != nil {
+				return false, err
+			}
+			switch {
+			case op == "not":
+				return !match, nil
+			case op == "and" && !match:
+				return false, nil
+			case op == "or" && match:
+				return true, nil
+			}
+		}
+		return op == "and", nil
+	}
+
+	if strings.ContainsAny(filter, "(),") {
+		return false, fmt.Errorf("%s: %w", filter, errInvalidTagFilter)
+	}
+
+	tp := strings.SplitN(filter, tags.Delimiter, 2)
+	category := tp[0]
+	value := "*"
+	if len(tp) == 2 {
+		value = tp[1]
+	}
+	if category == "" {
+		return false, fmt.Errorf("%s: %w", filter, errInvalidTagFilter)
+	}
+	valueRx, err := regexp.Compile("^" + strings.ReplaceAll(regexp.QuoteMeta(value), `\*`, ".*") + "$")
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", filter, err)
+	}
+
+	for _, t := range mtags {
+		if strings.EqualFold(t.Category, category) && valueRx.MatchString(t.Value) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// splitTagFilterArgs splits the comma separated arguments of a tag filter
+// operator, commas in nested operators are not split.
+func splitTagFilterArgs(s string) ([]string, error) {
+	var args []string
+	depth := 0
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errInvalidTagFilter
+			}
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errInvalidTagFilter
+	}
+	args = append(args, strings.TrimSpace(s[start:]))
+	for _, arg := range args {
+		if arg == "" {
+			return nil, errInvalidTagFilter
+		}
+	}
+
+	return args, nil
+}
@@ -0,0 +1,168 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package bundle
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestEvalMetricFilters(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	filters := [][]string{
+		{"deny", "^$", "empty"},
+		{"deny", "^cpu`", "tags", "env:dev", "no dev cpu"},
+		{"allow", "^cpu`", "cpu"},
+		{"allow", "^disk`", "tags", "and(device:sd*,not(mount:/boot))", ""},
+		{"allow", "^net`", "tags", "or(iface:eth0,iface:eth1)", "eth0/1 only"},
+	}
+
+	tests := []struct {
+		name        string
+		metric      string
+		wantReason  string
+		wantRules   int
+		wantAllowed bool
+	}{
+		{name: "empty name", metric: "", wantAllowed: false, wantRules: 1, wantReason: "denied by rule 0"},
+		{name: "deny tag", metric: "cpu`idle|ST[env:dev]", wantAllowed: false, wantRules: 2, wantReason: "denied by rule 1"},
+		{name: "allow", metric: "cpu`idle|ST[env:prod]", wantAllowed: true, wantRules: 3, wantReason: "allowed by rule 2"},
+		{name: "and/not match", metric: "disk`used|ST[device:sda,mount:/]", wantAllowed: true, wantRules: 4, wantReason: "allowed by rule 3"},
+		{name: "and/not no match", metric: "disk`used|ST[device:sda,mount:/boot]", wantAllowed: false, wantRules: 5, wantReason: "no rule matched, metric not collected"},
+		{name: "or match", metric: "net`in|ST[iface:eth1]", wantAllowed: true, wantRules: 5, wantReason: "allowed by rule 4"},
+		{name: "no match", metric: "mem`used", wantAllowed: false, wantRules: 5, wantReason: "no rule matched, metric not collected"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			res := evalMetricFilters(filters, tt.metric)
+			if res.Allowed != tt.wantAllowed {
+				t.Errorf("evalMetricFilters() allowed = %v, want %v", res.Allowed, tt.wantAllowed)
+			}
+			if res.Reason != tt.wantReason {
+				t.Errorf("evalMetricFilters() reason = %q, want %q", res.Reason, tt.wantReason)
+			}
+			if len(res.Rules) != tt.wantRules {
+				t.Errorf("evalMetricFilters() rules = %d, want %d", len(res.Rules), tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestMatchFilterRule(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	tests := []struct {
+		name      string
+		rule      []string
+		metric    string
+		wantMatch bool
+		wantErr   bool
+	}{
+		{name: "short rule", rule: []string{"allow"}, metric: "foo", wantErr: true},
+		{name: "invalid type", rule: []string{"permit", "^foo$"}, metric: "foo", wantErr: true},
+		{name: "invalid regex", rule: []string{"allow", "^foo("}, metric: "foo", wantErr: true},
+		{name: "invalid tag filter", rule: []string{"allow", "^foo$", "tags", "and(a:b", ""}, metric: "foo|ST[a:b]", wantErr: true},
+		{name: "invalid not", rule: []string{"allow", "^foo$", "tags", "not(a:b,c:d)", ""}, metric: "foo|ST[a:b]", wantErr: true},
+		{name: "no tag filter", rule: []string{"allow", "^foo$"}, metric: "foo|ST[a:b]", wantMatch: true},
+		{name: "comment", rule: []string{"allow", "^foo$", "a:c"}, metric: "foo|ST[a:b]", wantMatch: true},
+		{name: "comment, tags", rule: []string{"allow", "^foo$", "tags"}, metric: "foo|ST[a:b]", wantMatch: true},
+		{name: "category only", rule: []string{"allow", "^foo$", "tags", "a", ""}, metric: "foo|ST[a:b]", wantMatch: true},
+		{name: "category case", rule: []string{"allow", "^foo$", "tags", "A:b", ""}, metric: "foo|ST[a:b]", wantMatch: true},
+		{name: "value glob", rule: []string{"allow", "^foo$", "tags", "a:b*"}, metric: "foo|ST[a:bar]", wantMatch: true},
+		{name: "value mismatch", rule: []string{"allow", "^foo$", "tags", "a:c", ""}, metric: "foo|ST[a:b]", wantMatch: false},
+		{name: "name mismatch", rule: []string{"deny", "^bar$"}, metric: "foo", wantMatch: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			res := evalMetricFilters([][]string{tt.rule}, tt.metric)
+			if len(res.Rules) != 1 {
+				t.Fatalf("expected 1 rule result, got %d", len(res.Rules))
+			}
+			rr := res.Rules[0]
+			if (rr.Error != "") != tt.wantErr {
+				t.Errorf("rule error = %q, wantErr %v", rr.Error, tt.wantErr)
+			}
+			if rr.Match != tt.wantMatch {
+				t.Errorf("rule match = %v, want %v", rr.Match, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestTestMetricFilters(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	cb := &Bundle{}
+
+	t.Log("default filters")
+	{
+		viper.Reset()
+		res, err := cb.TestMetricFilters("foo")
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if !res.Allowed {
+			t.Fatalf("expected allowed (%s)", res.Reason)
+		}
+	}
+
+	t.Log("configured filters")
+	{
+		viper.Reset()
+		viper.Set(config.KeyCheckMetricFilters, `[["allow","^foo$","foo"]]`)
+		res, err := cb.TestMetricFilters("bar")
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if res.Allowed {
+			t.Fatal("expected denied")
+		}
+		if len(res.Filters) != 1 {
+			t.Fatalf("expected 1 filter, got %d", len(res.Filters))
+		}
+	}
+
+	t.Log("example filter file")
+	{
+		viper.Reset()
+		viper.Set(config.KeyCheckMetricFilterFile, filepath.Join("..", "..", "..", "etc", "example_metric_filters.json"))
+		res, err := cb.TestMetricFilters("cpu`idle|ST[env:prod]")
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if !res.Allowed || res.Reason != "allowed by rule 1" {
+			t.Fatalf("expected allowed by rule 1 (%s)", res.Reason)
+		}
+		for _, rr := range res.Rules {
+			if rr.Error != "" {
+				t.Fatalf("unexpected rule %d error (%s)", rr.Index, rr.Error)
+			}
+		}
+		if res, err = cb.TestMetricFilters(""); err != nil || res.Allowed {
+			t.Fatalf("expected empty name denied (%v)", err)
+		}
+	}
+
+	t.Log("invalid filters")
+	{
+		viper.Reset()
+		viper.Set(config.KeyCheckMetricFilters, `[["allow"`)
+		if _, err := cb.TestMetricFilters("foo"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	viper.Reset()
+}
@@ -9,6 +9,7 @@
 package bundle
 
 import (
+	"context"
 	"strings"
 
 	"github.com/circonus-labs/circonus-agent/internal/config"
@@ -37,7 +38,9 @@ func (cb *Bundle) getHostTags() []string {
 		}
 	}
 
-	hi, err := host.Info()
+	// in host mode (e.g. agent in a container) platform and kernel info
+	// are read from the configured host_etc/host_proc/host_sys mounts
+	hi, err := host.InfoWithContext(config.HostContext(context.Background()))
 	if err != nil {
 		cb.logger.Warn().Err(err).Msg("unable to get host info for check tags")
 		return tags
@@ -67,6 +67,7 @@ const (
 
 var (
 	errCheckNotInitialized = fmt.Errorf("check not initialized")
+	errCheckNotActive      = fmt.Errorf("check not active")
 )
 
 type ErrNoOwnerFound struct {
@@ -276,6 +277,52 @@ func (c *Check) CheckPeriod() (uint, error) {
 	return period, nil
 }
 
+// Health returns the check and check bundle status, for readiness. An error is
+// returned if the check is not initialized or the check (bundle) is not active.
+func (c *Check) Health() (string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.client == nil {
+		return "check management disabled", nil
+	}
+	if c.checkConfig == nil || c.checkBundle == nil {
+		return "", errCheckNotInitialized
+	}
+
+	status, err := c.checkBundle.Status()
+	if err != nil {
+		return "", fmt.Errorf("check bundle status: %w", err)
+	}
+
+	detail := fmt.Sprintf("check %s, bundle %s (%s)", c.checkConfig.CID, c.checkConfig.CheckBundleCID, status)
+	if !c.checkConfig.Active || (status != "" && status != StatusActive) {
+		return detail, errCheckNotActive
+	}
+
+	return detail, nil
+}
+
+// TestMetricFilters evaluates a metric name against the configured metric
+// filters, explaining whether the metric would be collected. The configured
+// filters are used even if check management is disabled.
+func (c *Check) TestMetricFilters(metricName string) (*bundle.MetricFilterResult, error) {
+	c.Lock()
+	cb := c.checkBundle
+	c.Unlock()
+
+	if cb == nil {
+		cb = &bundle.Bundle{}
+	}
+
+	res, err := cb.TestMetricFilters(metricName)
+	if err != nil {
+		return nil, fmt.Errorf("test metric filters: %w", err)
+	}
+
+	return res, nil
+}
+
 // RefreshReverseConfig refreshes the check, broker and broker tls configurations.
 func (c *Check) RefreshReverseConfig() error {
 	if err := c.FetchCheckConfig(); err != nil {
@@ -11,6 +11,7 @@ import (
 
 	"github.com/circonus-labs/circonus-agent/internal/check/bundle"
 	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/go-apiclient"
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 )
@@ -71,3 +72,36 @@ func TestCheck_CheckMeta(t *testing.T) {
 		})
 	}
 }
+
+func TestCheck_Health(t *testing.T) {
+	tests := []struct {
+		client      API
+		checkConfig *apiclient.Check
+		checkBundle *bundle.Bundle
+		name        string
+		want        string
+		wantErr     bool
+	}{
+		{name: "check management disabled", want: "check management disabled"},
+		{name: "not initialized", client: &APIMock{}, wantErr: true},
+		{name: "checkbundle (nil bundle)", client: &APIMock{}, checkConfig: &apiclient.Check{Active: true}, checkBundle: &bundle.Bundle{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Check{
+				client:      tt.client,
+				checkConfig: tt.checkConfig,
+				checkBundle: tt.checkBundle,
+			}
+			got, err := c.Health()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check.Health() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Check.Health() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
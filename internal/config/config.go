@@ -32,6 +32,11 @@ type API struct {
 	URL    string `json:"url" yaml:"url" toml:"url"`
 }
 
+// APIAuth defines the running config.api_auth structure.
+type APIAuth struct {
+	File string `json:"file" yaml:"file" toml:"file"`
+}
+
 // ReverseCreateCheckOptions defines the running config.reverse.check structure.
 type ReverseCreateCheckOptions struct {
 	Broker string `json:"broker" yaml:"broker" toml:"broker"`
@@ -73,12 +78,23 @@ type Reverse struct {
 	MaxConnRetry int    `mapstructure:"max_conn_retry" json:"max_conn_retry" yaml:"max_conn_retry" toml:"max_conn_retry"`
 }
 
+// Server defines the running config.server structure.
+type Server struct {
+	MetricsCacheTTL  string `mapstructure:"metrics_cache_ttl" json:"metrics_cache_ttl" toml:"metrics_cache_ttl" yaml:"metrics_cache_ttl"`
+	ResponseCacheTTL string `mapstructure:"response_cache_ttl" json:"response_cache_ttl" toml:"response_cache_ttl" yaml:"response_cache_ttl"`
+	DrainOwner       string `mapstructure:"drain_owner" json:"drain_owner" toml:"drain_owner" yaml:"drain_owner"`
+	DisableGzip      bool   `mapstructure:"disable_gzip" json:"disable_gzip" toml:"disable_gzip" yaml:"disable_gzip"`
+}
+
 // SSL defines the running config.ssl structure.
 type SSL struct {
-	CertFile string `mapstructure:"cert_file" json:"cert_file" yaml:"cert_file" toml:"cert_file"`
-	KeyFile  string `mapstructure:"key_file" json:"key_file" yaml:"key_file" toml:"key_file"`
-	Listen   string `json:"listen" yaml:"listen" toml:"listen"`
-	Verify   bool   `json:"verify" yaml:"verify" toml:"verify"`
+	CertFile     string   `mapstructure:"cert_file" json:"cert_file" yaml:"cert_file" toml:"cert_file"`
+	ClientAuth   string   `mapstructure:"client_auth" json:"client_auth" yaml:"client_auth" toml:"client_auth"`
+	ClientCAFile string   `mapstructure:"client_ca_file" json:"client_ca_file" yaml:"client_ca_file" toml:"client_ca_file"`
+	KeyFile      string   `mapstructure:"key_file" json:"key_file" yaml:"key_file" toml:"key_file"`
+	Listen       string   `json:"listen" yaml:"listen" toml:"listen"`
+	ClientAllow  []string `mapstructure:"client_allow" json:"client_allow" yaml:"client_allow" toml:"client_allow"`
+	Verify       bool     `json:"verify" yaml:"verify" toml:"verify"`
 }
 
 // StatsDHost defines the running config.statsd.host structure.
@@ -119,12 +135,14 @@ type Config struct {
 	DebugDumpMetrics string     `mapstructure:"debug_dump_metrics" json:"debug_dump_metrics" yaml:"debug_dump_metrics" toml:"debug_dump_metrics"`
 	PluginDir        string     `mapstructure:"plugin_dir" json:"plugin_dir" yaml:"plugin_dir" toml:"plugin_dir"`
 	PluginTTLUnits   string     `mapstructure:"plugin_ttl_units" json:"plugin_ttl_units" yaml:"plugin_ttl_units" toml:"plugin_ttl_units"`
+	ShutdownTimeout  string     `mapstructure:"shutdown_timeout" json:"shutdown_timeout" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
 	HostProc         string     `mapstructure:"host_proc" json:"host_proc" toml:"host_proc" yaml:"host_proc"`
 	HostSys          string     `mapstructure:"host_sys" json:"host_sys" toml:"host_sys" yaml:"host_sys"`
 	HostEtc          string     `mapstructure:"host_etc" json:"host_etc" toml:"host_etc" yaml:"host_etc"`
 	HostVar          string     `mapstructure:"host_var" json:"host_var" toml:"host_var" yaml:"host_var"`
 	HostRun          string     `mapstructure:"host_run" json:"host_run" toml:"host_run" yaml:"host_run"`
 	API              API        `json:"api" yaml:"api" toml:"api"`
+	APIAuth          APIAuth    `mapstructure:"api_auth" json:"api_auth" yaml:"api_auth" toml:"api_auth"`
 	SSL              SSL        `json:"ssl" yaml:"ssl" toml:"ssl"`
 	Collectors       []string   `json:"collectors" yaml:"collectors" toml:"collectors"`
 	Listen           []string   `json:"listen" yaml:"listen" toml:"listen"`
@@ -134,6 +152,7 @@ type Config struct {
 	StatsD           StatsD     `json:"statsd" yaml:"statsd" toml:"statsd"`
 	MultiAgent       MultiAgent `mapstructure:"multi_agent" json:"multi_agent" toml:"multi_agent" yaml:"multi_agent"`
 	Reverse          Reverse    `json:"reverse" yaml:"reverse" toml:"reverse"`
+	Server           Server     `json:"server" yaml:"server" toml:"server"`
 	Check            Check      `json:"check" yaml:"check" toml:"check"`
 	Thresholds       Thresholds `mapstructure:"thresholds" json:"thresholds" toml:"thresholds" yaml:"thresholds"`
 	Debug            bool       `json:"debug" yaml:"debug" toml:"debug"`
@@ -155,6 +174,10 @@ const (
 	// KeyAPIURL custom circonus api url (e.g. inside).
 	KeyAPIURL = "api.url"
 
+	// KeyAPIAuthFile configuration file (json|toml|yaml) with the bearer tokens
+	// and client certificate subjects, and their scopes, allowed to use the agent api.
+	KeyAPIAuthFile = "api_auth.file"
+
 	// KeyDebug enables debug messages.
 	KeyDebug = "debug"
 	// KeyDebugCGM enables debug messages for circonus-gometrics.
@@ -212,6 +235,10 @@ const (
 	// KeyReverseMaxConnRetry how many times to retry a persistently failing broker connection. default 10, -1 = indefinitely.
 	KeyReverseMaxConnRetry = "reverse.max_conn_retry"
 
+	// KeyShutdownTimeout how long to wait for in-flight requests, plugins and final
+	// submissions when stopping the agent.
+	KeyShutdownTimeout = "shutdown_timeout"
+
 	// KeyShowConfig - show configuration and exit.
 	KeyShowConfig = "show-config"
 
@@ -221,6 +248,15 @@ const (
 	// KeySSLCertFile pem certificate file for SSL.
 	KeySSLCertFile = "ssl.cert_file"
 
+	// KeySSLClientAllow allowlist of client certificate subjects (CN or SAN), empty allows any verified client.
+	KeySSLClientAllow = "ssl.client_allow"
+
+	// KeySSLClientAuth client certificate verification (optional|require).
+	KeySSLClientAuth = "ssl.client_auth"
+
+	// KeySSLClientCAFile CA bundle used to verify client certificates.
+	KeySSLClientCAFile = "ssl.client_ca_file"
+
 	// KeySSLKeyFile key for ssl.cert_file.
 	KeySSLKeyFile = "ssl.key_file"
 
@@ -291,6 +327,15 @@ const (
 	// KeyDisableGzip disables gzip on http responses.
 	KeyDisableGzip = "server.disable_gzip"
 
+	// KeyMetricsCacheTTL how long metrics flushed by /run are served from cache by /metrics.
+	KeyMetricsCacheTTL = "server.metrics_cache_ttl"
+
+	// KeyResponseCacheTTL how long an encoded /run response is shared with identical requests.
+	KeyResponseCacheTTL = "server.response_cache_ttl"
+
+	// KeyDrainOwner consumer (any|run|metrics|multiagent) which drains accumulated metrics.
+	KeyDrainOwner = "server.drain_owner"
+
 	// KeyCheckBundleID the check bundle id to use.
 	KeyCheckBundleID = "check.bundle_id"
 
@@ -413,8 +458,7 @@ func StatConfig() error {
 		return err
 	}
 
-	cfg.API.Key = "..."
-	cfg.API.App = "..."
+	redactConfig(cfg)
 
 	expvar.Publish("config", expvar.Func(func() interface{} {
 		return &cfg
@@ -423,6 +467,52 @@ func StatConfig() error {
 	return nil
 }
 
+// redactConfig replaces secrets (circonus api token key and app) in the configuration.
+func redactConfig(cfg *Config) {
+	if cfg.API.Key != "" {
+		cfg.API.Key = "..."
+	}
+	if cfg.API.App != "" {
+		cfg.API.App = "..."
+	}
+}
+
+// RedactedConfig returns the running configuration, with secrets redacted,
+// in the requested format (json|toml|yaml).
+func RedactedConfig(format string) ([]byte, error) {
+	cfg, err := getConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	redactConfig(cfg)
+
+	return formatConfig(cfg, format)
+}
+
+// formatConfig encodes the configuration in the format (json|toml|yaml).
+func formatConfig(cfg *Config, format string) ([]byte, error) {
+	var data []byte
+	var err error
+
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(cfg, " ", "  ")
+	case "yaml":
+		data, err = yaml.Marshal(cfg)
+	case "toml":
+		data, err = toml.Marshal(*cfg)
+	default:
+		return nil, fmt.Errorf("unknown config format '%s'", format) //nolint:goerr113
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("formatting config (%s): %w", format, err)
+	}
+
+	return data, nil
+}
+
 // getConfig dumps the current configuration and returns it.
 func getConfig() (*Config, error) {
 	var cfg *Config
@@ -436,11 +526,7 @@ func getConfig() (*Config, error) {
 
 // ShowConfig prints the running configuration.
 func ShowConfig(w io.Writer) error {
-	var cfg *Config
-	var err error
-	var data []byte
-
-	cfg, err = getConfig()
+	cfg, err := getConfig()
 	if err != nil {
 		return err
 	}
@@ -449,19 +535,9 @@ func ShowConfig(w io.Writer) error {
 
 	// log.Debug().Str("format", format).Msg("show-config")
 
-	switch format {
-	case "json":
-		data, err = json.MarshalIndent(cfg, " ", "  ")
-	case "yaml":
-		data, err = yaml.Marshal(cfg)
-	case "toml":
-		data, err = toml.Marshal(*cfg)
-	default:
-		return fmt.Errorf("unknown config format '%s'", format) //nolint:goerr113
-	}
-
+	data, err := formatConfig(cfg, format)
 	if err != nil {
-		return fmt.Errorf("formatting config (%s): %w", format, err)
+		return err
 	}
 
 	fmt.Fprintln(w, string(data))
@@ -37,6 +37,9 @@ const (
 	// SSLVerify enabled by default.
 	SSLVerify = true
 
+	// SSLClientAuth verify client certificates if presented (when a client CA file is set).
+	SSLClientAuth = "optional"
+
 	// NoStatsd enabled by default.
 	NoStatsd = false
 
@@ -111,6 +114,22 @@ const (
 	// DisableGzip disables gzip compression on responses.
 	DisableGzip = false
 
+	// ShutdownTimeout defines how long to wait for in-flight requests, plugins
+	// and final submissions when stopping the agent.
+	ShutdownTimeout = "30s"
+
+	// MetricsCacheTTL defines how long metrics flushed by /run are served by /metrics
+	// before metrics are collected on demand.
+	MetricsCacheTTL = "2m"
+
+	// ResponseCacheTTL defines how long an encoded /run response is shared with identical
+	// requests, by default only concurrent requests share a response.
+	ResponseCacheTTL = "0"
+
+	// DrainOwner defines the consumer which drains accumulated (receiver, statsd, prometheus)
+	// metrics, other consumers get a copy. "any" - every consumer drains.
+	DrainOwner = "any"
+
 	// CheckEnableNewMetrics toggles enabling new metrics.
 	CheckEnableNewMetrics = false
 	// CheckMetricRefreshTTL determines how often to refresh check bundle metrics from API.
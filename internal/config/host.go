@@ -0,0 +1,152 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/rs/zerolog/log"
+	gopsutil "github.com/shirou/gopsutil/v3/common"
+	"github.com/spf13/viper"
+)
+
+var errNoHostname = fmt.Errorf("no hostname found")
+
+// hostPaths maps the host path config keys to the gopsutil environment
+// variables and the default (non-container) paths.
+var hostPaths = []struct {
+	key    string
+	envKey gopsutil.EnvKeyType
+	dflt   string
+}{
+	{key: KeyHostProc, envKey: gopsutil.HostProcEnvKey, dflt: defaults.HostProc},
+	{key: KeyHostSys, envKey: gopsutil.HostSysEnvKey, dflt: defaults.HostSys},
+	{key: KeyHostEtc, envKey: gopsutil.HostEtcEnvKey, dflt: defaults.HostEtc},
+	{key: KeyHostVar, envKey: gopsutil.HostVarEnvKey, dflt: defaults.HostVar},
+	{key: KeyHostRun, envKey: gopsutil.HostRunEnvKey, dflt: defaults.HostRun},
+}
+
+// hostPath returns the configured host path for key, or dflt if not set.
+func hostPath(key, dflt string) string {
+	if p := viper.GetString(key); p != "" {
+		return filepath.Clean(p)
+	}
+	return dflt
+}
+
+// IsHostMode returns true when the agent is collecting from host mounts
+// (e.g. running in a container with the host's /proc mounted at /host/proc).
+func IsHostMode() bool {
+	for _, hp := range hostPaths {
+		if hostPath(hp.key, hp.dflt) != hp.dflt {
+			return true
+		}
+	}
+	return false
+}
+
+// HostRootPath returns the path prefix used to reach the host's mount points,
+// empty when not in host mode. Mount points are reached through pid 1's root.
+func HostRootPath() string {
+	return ProcRootPath(hostPath(KeyHostProc, defaults.HostProc))
+}
+
+// ProcRootPath returns the path prefix used to reach the mount points of the
+// host whose procfs is mounted at procPath, empty for the default procfs.
+func ProcRootPath(procPath string) string {
+	if filepath.Clean(procPath) == defaults.HostProc {
+		return ""
+	}
+	return filepath.Join(procPath, "1", "root")
+}
+
+// hostEnv returns the gopsutil environment for the configured host paths.
+func hostEnv() gopsutil.EnvMap {
+	env := gopsutil.EnvMap{}
+	for _, hp := range hostPaths {
+		env[hp.envKey] = hostPath(hp.key, hp.dflt)
+	}
+	if root := HostRootPath(); root != "" {
+		env[gopsutil.HostRootEnvKey] = root
+	}
+	return env
+}
+
+// HostContext returns a context which directs gopsutil *WithContext calls
+// to the configured host paths.
+func HostContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, gopsutil.EnvKey, hostEnv())
+}
+
+// SelfContext returns a context which directs gopsutil *WithContext calls to
+// the agent's own /proc, for stats about the agent process itself (the
+// agent's pid is not valid in the host's pid namespace).
+func SelfContext(ctx context.Context) context.Context {
+	env := hostEnv()
+	env[gopsutil.HostProcEnvKey] = defaults.HostProc
+	return context.WithValue(ctx, gopsutil.EnvKey, env)
+}
+
+// ExportHostEnv sets the gopsutil HOST_* environment variables from the
+// configured host paths so that gopsutil calls without a context (and
+// plugins inheriting the environment) also use the host mounts.
+func ExportHostEnv() error {
+	for envKey, val := range hostEnv() {
+		if err := os.Setenv(string(envKey), val); err != nil {
+			return fmt.Errorf("setting %s: %w", envKey, err)
+		}
+	}
+	return nil
+}
+
+// HostHostname returns the host's hostname from <host_etc>/hostname.
+func HostHostname() (string, error) {
+	fn := filepath.Join(hostPath(KeyHostEtc, defaults.HostEtc), "hostname")
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return "", fmt.Errorf("reading hostname: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return line, nil
+	}
+	return "", fmt.Errorf("%s: %w", fn, errNoHostname)
+}
+
+// ApplyHostMode, when in host mode, exports the host paths for gopsutil and
+// uses the host's hostname as the check target unless one was explicitly set.
+// Called once at start up, after the configuration has been validated.
+func ApplyHostMode() error {
+	if !IsHostMode() {
+		return nil
+	}
+
+	if err := ExportHostEnv(); err != nil {
+		return err
+	}
+
+	if viper.GetString(KeyCheckTarget) != defaults.CheckTarget {
+		return nil
+	}
+
+	hn, err := HostHostname()
+	if err != nil {
+		// keep default (container) hostname as target
+		log.Warn().Err(err).Str("target", viper.GetString(KeyCheckTarget)).Msg("host mode, unable to get host hostname, using default check target")
+		return nil
+	}
+	viper.Set(KeyCheckTarget, hn)
+
+	return nil
+}
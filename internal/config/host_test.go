@@ -0,0 +1,221 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/rs/zerolog"
+	gopsutil "github.com/shirou/gopsutil/v3/common"
+	"github.com/spf13/viper"
+)
+
+func TestIsHostMode(t *testing.T) {
+	t.Log("Testing IsHostMode")
+	defer viper.Reset()
+
+	t.Log("defaults")
+	{
+		viper.Reset()
+		if IsHostMode() {
+			t.Fatal("expected false")
+		}
+		if p := HostRootPath(); p != "" {
+			t.Fatalf("expected empty root path, got (%s)", p)
+		}
+	}
+
+	t.Log("explicit defaults")
+	{
+		viper.Reset()
+		viper.Set(KeyHostProc, "/proc/")
+		viper.Set(KeyHostSys, defaults.HostSys)
+		if IsHostMode() {
+			t.Fatal("expected false")
+		}
+	}
+
+	t.Log("host proc")
+	{
+		viper.Reset()
+		viper.Set(KeyHostProc, "/host/proc")
+		if !IsHostMode() {
+			t.Fatal("expected true")
+		}
+		if p := HostRootPath(); p != "/host/proc/1/root" {
+			t.Fatalf("expected /host/proc/1/root, got (%s)", p)
+		}
+	}
+
+	t.Log("host etc")
+	{
+		viper.Reset()
+		viper.Set(KeyHostEtc, "/host/etc")
+		if !IsHostMode() {
+			t.Fatal("expected true")
+		}
+		if p := HostRootPath(); p != "" {
+			t.Fatalf("expected empty root path, got (%s)", p)
+		}
+	}
+}
+
+func TestHostContext(t *testing.T) {
+	t.Log("Testing HostContext/SelfContext")
+	defer viper.Reset()
+
+	viper.Reset()
+	viper.Set(KeyHostProc, "/host/proc")
+	viper.Set(KeyHostSys, "/host/sys")
+
+	t.Log("host")
+	{
+		env, ok := HostContext(context.Background()).Value(gopsutil.EnvKey).(gopsutil.EnvMap)
+		if !ok {
+			t.Fatal("expected env map in context")
+		}
+		for k, v := range map[gopsutil.EnvKeyType]string{
+			gopsutil.HostProcEnvKey: "/host/proc",
+			gopsutil.HostSysEnvKey:  "/host/sys",
+			gopsutil.HostEtcEnvKey:  defaults.HostEtc,
+			gopsutil.HostRunEnvKey:  defaults.HostRun,
+			gopsutil.HostRootEnvKey: "/host/proc/1/root",
+		} {
+			if env[k] != v {
+				t.Fatalf("%s expected (%s) got (%s)", k, v, env[k])
+			}
+		}
+	}
+
+	t.Log("self")
+	{
+		env, ok := SelfContext(context.Background()).Value(gopsutil.EnvKey).(gopsutil.EnvMap)
+		if !ok {
+			t.Fatal("expected env map in context")
+		}
+		if env[gopsutil.HostProcEnvKey] != defaults.HostProc {
+			t.Fatalf("expected (%s) got (%s)", defaults.HostProc, env[gopsutil.HostProcEnvKey])
+		}
+		if env[gopsutil.HostSysEnvKey] != "/host/sys" {
+			t.Fatalf("expected (/host/sys) got (%s)", env[gopsutil.HostSysEnvKey])
+		}
+	}
+}
+
+func TestHostHostname(t *testing.T) {
+	t.Log("Testing HostHostname")
+	defer viper.Reset()
+
+	t.Log("valid")
+	{
+		viper.Reset()
+		viper.Set(KeyHostEtc, filepath.Join("testdata", "host", "etc"))
+		hn, err := HostHostname()
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if hn != "host01.example.com" {
+			t.Fatalf("expected (host01.example.com) got (%s)", hn)
+		}
+	}
+
+	t.Log("missing")
+	{
+		viper.Reset()
+		viper.Set(KeyHostEtc, filepath.Join("testdata", "not_a_dir"))
+		if _, err := HostHostname(); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("empty")
+	{
+		viper.Reset()
+		viper.Set(KeyHostEtc, t.TempDir())
+		if err := os.WriteFile(filepath.Join(viper.GetString(KeyHostEtc), "hostname"), []byte("\n"), 0o600); err != nil {
+			t.Fatalf("writing hostname: %s", err)
+		}
+		_, err := HostHostname()
+		if !errors.Is(err, errNoHostname) {
+			t.Fatalf("expected (%s) got (%v)", errNoHostname, err)
+		}
+	}
+}
+
+func TestApplyHostMode(t *testing.T) {
+	t.Log("Testing ApplyHostMode")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer viper.Reset()
+	// restore the HOST_* environment set by ApplyHostMode after the test
+	for _, envKey := range []string{"HOST_PROC", "HOST_SYS", "HOST_ETC", "HOST_VAR", "HOST_RUN", "HOST_ROOT"} {
+		t.Setenv(envKey, os.Getenv(envKey))
+	}
+
+	t.Log("host mode, default target")
+	{
+		viper.Reset()
+		viper.Set(KeyHostProc, "/host/proc")
+		viper.Set(KeyHostEtc, filepath.Join("testdata", "host", "etc"))
+		viper.Set(KeyCheckTarget, defaults.CheckTarget)
+		if err := ApplyHostMode(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if v := os.Getenv("HOST_PROC"); v != "/host/proc" {
+			t.Fatalf("expected HOST_PROC (/host/proc) got (%s)", v)
+		}
+		if v := viper.GetString(KeyCheckTarget); v != "host01.example.com" {
+			t.Fatalf("expected target (host01.example.com) got (%s)", v)
+		}
+	}
+
+	t.Log("not host mode")
+	{
+		viper.Reset()
+		_ = os.Unsetenv("HOST_PROC")
+		viper.Set(KeyCheckTarget, defaults.CheckTarget)
+		if err := ApplyHostMode(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if v, ok := os.LookupEnv("HOST_PROC"); ok {
+			t.Fatalf("expected HOST_PROC not set, got (%s)", v)
+		}
+		if v := viper.GetString(KeyCheckTarget); v != defaults.CheckTarget {
+			t.Fatalf("expected target (%s) got (%s)", defaults.CheckTarget, v)
+		}
+	}
+
+	t.Log("host mode, no host hostname")
+	{
+		viper.Reset()
+		viper.Set(KeyHostEtc, filepath.Join("testdata", "host", "missing"))
+		viper.Set(KeyCheckTarget, defaults.CheckTarget)
+		if err := ApplyHostMode(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if v := viper.GetString(KeyCheckTarget); v != defaults.CheckTarget {
+			t.Fatalf("expected target (%s) got (%s)", defaults.CheckTarget, v)
+		}
+	}
+
+	t.Log("host mode, explicit target")
+	{
+		viper.Reset()
+		viper.Set(KeyHostEtc, filepath.Join("testdata", "host", "etc"))
+		viper.Set(KeyCheckTarget, "foo")
+		if err := ApplyHostMode(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if v := viper.GetString(KeyCheckTarget); v != "foo" {
+			t.Fatalf("expected target (foo) got (%s)", v)
+		}
+	}
+}
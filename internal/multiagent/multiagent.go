@@ -14,6 +14,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/bytefmt"
@@ -53,9 +54,13 @@ type Submitter struct {
 	checkUUID       string
 	traceSubmits    string
 	interval        time.Duration
+	started         time.Time // submitter start, for readiness
+	lastSubmit      time.Time // last successful submission
+	lastErr         error     // last submission error
 	useCompression  bool
 	enabled         bool
 	accumulate      bool
+	sync.Mutex
 }
 
 // submitLogshim is used to satisfy submission use of retryable-http Logger interface (avoiding ptr receiver issue).
@@ -72,6 +77,7 @@ var (
 	errInvalidCheck   = fmt.Errorf("invalid check (nil)")
 	errInvalidServer  = fmt.Errorf("invalid server (nil)")
 	errInvalidMetrics = fmt.Errorf("invalid metrics (nil)")
+	errNoSubmission   = fmt.Errorf("no successful submission")
 )
 
 func New(parentLogger zerolog.Logger, chk *check.Check, svr *server.Server) (*Submitter, error) {
@@ -163,13 +169,24 @@ func (s *Submitter) Start(ctx context.Context) error {
 	}
 	s.logger.Debug().Str("interval", s.interval.String()).Msg("starting submitter")
 
+	s.Lock()
+	s.started = time.Now()
+	s.Unlock()
+
 	ticker := time.NewTicker(s.interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			if err := s.sendMetrics(ctx); err != nil {
+			err := s.sendMetrics(ctx)
+			s.Lock()
+			if err == nil {
+				s.lastSubmit = time.Now()
+			}
+			s.lastErr = err
+			s.Unlock()
+			if err != nil {
 				s.logger.Error().Err(err).Msg("submitting multi-agent metrics")
 			}
 		case <-ctx.Done():
@@ -178,6 +195,45 @@ func (s *Submitter) Start(ctx context.Context) error {
 	}
 }
 
+// Health returns the time of the last successful submission, for readiness. An
+// error is returned if there has not been a successful submission within two
+// submission intervals.
+func (s *Submitter) Health() (string, error) {
+	if !s.enabled {
+		return "disabled", nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	detail := "no submissions"
+	if !s.lastSubmit.IsZero() {
+		detail = "last submission " + s.lastSubmit.UTC().Format(time.RFC3339)
+	}
+
+	since := s.lastSubmit
+	if since.IsZero() {
+		since = s.started
+	}
+	if since.IsZero() || time.Since(since) <= 2*s.interval {
+		return detail, nil
+	}
+	if s.lastErr != nil {
+		return detail, fmt.Errorf("%w: %s", errNoSubmission, s.lastErr.Error())
+	}
+
+	return detail, errNoSubmission
+}
+
+// Flush submits a final batch of metrics, e.g. when the agent is stopping.
+func (s *Submitter) Flush(ctx context.Context) error {
+	if !s.enabled {
+		return nil
+	}
+	s.logger.Info().Msg("submitting final metrics")
+	return s.sendMetrics(ctx)
+}
+
 func (s *Submitter) sendMetrics(ctx context.Context) error {
 	metrics := s.getMetrics()
 	if metrics == nil {
@@ -327,7 +383,7 @@ func (s *Submitter) sendMetrics(ctx context.Context) error {
 }
 
 func (s *Submitter) getMetrics() Metrics {
-	cmetrics := s.svr.GetMetrics([]string{}, "")
+	cmetrics := s.svr.GetMetrics(server.ConsumerMultiAgent, []string{}, "", nil)
 
 	// metrics coming from multiple agents to the same check need some special handling
 	// the broker understands an flags parameter, cgm does not currently support it.
@@ -9,11 +9,14 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/release"
@@ -307,6 +310,7 @@ func (p *plugin) exec() error {
 		p.lastRunDuration = time.Since(p.lastStart)
 		p.lastError = err
 		p.running = false
+		p.proc = nil
 		p.Unlock()
 	}
 
@@ -331,6 +335,10 @@ func (p *plugin) exec() error {
 		return fmt.Errorf("cmd start: %w", err)
 	}
 
+	p.Lock()
+	p.proc = p.cmd.Process
+	p.Unlock()
+
 	for scanner.Scan() {
 		line := scanner.Text()
 
@@ -398,3 +406,32 @@ func (p *plugin) exec() error {
 	resetStatus(runErr)
 	return runErr //nolint:wrapcheck
 }
+
+// terminate sends SIGTERM to the plugin process, if it is running. Where
+// SIGTERM is not supported (windows) the process is killed.
+func (p *plugin) terminate() {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.proc == nil {
+		return
+	}
+
+	p.logger.Debug().Int("pid", p.proc.Pid).Msg("sending SIGTERM")
+	if err := p.proc.Signal(syscall.SIGTERM); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return
+		}
+		p.logger.Debug().Err(err).Msg("SIGTERM, killing")
+		if err := p.proc.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			p.logger.Warn().Err(err).Msg("killing plugin")
+		}
+	}
+}
+
+// isRunning returns true if the plugin is executing.
+func (p *plugin) isRunning() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.running
+}
@@ -26,6 +26,8 @@ import (
 	"github.com/spf13/viper"
 )
 
+var errScanIncomplete = fmt.Errorf("plugin scan not complete")
+
 // Plugins defines plugin manager.
 type Plugins struct {
 	active        map[string]*plugin
@@ -35,12 +37,15 @@ type Plugins struct {
 	ctx           context.Context
 	logger        zerolog.Logger
 	running       bool
+	stopped       bool // no new plugin runs once stopping
+	scanned       bool // plugin scan complete
 	sync.RWMutex
 }
 
 // Plugin defines a specific plugin.
 type plugin struct {
 	cmd             *exec.Cmd
+	proc            *os.Process // running plugin process, nil when not running
 	command         string
 	id              string
 	name            string
@@ -157,10 +162,46 @@ func (p *Plugins) Flush(pluginName string) *cgm.Metrics {
 	return &metrics
 }
 
-// Stop any long running plugins.
-func (p *Plugins) Stop() error {
+// Stop sends SIGTERM to running plugins (e.g. long running plugins) and waits
+// for them to exit, until ctx is done. Plugins still running when ctx is done
+// are killed when the plugin context is cancelled.
+func (p *Plugins) Stop(ctx context.Context) error {
 	p.logger.Info().Msg("stopping")
-	return nil
+
+	p.Lock()
+	p.stopped = true
+	p.Unlock()
+
+	p.RLock()
+	plugs := make([]*plugin, 0, len(p.active))
+	for _, plug := range p.active {
+		plugs = append(plugs, plug)
+	}
+	p.RUnlock()
+
+	for _, plug := range plugs {
+		plug.terminate()
+	}
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		running := 0
+		for _, plug := range plugs {
+			if plug.isRunning() {
+				running++
+			}
+		}
+		if running == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d plugin(s) still running: %w", running, ctx.Err())
+		case <-ticker.C:
+		}
+	}
 }
 
 // Run one or all plugins.
@@ -180,6 +221,12 @@ func (p *Plugins) Run(pluginName string) error {
 		return nil
 	}
 
+	if p.stopped {
+		p.logger.Debug().Msg("stopping, skipping run")
+		p.Unlock()
+		return nil
+	}
+
 	if len(p.plugList) == 0 {
 		p.plugList = make([]string, len(p.active))
 		i := 0
@@ -275,6 +322,19 @@ func (p *Plugins) IsInternal(pluginName string) bool {
 	return reserved
 }
 
+// Health returns the number of active plugins, for readiness. An error is
+// returned if the plugin scan has not completed.
+func (p *Plugins) Health() (string, error) {
+	p.RLock()
+	defer p.RUnlock()
+
+	if !p.scanned {
+		return "", errScanIncomplete
+	}
+
+	return fmt.Sprintf("%d active", len(p.active)), nil
+}
+
 // Inventory returns list of active plugins.
 func (p *Plugins) Inventory() []byte {
 	p.Lock()
@@ -340,3 +340,115 @@ func TestInventory(t *testing.T) {
 		}
 	}
 }
+
+func TestStop(t *testing.T) {
+	t.Log("Testing Stop")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	if runtime.GOOS == "windows" {
+		t.Skip("long running shell plugin")
+	}
+
+	dir := t.TempDir()
+	script := path.Join(dir, "long.sh")
+	data := "#!/bin/sh\ntrap 'exit 0' TERM\nwhile true; do\n  printf 'long\\tL\\t1\\n\\n'\n  sleep 0.1\ndone\n"
+	if err := os.WriteFile(script, []byte(data), 0700); err != nil { //nolint:gosec
+		t.Fatalf("writing plugin (%s)", err)
+	}
+
+	plug := &plugin{
+		ctx:     context.Background(),
+		id:      "long",
+		name:    "long",
+		command: script,
+		runDir:  dir,
+	}
+	p := &Plugins{
+		ctx:    context.Background(),
+		active: map[string]*plugin{"long": plug},
+	}
+
+	runDone := make(chan error, 1)
+	go func() {
+		runDone <- p.Run("long")
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		plug.Lock()
+		started := plug.proc != nil
+		plug.Unlock()
+		if started {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("plugin did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Log("long running plugin stopped (SIGTERM)")
+	{
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.Stop(ctx); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if plug.isRunning() {
+			t.Fatal("expected plugin to be stopped")
+		}
+		if err := <-runDone; err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+	}
+
+	t.Log("no runs once stopped")
+	{
+		if err := p.Run("long"); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if plug.isRunning() {
+			t.Fatal("expected plugin not to run")
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	t.Log("Testing Health")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyPluginDir, "")
+
+	p, nerr := New(context.Background(), "")
+	if nerr != nil {
+		t.Fatalf("new plugins (%s)", nerr)
+	}
+
+	t.Log("scan not complete")
+	{
+		if _, err := p.Health(); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("scan complete")
+	{
+		b, err := builtins.New(context.Background())
+		if err != nil {
+			t.Fatalf("new builtins (%s)", err)
+		}
+		if err := p.Scan(b); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		detail, err := p.Health()
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if detail != "0 active" {
+			t.Fatalf("expected 0 active, got (%s)", detail)
+		}
+	}
+}
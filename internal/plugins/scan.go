@@ -65,6 +65,8 @@ func (p *Plugins) Scan(b *builtins.Builtins) error {
 		p.logger.Warn().Msg("no active plugins found")
 	}
 
+	p.scanned = true
+
 	return nil
 }
 
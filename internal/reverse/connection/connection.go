@@ -30,6 +30,7 @@ type Connection struct {
 	revConfig       check.ReverseConfig
 	State           string
 	agentAddress    string
+	agentToken      string // bearer token for requests to the agent (api auth)
 	logger          zerolog.Logger
 	delay           time.Duration
 	commTimeouts    int
@@ -107,7 +108,7 @@ const (
 	ConfigRetryLimit     = 3     // if failed attempts > limit, force check reconfig (see if broker configuration changed)
 )
 
-func New(parentLogger zerolog.Logger, agentAddress string, cfg *check.ReverseConfig) (*Connection, error) {
+func New(parentLogger zerolog.Logger, agentAddress, agentToken string, cfg *check.ReverseConfig) (*Connection, error) {
 	if agentAddress == "" {
 		return nil, fmt.Errorf("invalid agent address (empty)") //nolint:goerr113
 	}
@@ -123,6 +124,7 @@ func New(parentLogger zerolog.Logger, agentAddress string, cfg *check.ReverseCon
 
 	c := Connection{
 		agentAddress: agentAddress,
+		agentToken:   agentToken,
 		revConfig:    *cfg,
 		State:        StateNew,
 		logger:       parentLogger.With().Str("cn", cfg.CN).Logger(),
@@ -134,11 +136,22 @@ func New(parentLogger zerolog.Logger, agentAddress string, cfg *check.ReverseCon
 	return &c, nil
 }
 
+// CurrentState returns the connection state and the time of the last request from the broker.
+func (c *Connection) CurrentState() (string, *time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.State, c.LastRequestTime
+}
+
 // Start the reverse connection to the broker.
 func (c *Connection) Start(ctx context.Context) error {
 	for {
 		conn, cerr := c.connect(ctx)
 		if cerr != nil {
+			c.Lock()
+			c.State = StateError
+			c.Unlock()
 			if aerr := appstats.SetString("reverse.last_connect_error", time.Now().String()); aerr != nil {
 				c.logger.Warn().Err(aerr).Msg("setting app stat - last_connect_error")
 			}
@@ -6,6 +6,7 @@
 package connection
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -80,14 +81,15 @@ func (c *Connection) fetchMetricData(request *[]byte, channelID uint16) (*[]byte
 		c.logger.Warn().Err(err).Msg("setting connection deadline")
 	}
 
-	numBytes, err := conn.Write(*request)
+	req := authorizeRequest(*request, c.agentToken)
+	numBytes, err := conn.Write(req)
 	if err != nil {
 		return nil, fmt.Errorf("writing metric request: %w", err)
 	}
-	if numBytes != len(*request) {
+	if numBytes != len(req) {
 		c.logger.Warn().
 			Int("written_bytes", numBytes).
-			Int("request_len", len(*request)).
+			Int("request_len", len(req)).
 			Msg("Mismatch")
 	}
 
@@ -100,3 +102,21 @@ func (c *Connection) fetchMetricData(request *[]byte, channelID uint16) (*[]byte
 
 	return &data, nil
 }
+
+// authorizeRequest adds the agent bearer token (if api auth is configured) to
+// a broker request, after the request line.
+func authorizeRequest(request []byte, token string) []byte {
+	if token == "" {
+		return request
+	}
+	idx := bytes.Index(request, []byte("\r\n"))
+	if idx == -1 {
+		return request
+	}
+	hdr := "\r\nAuthorization: Bearer " + token
+	req := make([]byte, 0, len(request)+len(hdr))
+	req = append(req, request[:idx]...)
+	req = append(req, hdr...)
+	req = append(req, request[idx:]...)
+	return req
+}
@@ -5,6 +5,57 @@
 
 package connection
 
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestFetchMetricDataAuth(t *testing.T) {
+	t.Log("Testing fetchMetricData w/api auth")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer foo" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, `{"test":1}`)
+	}))
+	defer ts.Close()
+
+	req := []byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+
+	t.Log("no token")
+	{
+		c := Connection{agentAddress: ts.Listener.Addr().String(), logger: zerolog.Nop()}
+		data, err := c.fetchMetricData(&req, uint16(1))
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if !bytes.HasPrefix(*data, []byte("HTTP/1.1 401")) {
+			t.Fatalf("expected 401, got %s", string(*data))
+		}
+	}
+
+	t.Log("token")
+	{
+		c := Connection{agentAddress: ts.Listener.Addr().String(), agentToken: "foo", logger: zerolog.Nop()}
+		data, err := c.fetchMetricData(&req, uint16(1))
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if !bytes.HasPrefix(*data, []byte("HTTP/1.1 200")) || !bytes.HasSuffix(*data, []byte(`{"test":1}`)) {
+			t.Fatalf("expected 200 w/metrics, got %s", string(*data))
+		}
+	}
+}
+
 // import (
 // 	"bytes"
 // 	"context"
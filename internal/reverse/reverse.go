@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/check"
 	"github.com/circonus-labs/circonus-agent/internal/config"
@@ -23,11 +24,16 @@ type Reverse struct {
 	logger       zerolog.Logger
 	configs      *check.ReverseConfigs
 	chk          *check.Check
+	conn         *connection.Connection // current connection to the primary broker
 	agentAddress string
+	agentToken   string // bearer token for requests to the agent (api auth)
 	enabled      bool
+	sync.Mutex
 }
 
-func New(parentLogger zerolog.Logger, chk *check.Check, agentAddress string) (*Reverse, error) {
+var errNotConnected = fmt.Errorf("not connected")
+
+func New(parentLogger zerolog.Logger, chk *check.Check, agentAddress, agentToken string) (*Reverse, error) {
 	if chk == nil {
 		return nil, fmt.Errorf("invalid check (nil") //nolint:goerr113
 	}
@@ -37,6 +43,7 @@ func New(parentLogger zerolog.Logger, chk *check.Check, agentAddress string) (*R
 
 	r := &Reverse{
 		agentAddress: agentAddress,
+		agentToken:   agentToken,
 		chk:          chk,
 		enabled:      viper.GetBool(config.KeyReverse),
 	}
@@ -65,6 +72,34 @@ func New(parentLogger zerolog.Logger, chk *check.Check, agentAddress string) (*R
 	return r, nil
 }
 
+// Health returns the state of the reverse connection, for readiness. An error
+// is returned if the agent is not connected to the broker.
+func (r *Reverse) Health() (string, error) {
+	if !r.enabled {
+		return "disabled", nil
+	}
+
+	r.Lock()
+	rc := r.conn
+	r.Unlock()
+
+	if rc == nil {
+		return connection.StateNew, errNotConnected
+	}
+
+	state, lastRequest := rc.CurrentState()
+	detail := state
+	if lastRequest != nil {
+		detail += ", last request " + lastRequest.UTC().Format(time.RFC3339)
+	}
+	switch state {
+	case connection.StateConnActive, connection.StateConnIdle:
+		return detail, nil
+	default:
+		return detail, errNotConnected
+	}
+}
+
 // Start reverse connection(s) to the broker(s).
 func (r *Reverse) Start(ctx context.Context) error {
 	if !r.enabled {
@@ -130,11 +165,14 @@ func (r *Reverse) Start(ctx context.Context) error {
 			Str("address", cfg.BrokerAddr.String()).
 			Str("url", cfg.ReverseURL.String()).
 			Msg("reverse broker config")
-		rc, err := connection.New(r.logger, r.agentAddress, &cfg)
+		rc, err := connection.New(r.logger, r.agentAddress, r.agentToken, &cfg)
 		if err != nil {
 			cancel()
 			return fmt.Errorf("new conn: %w", err)
 		}
+		r.Lock()
+		r.conn = rc
+		r.Unlock()
 
 		var wg sync.WaitGroup
 
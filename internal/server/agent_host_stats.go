@@ -9,6 +9,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -24,9 +25,10 @@ import (
 
 // agentHostStats produces the internal agent host metrics.
 func (s *Server) agentHostStats(metrics cgm.Metrics, mtags []string) {
+	hctx := config.HostContext(context.Background())
 
 	// uptime
-	if ut, err := host.Uptime(); err != nil {
+	if ut, err := host.UptimeWithContext(hctx); err != nil {
 		s.logger.Error().Err(err).Msg("host uptime")
 	} else {
 		var ctag []string
@@ -37,7 +39,7 @@ func (s *Server) agentHostStats(metrics cgm.Metrics, mtags []string) {
 
 	// cpus
 	{
-		if pcpu, err := cpu.Counts(false); err != nil {
+		if pcpu, err := cpu.CountsWithContext(hctx, false); err != nil {
 			s.logger.Error().Err(err).Msg("physical cores")
 		} else {
 			var ctag []string
@@ -45,7 +47,7 @@ func (s *Server) agentHostStats(metrics cgm.Metrics, mtags []string) {
 			ctag = append(ctag, "type:physical")
 			metrics[tags.MetricNameWithStreamTags("agent_host_cores", tags.FromList(ctag))] = cgm.Metric{Value: pcpu, Type: "L"}
 		}
-		if lcpu, err := cpu.Counts(true); err != nil {
+		if lcpu, err := cpu.CountsWithContext(hctx, true); err != nil {
 			s.logger.Error().Err(err).Msg("logical cores")
 		} else {
 			var ctag []string
@@ -56,7 +58,7 @@ func (s *Server) agentHostStats(metrics cgm.Metrics, mtags []string) {
 	}
 	// memory
 	{
-		if ms, err := mem.VirtualMemory(); err != nil {
+		if ms, err := mem.VirtualMemoryWithContext(hctx); err != nil {
 			s.logger.Error().Err(err).Msg("memory")
 		} else {
 			var ctag []string
@@ -69,11 +71,13 @@ func (s *Server) agentHostStats(metrics cgm.Metrics, mtags []string) {
 
 	// agent process
 	{
+		// the agent's pid is only valid in the agent's own /proc
+		sctx := config.SelfContext(context.Background())
 		pid := os.Getpid()
-		if p, err := process.NewProcess(int32(pid)); err != nil {
+		if p, err := process.NewProcessWithContext(sctx, int32(pid)); err != nil {
 			s.logger.Error().Err(err).Msg("agent process")
 		} else {
-			if threads, err := p.NumThreads(); err != nil {
+			if threads, err := p.NumThreadsWithContext(sctx); err != nil {
 				s.logger.Error().Err(err).Msg("agent process threads")
 			} else {
 				metrics[tags.MetricNameWithStreamTags("agent_threads", tags.FromList(mtags))] = cgm.Metric{Value: threads, Type: "L"}
@@ -91,7 +95,7 @@ func (s *Server) agentHostStats(metrics cgm.Metrics, mtags []string) {
 			return
 		}
 
-		pp, err := process.Processes()
+		pp, err := process.ProcessesWithContext(hctx)
 		if err != nil {
 			s.logger.Error().Err(err).Msg("process list, skipping")
 			return
@@ -102,17 +106,17 @@ func (s *Server) agentHostStats(metrics cgm.Metrics, mtags []string) {
 		var cp float64
 		var pname string
 		for _, p := range pp {
-			if running, _ := p.IsRunning(); !running {
+			if running, _ := p.IsRunningWithContext(hctx); !running {
 				continue
 			}
 
 			if memLimit >= 0 {
-				mp, merr = p.MemoryPercent()
+				mp, merr = p.MemoryPercentWithContext(hctx)
 			}
 			if cpuLimit >= 0 {
-				cp, cerr = p.CPUPercent()
+				cp, cerr = p.CPUPercentWithContext(hctx)
 			}
-			pname, nerr = p.Name()
+			pname, nerr = p.NameWithContext(hctx)
 
 			if merr != nil && cerr != nil {
 				continue
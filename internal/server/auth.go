@@ -0,0 +1,240 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	appstats "github.com/maier/go-appstats"
+)
+
+// API scopes, applied per route.
+const (
+	scopeRead  = "read"  // /run, /peek, /metrics, /inventory, /prom (GET), /stats, /filters/test, /health detail
+	scopeWrite = "write" // /write, /prom (PUT/POST)
+	scopeAdmin = "admin" // /options, /config
+)
+
+var (
+	errAuthInvalidScope  = fmt.Errorf("invalid scope, expected read, write or admin")
+	errAuthEmptyToken    = fmt.Errorf("token or token_file is required")
+	errAuthEmptySubject  = fmt.Errorf("client subject is required")
+	errAuthNoCredentials = fmt.Errorf("no tokens or clients defined")
+)
+
+// authToken is a bearer token and its scopes.
+type authToken struct {
+	Token     string   `json:"token" toml:"token" yaml:"token"`
+	TokenFile string   `json:"token_file" toml:"token_file" yaml:"token_file"`
+	Scopes    []string `json:"scopes" toml:"scopes" yaml:"scopes"`
+}
+
+// authClient is a client certificate subject (CN or SAN) and its scopes.
+type authClient struct {
+	Subject string   `json:"subject" toml:"subject" yaml:"subject"`
+	Scopes  []string `json:"scopes" toml:"scopes" yaml:"scopes"`
+}
+
+// authConfig is the api auth configuration file.
+type authConfig struct {
+	Tokens    []authToken  `json:"tokens" toml:"tokens" yaml:"tokens"`
+	Clients   []authClient `json:"clients" toml:"clients" yaml:"clients"`
+	Anonymous []string     `json:"anonymous" toml:"anonymous" yaml:"anonymous"`
+}
+
+type scopeSet map[string]bool
+
+type tokenScopes struct {
+	scopes scopeSet
+	token  []byte
+}
+
+// apiAuth authenticates requests and authorizes them based on scopes.
+type apiAuth struct {
+	clients   map[string]scopeSet
+	anonymous scopeSet
+	tokens    []tokenScopes
+}
+
+// loadAuth loads the api auth configuration (json, toml or yaml) file.
+func loadAuth(fn string) (*apiAuth, error) {
+	var cfg authConfig
+	if err := config.LoadConfigFile(strings.TrimSuffix(fn, filepath.Ext(fn)), &cfg); err != nil {
+		return nil, fmt.Errorf("loading api auth config: %w", err)
+	}
+	return newAuth(cfg)
+}
+
+// newAuth validates an api auth configuration.
+func newAuth(cfg authConfig) (*apiAuth, error) {
+	if len(cfg.Tokens) == 0 && len(cfg.Clients) == 0 {
+		return nil, errAuthNoCredentials
+	}
+
+	a := &apiAuth{
+		clients: make(map[string]scopeSet),
+	}
+
+	var err error
+	if a.anonymous, err = newScopeSet(cfg.Anonymous); err != nil {
+		return nil, fmt.Errorf("anonymous: %w", err)
+	}
+
+	for i, t := range cfg.Tokens {
+		token := t.Token
+		if t.TokenFile != "" {
+			data, err := os.ReadFile(t.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("token %d: read token_file: %w", i, err)
+			}
+			token = strings.TrimSpace(string(data))
+		}
+		if token == "" {
+			return nil, fmt.Errorf("token %d: %w", i, errAuthEmptyToken)
+		}
+		scopes, err := newScopeSet(t.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("token %d: %w", i, err)
+		}
+		a.tokens = append(a.tokens, tokenScopes{token: []byte(token), scopes: scopes})
+	}
+
+	for i, c := range cfg.Clients {
+		if c.Subject == "" {
+			return nil, fmt.Errorf("client %d: %w", i, errAuthEmptySubject)
+		}
+		scopes, err := newScopeSet(c.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("client %d: %w", i, err)
+		}
+		a.clients[c.Subject] = scopes
+	}
+
+	return a, nil
+}
+
+// newInternalToken adds a random bearer token with the read scope, used by
+// the agent's reverse connection to fetch metrics for the broker.
+func (a *apiAuth) newInternalToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	a.tokens = append(a.tokens, tokenScopes{token: []byte(token), scopes: scopeSet{scopeRead: true}})
+	return token, nil
+}
+
+// newScopeSet validates a list of scopes.
+func newScopeSet(scopes []string) (scopeSet, error) {
+	set := make(scopeSet, len(scopes))
+	for _, sc := range scopes {
+		switch strings.ToLower(sc) {
+		case scopeRead, scopeWrite, scopeAdmin:
+			set[strings.ToLower(sc)] = true
+		default:
+			return nil, fmt.Errorf("%s: %w", sc, errAuthInvalidScope)
+		}
+	}
+	return set, nil
+}
+
+// scopes returns the scopes granted to a request and whether the request
+// presented valid credentials (a known bearer token or verified client certificate).
+func (a *apiAuth) scopes(r *http.Request) (scopeSet, bool) {
+	if token := bearerToken(r); token != "" {
+		for _, t := range a.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), t.token) == 1 {
+				return t.scopes, true
+			}
+		}
+		return nil, false
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		for _, subject := range certSubjects(r.TLS.VerifiedChains[0][0]) {
+			if scopes, ok := a.clients[subject]; ok {
+				return scopes, true
+			}
+		}
+		return nil, false
+	}
+
+	return a.anonymous, false
+}
+
+// bearerToken returns the bearer token from the Authorization header, if any.
+func bearerToken(r *http.Request) string {
+	hdr := r.Header.Get("Authorization")
+	if len(hdr) > 7 && strings.EqualFold(hdr[:7], "bearer ") {
+		return strings.TrimSpace(hdr[7:])
+	}
+	return ""
+}
+
+// certSubjects returns the identities of a client certificate, the subject
+// CN and the DNS, email and URI SANs.
+func certSubjects(cert *x509.Certificate) []string {
+	subjects := make([]string, 0, 1+len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.URIs))
+	if cert.Subject.CommonName != "" {
+		subjects = append(subjects, cert.Subject.CommonName)
+	}
+	subjects = append(subjects, cert.DNSNames...)
+	subjects = append(subjects, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		subjects = append(subjects, u.String())
+	}
+	return subjects
+}
+
+// allowed returns true if the request is allowed the scope, without rejecting
+// it (e.g. to decide how much detail to return). All requests are allowed if
+// api auth is not configured.
+func (s *Server) allowed(r *http.Request, scope string) bool {
+	if s.auth == nil {
+		return true
+	}
+
+	scopes, _ := s.auth.scopes(r)
+	return scopes[scope]
+}
+
+// authorize returns true if the request is allowed the scope. Otherwise, the
+// request is rejected (401 without valid credentials, 403 if the credentials
+// do not have the scope) and false is returned. All requests are allowed if
+// api auth is not configured.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, scope string) bool {
+	if s.auth == nil {
+		return true
+	}
+
+	scopes, authenticated := s.auth.scopes(r)
+	if scopes[scope] {
+		return true
+	}
+
+	if !authenticated {
+		_ = appstats.IncrementInt("server.requests_unauthorized")
+		s.logger.Warn().Str("method", r.Method).Str("url", r.URL.String()).Str("remote", r.RemoteAddr).Str("scope", scope).Msg("unauthorized")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="circonus-agent"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	_ = appstats.IncrementInt("server.requests_forbidden")
+	s.logger.Warn().Str("method", r.Method).Str("url", r.URL.String()).Str("remote", r.RemoteAddr).Str("scope", scope).Msg("forbidden")
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
@@ -0,0 +1,268 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestLoadAuth(t *testing.T) {
+	t.Log("Testing loadAuth")
+
+	t.Log("valid")
+	{
+		a, err := loadAuth(filepath.Join("testdata", "auth", "api_auth.yaml"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(a.tokens) != 2 || len(a.clients) != 1 {
+			t.Fatalf("unexpected auth %#v", a)
+		}
+		if string(a.tokens[1].token) != "writer-token" {
+			t.Fatalf("expected token from token_file, got (%s)", a.tokens[1].token)
+		}
+	}
+
+	t.Log("invalid scope")
+	{
+		if _, err := loadAuth(filepath.Join("testdata", "auth", "invalid_scope.json")); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("missing file")
+	{
+		if _, err := loadAuth(filepath.Join("testdata", "auth", "missing.yaml")); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("no credentials")
+	{
+		if _, err := newAuth(authConfig{Anonymous: []string{"read"}}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("empty token")
+	{
+		if _, err := newAuth(authConfig{Tokens: []authToken{{Scopes: []string{"read"}}}}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestRouterAuth(t *testing.T) {
+	t.Log("Testing router with api auth")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	a, err := loadAuth(filepath.Join("testdata", "auth", "api_auth.yaml"))
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	s := &Server{auth: a}
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		expect int
+	}{
+		{"GET", "/health", "", http.StatusOK},
+		{"GET", "/stats", "", http.StatusUnauthorized},
+		{"GET", "/stats", "invalid", http.StatusUnauthorized},
+		{"GET", "/stats", "reader-token", http.StatusOK},
+		{"GET", "/options?log_level=debug", "reader-token", http.StatusForbidden},
+		{"GET", "/options?log_level=debug", "writer-token", http.StatusForbidden},
+		{"PUT", "/write/foo", "", http.StatusUnauthorized},
+		{"PUT", "/write/foo", "reader-token", http.StatusForbidden},
+		{"POST", "/prom", "reader-token", http.StatusForbidden},
+	}
+
+	for _, tst := range tests {
+		t.Logf("%s %s (%s)", tst.method, tst.path, tst.token)
+		req := httptest.NewRequest(tst.method, tst.path, nil)
+		if tst.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tst.token)
+		}
+		w := httptest.NewRecorder()
+		s.router(w, req)
+		resp := w.Result()
+		resp.Body.Close()
+		if resp.StatusCode != tst.expect {
+			t.Fatalf("expected %d, got %d", tst.expect, resp.StatusCode)
+		}
+		if tst.expect == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+			t.Fatal("expected WWW-Authenticate header")
+		}
+	}
+
+	t.Log("rejected requests counted")
+	{
+		stats := expvar.Get("stats").(*expvar.Map)
+		if v := stats.Get("server.requests_unauthorized").(*expvar.Int).Value(); v < 3 {
+			t.Fatalf("expected at least 3 unauthorized, got %d", v)
+		}
+		if v := stats.Get("server.requests_forbidden").(*expvar.Int).Value(); v < 4 {
+			t.Fatalf("expected at least 4 forbidden, got %d", v)
+		}
+	}
+
+	t.Log("anonymous scopes")
+	{
+		a, err := newAuth(authConfig{Tokens: []authToken{{Token: "foo", Scopes: []string{"admin"}}}, Anonymous: []string{"read"}})
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		s := &Server{auth: a}
+		req := httptest.NewRequest("GET", "/stats", nil)
+		w := httptest.NewRecorder()
+		s.router(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	t.Log("Testing client certificate auth")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	a, err := loadAuth(filepath.Join("testdata", "auth", "api_auth.yaml"))
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	s := &Server{auth: a}
+
+	ca := newTestCA(t)
+	ts, _ := newTestTLSServer(t, ca, http.HandlerFunc(s.router), clientAuthOptional, nil)
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		cn     string
+		dns    []string
+		path   string
+		expect int
+	}{
+		{"no cert", "", nil, "/stats", http.StatusUnauthorized},
+		{"known cn", "broker01.example.com", nil, "/stats", http.StatusOK},
+		{"known san", "foo", []string{"broker01.example.com"}, "/stats", http.StatusOK},
+		{"unknown cn", "other.example.com", nil, "/stats", http.StatusUnauthorized},
+		{"missing scope", "broker01.example.com", nil, "/write/foo", http.StatusForbidden},
+	}
+
+	for _, tst := range tests {
+		t.Log(tst.name)
+		method := "GET"
+		if tst.path == "/write/foo" {
+			method = "PUT"
+		}
+		req, err := http.NewRequest(method, ts.URL+tst.path, nil)
+		if err != nil {
+			t.Fatalf("request: %s", err)
+		}
+		resp, err := ca.client(t, tst.cn, tst.dns...).Do(req)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tst.expect {
+			t.Fatalf("expected %d, got %d", tst.expect, resp.StatusCode)
+		}
+	}
+}
+
+func TestReverseAgentToken(t *testing.T) {
+	t.Log("Testing reverse agent token")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	authFile := filepath.Join("testdata", "auth", "api_auth.yaml")
+
+	t.Log("no api auth")
+	{
+		viper.Reset()
+		viper.Set(config.KeyListen, ":2609")
+		viper.Set(config.KeyReverse, true)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := New(ctx, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if tok := s.GetReverseAgentToken(); tok != "" {
+			t.Fatalf("expected no token, got %q", tok)
+		}
+	}
+
+	t.Log("api auth, reverse disabled")
+	{
+		viper.Reset()
+		viper.Set(config.KeyListen, ":2609")
+		viper.Set(config.KeyAPIAuthFile, authFile)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := New(ctx, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if tok := s.GetReverseAgentToken(); tok != "" {
+			t.Fatalf("expected no token, got %q", tok)
+		}
+	}
+
+	t.Log("api auth, reverse enabled")
+	{
+		viper.Reset()
+		viper.Set(config.KeyListen, ":2609")
+		viper.Set(config.KeyAPIAuthFile, authFile)
+		viper.Set(config.KeyReverse, true)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := New(ctx, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		tok := s.GetReverseAgentToken()
+		if tok == "" {
+			t.Fatal("expected token")
+		}
+
+		tests := []struct {
+			method string
+			path   string
+			token  string
+			expect int
+		}{
+			{"GET", "/stats", "", http.StatusUnauthorized},
+			{"GET", "/stats", tok, http.StatusOK},
+			{"PUT", "/write/foo", tok, http.StatusForbidden},
+			{"GET", "/config", tok, http.StatusForbidden},
+		}
+		for _, tst := range tests {
+			req := httptest.NewRequest(tst.method, tst.path, nil)
+			if tst.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tst.token)
+			}
+			w := httptest.NewRecorder()
+			s.router(w, req)
+			if w.Code != tst.expect {
+				t.Fatalf("%s %s expected %d, got %d", tst.method, tst.path, tst.expect, w.Code)
+			}
+		}
+	}
+
+	viper.Reset()
+}
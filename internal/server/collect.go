@@ -0,0 +1,97 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+)
+
+// Consumers of collected metrics, the drain owner is the consumer which drains
+// (flushes) the accumulating conduits (receiver, statsd and prometheus).
+const (
+	ConsumerRun        = "run"        // /run requests (e.g. broker)
+	ConsumerMetrics    = "metrics"    // /metrics requests (e.g. prometheus server)
+	ConsumerMultiAgent = "multiagent" // multi-agent submissions
+	drainOwnerAny      = "any"        // every consumer, except /metrics, drains
+)
+
+var errInvalidDrainOwner = fmt.Errorf("invalid drain owner, expected any, run, metrics or multiagent")
+
+// collection is a conduit collection shared by concurrent callers.
+type collection struct {
+	done    chan struct{} // closed once collected
+	metrics *cgm.Metrics
+	drain   bool // accumulated metrics were drained, not copied
+}
+
+// collector coalesces concurrent conduit collections.
+type collector struct {
+	inflight map[string]*collection
+	sync.Mutex
+}
+
+func newCollector() *collector {
+	return &collector{inflight: make(map[string]*collection)}
+}
+
+// validDrainOwner returns an error if owner is not a known drain owner.
+func validDrainOwner(owner string) error {
+	switch owner {
+	case drainOwnerAny, ConsumerRun, ConsumerMetrics, ConsumerMultiAgent:
+		return nil
+	default:
+		return fmt.Errorf("%s: %w", owner, errInvalidDrainOwner)
+	}
+}
+
+// drains returns true if the consumer drains the accumulating conduits,
+// other consumers get a copy of the accumulated metrics. /metrics (e.g. a
+// prometheus server scraping the agent) only drains if it is the owner, so
+// it never takes metrics from the broker by default.
+func (s *Server) drains(consumer string) bool {
+	if s.drainOwner == drainOwnerAny {
+		return consumer != ConsumerMetrics
+	}
+	return s.drainOwner == consumer
+}
+
+// collect calls fn to collect metrics for key (a conduit, or conduit item), or
+// shares the result of a collection already in progress for key. A caller which
+// drains does not share a collection which only copied the accumulated metrics,
+// it waits for it to complete and collects again. The metrics returned must
+// not be modified, they may be shared.
+func (c *collector) collect(key string, drain bool, fn func() *cgm.Metrics) *cgm.Metrics {
+	c.Lock()
+	for {
+		cl, ok := c.inflight[key]
+		if !ok {
+			break
+		}
+		c.Unlock()
+		<-cl.done
+		if cl.drain || !drain {
+			return cl.metrics
+		}
+		c.Lock()
+	}
+	cl := &collection{done: make(chan struct{}), drain: drain}
+	c.inflight[key] = cl
+	c.Unlock()
+
+	defer func() {
+		c.Lock()
+		delete(c.inflight, key)
+		c.Unlock()
+		close(cl.done)
+	}()
+
+	cl.metrics = fn()
+
+	return cl.metrics
+}
@@ -0,0 +1,269 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins"
+	"github.com/circonus-labs/circonus-agent/internal/check"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/circonus-labs/circonus-agent/internal/server/receiver"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestValidDrainOwner(t *testing.T) {
+	t.Log("Testing validDrainOwner")
+
+	for _, owner := range []string{"any", ConsumerRun, ConsumerMetrics, ConsumerMultiAgent} {
+		if err := validDrainOwner(owner); err != nil {
+			t.Fatalf("%s expected no error, got (%s)", owner, err)
+		}
+	}
+	for _, owner := range []string{"", "foo", "RUN"} {
+		if err := validDrainOwner(owner); err == nil {
+			t.Fatalf("%s expected error", owner)
+		}
+	}
+}
+
+func TestCollectorCollect(t *testing.T) {
+	t.Log("Testing collector.collect")
+
+	var calls int32
+	fn := func() *cgm.Metrics {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return &cgm.Metrics{"foo": cgm.Metric{Type: "L", Value: 1}}
+	}
+
+	collectAll := func(c *collector, drains ...bool) []*cgm.Metrics {
+		var wg sync.WaitGroup
+		results := make([]*cgm.Metrics, len(drains))
+		for i, drain := range drains {
+			wg.Add(1)
+			go func(i int, drain bool) {
+				defer wg.Done()
+				results[i] = c.collect("receiver", drain, fn)
+			}(i, drain)
+			time.Sleep(10 * time.Millisecond) // first caller collects
+		}
+		wg.Wait()
+		return results
+	}
+
+	t.Log("concurrent callers share")
+	{
+		c := newCollector()
+		atomic.StoreInt32(&calls, 0)
+		results := collectAll(c, true, true, false, true)
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Fatalf("expected 1 collection, got %d", n)
+		}
+		for _, r := range results[1:] {
+			if r != results[0] {
+				t.Fatal("expected shared metrics")
+			}
+		}
+		if len(c.inflight) != 0 {
+			t.Fatalf("expected no collections in flight, got %d", len(c.inflight))
+		}
+	}
+
+	t.Log("drain does not share a copy")
+	{
+		c := newCollector()
+		atomic.StoreInt32(&calls, 0)
+		results := collectAll(c, false, false, true)
+		if n := atomic.LoadInt32(&calls); n != 2 {
+			t.Fatalf("expected 2 collections, got %d", n)
+		}
+		if results[0] != results[1] || results[0] == results[2] {
+			t.Fatal("expected copies shared, drain collected")
+		}
+	}
+
+	t.Log("sequential callers collect")
+	{
+		c := newCollector()
+		atomic.StoreInt32(&calls, 0)
+		_ = c.collect("receiver", true, fn)
+		_ = c.collect("receiver", true, fn)
+		if n := atomic.LoadInt32(&calls); n != 2 {
+			t.Fatalf("expected 2 collections, got %d", n)
+		}
+	}
+}
+
+func TestGetMetricsDrainOwner(t *testing.T) {
+	t.Log("Testing GetMetrics w/drain owner")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+
+	t.Log("invalid drain owner")
+	{
+		viper.Reset()
+		viper.Set(config.KeyListen, ":2609")
+		viper.Set(config.KeyDrainOwner, "foo")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if _, err := New(ctx, c, nil, nil, nil); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	viper.Set(config.KeyDrainOwner, ConsumerRun)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, c, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	_ = receiver.Flush() // metrics left by other tests
+	if err := receiver.Parse("drain", bytes.NewReader([]byte(`{"foo":{"_type":"L","_value":1}}`))); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	conduits := []string{conduitReceiver}
+
+	t.Log("non-owner gets a copy")
+	{
+		for i := 0; i < 2; i++ {
+			if m := s.GetMetrics(ConsumerMetrics, conduits, "", nil); len(m) != 1 {
+				t.Fatalf("expected 1 metric, got %v", m)
+			}
+		}
+	}
+
+	t.Log("filtered owner request does not drain")
+	{
+		filter, _, err := parseMetricQuery(url.Values{"include": []string{"^bar$"}})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if m := s.GetMetrics(ConsumerRun, conduits, "", filter); len(m) != 0 {
+			t.Fatalf("expected no metrics, got %v", m)
+		}
+		if m := s.GetMetrics(ConsumerMetrics, conduits, "", nil); len(m) != 1 {
+			t.Fatalf("expected 1 metric, got %v", m)
+		}
+	}
+
+	t.Log("owner drains")
+	{
+		if m := s.GetMetrics(ConsumerRun, conduits, "", nil); len(m) != 1 {
+			t.Fatalf("expected 1 metric, got %v", m)
+		}
+		if m := s.GetMetrics(ConsumerMetrics, conduits, "", nil); len(m) != 0 {
+			t.Fatalf("expected no metrics, got %v", m)
+		}
+	}
+}
+
+func TestGetMetricsBuiltinHistogram(t *testing.T) {
+	t.Log("Testing GetMetrics w/builtin histogram, /metrics between broker requests")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	var scrapes int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&scrapes, 1)
+		fmt.Fprintln(w, "# TYPE req_seconds histogram")
+		fmt.Fprintf(w, "req_seconds_bucket{le=\"0.1\"} %d\n", 10*n)
+		fmt.Fprintf(w, "req_seconds_bucket{le=\"+Inf\"} %d\n", 10*n)
+		fmt.Fprintf(w, "req_seconds_sum %d\n", n)
+		fmt.Fprintf(w, "req_seconds_count %d\n", 10*n)
+	}))
+	defer ts.Close()
+
+	etcPath := defaults.EtcPath
+	defer func() { defaults.EtcPath = etcPath }()
+	defaults.EtcPath = t.TempDir()
+	cfg := fmt.Sprintf(`{"urls":[{"id":"foo","url":%q,"ttl":"1ns","timeout":"5s"}]}`, ts.URL)
+	if err := os.WriteFile(filepath.Join(defaults.EtcPath, "prometheus_collector.json"), []byte(cfg), 0600); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	viper.Set(config.KeyCollectors, []string{})
+	viper.Set(config.KeyMetricsCacheTTL, "0")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b, err := builtins.New(ctx)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+	s, err := New(ctx, c, b, nil, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	conduits := []string{conduitBuiltin}
+	samples := func(t *testing.T, m cgm.Metrics) uint64 {
+		t.Helper()
+		for mn, mv := range m {
+			if mv.Type != "h" {
+				continue
+			}
+			h, err := promHistogram(mv.Value)
+			if err != nil {
+				t.Fatalf("%s: unexpected error (%s)", mn, err)
+			}
+			return h.Count()
+		}
+		return 0
+	}
+
+	// first broker request, histogram baseline
+	_ = s.GetMetrics(ConsumerRun, conduits, "", nil)
+
+	t.Log("/metrics gets a copy")
+	{
+		req := httptest.NewRequest("GET", "/metrics?conduit=builtins", nil)
+		w := httptest.NewRecorder()
+		s.router(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+		}
+		if !bytes.Contains(w.Body.Bytes(), []byte("req_seconds")) {
+			t.Fatalf("expected histogram, got %s", w.Body.String())
+		}
+	}
+
+	t.Log("broker gets the samples since its last request")
+	{
+		if n := samples(t, s.GetMetrics(ConsumerRun, conduits, "", nil)); n != 20 {
+			t.Fatalf("expected 20 samples, got %d", n)
+		}
+		if n := atomic.LoadInt32(&scrapes); n != 3 {
+			t.Fatalf("expected 3 scrapes, got %d", n)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/circonus-labs/circonus-agent/internal/config"
+)
+
+// configContentTypes are the /config response content types by format.
+var configContentTypes = map[string]string{
+	"json": "application/json",
+	"toml": "application/toml",
+	"yaml": "application/yaml",
+}
+
+// showConfig handles /config, the running configuration with secrets redacted.
+// The format query parameter selects json (default), toml or yaml.
+func (s *Server) showConfig(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	contentType, ok := configContentTypes[format]
+	if !ok {
+		http.Error(w, "invalid format, expected json, toml or yaml", http.StatusBadRequest)
+		return
+	}
+
+	data, err := config.RedactedConfig(format)
+	if err != nil {
+		s.logger.Error().Err(err).Str("format", format).Msg("encoding config")
+		http.Error(w, "encoding config", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(data)
+}
+
+// testMetricFilters handles /filters/test?metric=, explaining whether the
+// metric (name with stream tags, if any) is allowed by the check bundle's
+// metric filters.
+func (s *Server) testMetricFilters(w http.ResponseWriter, r *http.Request) {
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		http.Error(w, "metric is required", http.StatusBadRequest)
+		return
+	}
+
+	if s.check == nil {
+		http.Error(w, "check not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	res, err := s.check.TestMetricFilters(metric)
+	if err != nil {
+		s.logger.Error().Err(err).Str("metric", metric).Msg("testing metric filters")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("encoding metric filter result")
+		http.Error(w, "encoding result", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
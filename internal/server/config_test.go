@@ -0,0 +1,201 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/check"
+	"github.com/circonus-labs/circonus-agent/internal/check/bundle"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestShowConfig(t *testing.T) {
+	t.Log("Testing showConfig")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	viper.Set(config.KeyAPITokenKey, "secret-token-key")
+	viper.Set(config.KeyAPITokenApp, "secret-app")
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, c, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	get := func(t *testing.T, path string) (*http.Response, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+
+		s.router(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	t.Log("json (default), secrets redacted")
+	{
+		resp, body := get(t, "/config")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("expected application/json, got %s", ct)
+		}
+		if strings.Contains(body, "secret") {
+			t.Fatalf("expected secrets redacted, got %s", body)
+		}
+		var cfg config.Config
+		if err := json.Unmarshal([]byte(body), &cfg); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if cfg.API.Key != "..." || cfg.API.App != "..." {
+			t.Fatalf("expected redacted api key/app, got %q/%q", cfg.API.Key, cfg.API.App)
+		}
+	}
+
+	t.Log("yaml")
+	{
+		resp, body := get(t, "/config?format=yaml")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/yaml" {
+			t.Fatalf("expected application/yaml, got %s", ct)
+		}
+		if strings.Contains(body, "secret") {
+			t.Fatalf("expected secrets redacted, got %s", body)
+		}
+	}
+
+	t.Log("invalid format")
+	{
+		resp, _ := get(t, "/config?format=xml")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", resp.StatusCode)
+		}
+	}
+
+	viper.Reset()
+}
+
+func TestTestMetricFilters(t *testing.T) {
+	t.Log("Testing testMetricFilters")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	viper.Set(config.KeyCheckMetricFilters, `[["deny","^foo$","foo"],["allow","^bar","tags","env:prod","prod bar"]]`)
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, c, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	get := func(t *testing.T, path string) (*http.Response, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+
+		s.router(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	decode := func(t *testing.T, body string) bundle.MetricFilterResult {
+		t.Helper()
+		var res bundle.MetricFilterResult
+		if err := json.Unmarshal([]byte(body), &res); err != nil {
+			t.Fatalf("unexpected error (%s) %s", err, body)
+		}
+		return res
+	}
+
+	t.Log("missing metric")
+	{
+		resp, _ := get(t, "/filters/test")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", resp.StatusCode)
+		}
+	}
+
+	t.Log("denied")
+	{
+		resp, body := get(t, "/filters/test?metric=foo")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		res := decode(t, body)
+		if res.Allowed {
+			t.Fatalf("expected denied, got %s", body)
+		}
+		if res.Reason != "denied by rule 0" {
+			t.Fatalf("unexpected reason (%s)", res.Reason)
+		}
+	}
+
+	t.Log("allowed, stream tags")
+	{
+		resp, body := get(t, "/filters/test?metric=bar%7CST%5Benv:prod%5D")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		res := decode(t, body)
+		if !res.Allowed {
+			t.Fatalf("expected allowed, got %s", body)
+		}
+	}
+
+	t.Log("not matched")
+	{
+		_, body := get(t, "/filters/test?metric=bar%7CST%5Benv:dev%5D")
+		res := decode(t, body)
+		if res.Allowed {
+			t.Fatalf("expected denied, got %s", body)
+		}
+		if len(res.Rules) != 2 {
+			t.Fatalf("expected 2 rules evaluated, got %d", len(res.Rules))
+		}
+	}
+
+	t.Log("no check")
+	{
+		s.check = nil
+		resp, _ := get(t, "/filters/test?metric=foo")
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d", resp.StatusCode)
+		}
+	}
+
+	viper.Reset()
+}
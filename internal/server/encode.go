@@ -0,0 +1,141 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/spf13/viper"
+)
+
+// emptyMetricsJSON is the response when metrics cannot be encoded.
+const emptyMetricsJSON = "{}"
+
+// gzipWriters pools gzip writers, each one holds ~256KB of compressor state.
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// getGzipWriter returns a pooled gzip writer, writing to w.
+func getGzipWriter(w io.Writer) *gzip.Writer {
+	gz := gzipWriters.Get().(*gzip.Writer)
+	gz.Reset(w)
+	return gz
+}
+
+// putGzipWriter returns a gzip writer to the pool.
+func putGzipWriter(gz *gzip.Writer) {
+	gz.Reset(io.Discard)
+	gzipWriters.Put(gz)
+}
+
+// acceptsGzip returns true if gzip is enabled and accepted by the client.
+func acceptsGzip(r *http.Request) bool {
+	if viper.GetBool(config.KeyDisableGzip) {
+		return false
+	}
+	acceptedEncodings := r.Header.Get("Accept-Encoding")
+	return strings.Contains(acceptedEncodings, "*") || strings.Contains(acceptedEncodings, "gzip")
+}
+
+// encodedMetrics is the JSON encoding of a set of metrics, each metric is
+// encoded once into its own "name":value entry so that the payload length is
+// known before writing and identical responses reuse the encoded entries.
+type encodedMetrics struct {
+	entries [][]byte
+	size    int64 // length of the JSON object
+}
+
+// encodeMetricsJSON encodes each metric, the entries are sorted by name so
+// the output is identical to json.Marshal.
+func encodeMetricsJSON(m *cgm.Metrics) (*encodedMetrics, error) {
+	names := make([]string, 0, len(*m))
+	for name := range *m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	em := &encodedMetrics{entries: make([][]byte, 0, len(names)), size: 2} // {}
+	for i, name := range names {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, fmt.Errorf("encode name (%s): %w", name, err)
+		}
+		val, err := json.Marshal((*m)[name])
+		if err != nil {
+			return nil, fmt.Errorf("encode metric (%s): %w", name, err)
+		}
+		entry := make([]byte, 0, len(key)+1+len(val))
+		entry = append(entry, key...)
+		entry = append(entry, ':')
+		entry = append(entry, val...)
+		em.entries = append(em.entries, entry)
+		em.size += int64(len(entry))
+		if i > 0 {
+			em.size++ // ,
+		}
+	}
+
+	return em, nil
+}
+
+// writeTo writes the encoded metrics to w as a JSON object.
+func (em *encodedMetrics) writeTo(w io.Writer) error {
+	if _, err := io.WriteString(w, "{"); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	for i, entry := range em.entries {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return fmt.Errorf("write: %w", err)
+			}
+		}
+		if _, err := w.Write(entry); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+	}
+	if _, err := io.WriteString(w, "}"); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// writeMetricsJSON writes the metrics to w as a JSON object. The output is
+// identical to json.Marshal (names sorted).
+func writeMetricsJSON(w io.Writer, m *cgm.Metrics) error {
+	em, err := encodeMetricsJSON(m)
+	if err != nil {
+		return err
+	}
+	return em.writeTo(w)
+}
+
+// gzipMetricsJSON writes the encoded metrics through a pooled gzip writer to w.
+func gzipMetricsJSON(w io.Writer, em *encodedMetrics) error {
+	gz := getGzipWriter(w)
+	defer putGzipWriter(gz)
+
+	if err := em.writeTo(gz); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("gzip close: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/check"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/circonus-labs/circonus-agent/internal/server/receiver"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func testMetrics(n int) *cgm.Metrics {
+	m := cgm.Metrics{
+		`quote"d<tag>`: cgm.Metric{Type: "s", Value: "a\nb&c"},
+		"hist":         cgm.Metric{Type: "h", Value: []string{"H[1.2e+00]=2"}},
+	}
+	for i := 0; i < n; i++ {
+		m[fmt.Sprintf("metric_%d", i)] = cgm.Metric{Type: "L", Value: uint64(i)}
+	}
+	return &m
+}
+
+func TestWriteMetricsJSON(t *testing.T) {
+	t.Log("Testing writeMetricsJSON")
+
+	t.Log("empty")
+	{
+		var buf bytes.Buffer
+		if err := writeMetricsJSON(&buf, &cgm.Metrics{}); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if buf.String() != emptyMetricsJSON {
+			t.Fatalf("expected %s, got %s", emptyMetricsJSON, buf.String())
+		}
+	}
+
+	t.Log("same as json.Marshal")
+	{
+		m := testMetrics(100)
+		expect, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		var buf bytes.Buffer
+		if err := writeMetricsJSON(&buf, m); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if !bytes.Equal(buf.Bytes(), expect) {
+			t.Fatalf("expected %s, got %s", string(expect), buf.String())
+		}
+
+		em, err := encodeMetricsJSON(m)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if em.size != int64(len(expect)) {
+			t.Fatalf("expected %d bytes, got %d", len(expect), em.size)
+		}
+	}
+
+	t.Log("invalid value")
+	{
+		m := cgm.Metrics{"bad": cgm.Metric{Type: "n", Value: func() {}}}
+		if err := writeMetricsJSON(io.Discard, &m); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestGzipMetricsJSON(t *testing.T) {
+	t.Log("Testing gzipMetricsJSON")
+
+	m := testMetrics(100)
+	expect, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	em, err := encodeMetricsJSON(m)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	// twice, second uses a pooled writer
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if err := gzipMetricsJSON(&buf, em); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		zr, err := gzip.NewReader(&buf)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if !bytes.Equal(data, expect) {
+			t.Fatalf("expected %s, got %s", string(expect), string(data))
+		}
+	}
+}
+
+func TestEncodeResponse(t *testing.T) {
+	t.Log("Testing encodeResponse")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	viper.Set(config.KeyResponseCacheTTL, "1s")
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, c, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	_ = receiver.Flush() // metrics left by other tests
+	if err := receiver.Parse("enc", bytes.NewReader([]byte(`{"foo":{"_type":"L","_value":1}}`))); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	get := func(t *testing.T, gz bool) (*http.Response, []byte) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/run?conduit=receiver", nil)
+		if gz {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+
+		s.run(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if cl := resp.Header.Get("Content-Length"); cl != strconv.Itoa(len(body)) {
+			t.Fatalf("expected content length %d, got %s", len(body), cl)
+		}
+		return resp, body
+	}
+
+	var plain []byte
+	t.Log("uncompressed")
+	{
+		resp, body := get(t, false)
+		if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+			t.Fatalf("expected no content encoding, got %s", ce)
+		}
+		var metrics map[string]interface{}
+		if err := json.Unmarshal(body, &metrics); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if len(metrics) != 1 {
+			t.Fatalf("expected 1 metric, got %v", metrics)
+		}
+		plain = body
+	}
+
+	t.Log("gzip, shared with previous request")
+	{
+		resp, body := get(t, true)
+		if ce := resp.Header.Get("Content-Encoding"); ce != "gzip" {
+			t.Fatalf("expected gzip, got %q", ce)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if !bytes.Equal(data, plain) {
+			t.Fatalf("expected %s, got %s", string(plain), string(data))
+		}
+	}
+
+	t.Log("default ttl, not shared with later request")
+	{
+		viper.Set(config.KeyResponseCacheTTL, defaults.ResponseCacheTTL)
+		s, err = New(ctx, c, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if err := receiver.Parse("enc", bytes.NewReader([]byte(`{"foo":{"_type":"L","_value":1}}`))); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if _, body := get(t, false); !bytes.Equal(body, plain) {
+			t.Fatalf("expected %s, got %s", string(plain), string(body))
+		}
+		if _, body := get(t, false); string(body) != emptyMetricsJSON {
+			t.Fatalf("expected %s, got %s", emptyMetricsJSON, string(body))
+		}
+	}
+}
@@ -0,0 +1,449 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/openhistogram/circonusllhist"
+	"github.com/spf13/viper"
+)
+
+// promExpositionType is the content type of the /metrics response (prometheus text format).
+const promExpositionType = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	promTypeGauge     = "gauge"
+	promTypeHistogram = "histogram" // written as interval gauges, see writePromExposition
+)
+
+// promIntervalSuffix is added to the names of the gauges a histogram is written as.
+const promIntervalSuffix = "_interval"
+
+var (
+	promNameInvalidRx  = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	promLabelInvalidRx = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	promLabelEscaper   = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	promHelpEscaper    = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+	errPromUnsupportedHist = fmt.Errorf("unsupported histogram value")
+)
+
+// promSeries is a sample (gauge) or histogram of a metric family.
+type promSeries struct {
+	hist   *circonusllhist.Histogram
+	labels []string // rendered name="value" pairs, sorted
+	value  string
+}
+
+// promFamily is a prometheus metric family, the series with the same name.
+type promFamily struct {
+	series map[string]promSeries // by rendered labels
+	name   string
+	help   string
+	typ    string
+}
+
+// promMetrics handles /metrics, the agent's metrics in the prometheus text
+// exposition format. Metrics flushed from a conduit (e.g. by /run) within the
+// metrics cache ttl are served, other conduits are collected on demand. The
+// include, exclude, tag and conduit query parameters select the metrics returned.
+func (s *Server) promMetrics(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	filter, conduits, err := parseMetricQuery(r.URL.Query())
+	if err != nil {
+		s.logger.Warn().Err(err).Str("url", r.URL.String()).Msg("invalid metric query")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// multi-agent mode flushes metrics on an interval, only ever use those
+	multiAgent := viper.GetBool(config.KeyMultiAgent)
+
+	metrics, stale := s.cachedMetrics(conduits, filter, multiAgent)
+	cached := len(stale) == 0
+	if !cached {
+		collect := stale
+		if len(conduits) == 0 && len(metrics) == 0 {
+			collect = nil // all conduits, including the agent metrics
+		}
+		for m, v := range s.GetMetrics(ConsumerMetrics, collect, "", filter) {
+			metrics[m] = v
+		}
+	}
+
+	var buf bytes.Buffer
+	s.writePromExposition(&buf, metrics)
+	data := buf.Bytes()
+
+	useGzip := acceptsGzip(r)
+	if useGzip {
+		var gzbuf bytes.Buffer
+		gz := getGzipWriter(&gzbuf)
+		_, err := gz.Write(data)
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+		putGzipWriter(gz)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("compressing metrics")
+			useGzip = false
+		} else {
+			w.Header().Set("Content-Encoding", "gzip")
+			data = gzbuf.Bytes()
+		}
+	}
+
+	w.Header().Set("Content-Type", promExpositionType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if _, err := w.Write(data); err != nil {
+		s.logger.Error().Err(err).Msg("writing metrics to response")
+		return
+	}
+
+	s.logger.Debug().Str("duration", time.Since(start).String()).Int("num_metrics", len(metrics)).Bool("cached", cached).Bool("compressed", useGzip).Msg("metrics response")
+}
+
+// cachedMetrics returns the metrics last flushed from the conduits (all if
+// none specified) within the metrics cache ttl, and the conduits which have
+// not been flushed within the ttl. If ignoreTTL is set, the last metrics
+// flushed from every conduit are returned.
+func (s *Server) cachedMetrics(conduits []string, filter *MetricFilter, ignoreTTL bool) (cgm.Metrics, []string) {
+	if len(conduits) == 0 {
+		conduits = []string{conduitBuiltin, conduitPlugin, conduitReceiver, conduitStatsd, conduitPrometheus}
+	}
+
+	lastConduitMetricsmu.Lock()
+	defer lastConduitMetricsmu.Unlock()
+
+	metrics := cgm.Metrics{}
+	var stale []string
+	for _, cid := range conduits {
+		prev, ok := lastConduitMetrics[cid]
+		if !ignoreTTL && (!ok || time.Since(prev.ts) > s.cacheTTL) {
+			stale = append(stale, cid)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		for m, v := range *prev.metrics {
+			if filter.Match(m) {
+				metrics[m] = v
+			}
+		}
+	}
+
+	return metrics, stale
+}
+
+// writePromExposition writes the metrics in the prometheus text exposition format.
+// Stream tags become labels (circonus internal tags, e.g. __rollup, are dropped),
+// names are sanitized and numeric metrics, including circonus counters, are
+// gauges. Circonus histograms are the samples in a collection interval (they
+// reset on every flush), not cumulative like prometheus histograms, so they are
+// written as <name>_interval_bucket (one per bin), _count and _sum gauges. Text
+// metrics are <name>_info gauges with the text as the value label.
+func (s *Server) writePromExposition(w io.Writer, metrics cgm.Metrics) {
+	l := s.logger.With().Str("op", "prom exposition").Logger()
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	families := make(map[string]*promFamily)
+	for _, metricName := range names {
+		metric := metrics[metricName]
+		baseName, mtags := tags.ParseMetricName(metricName)
+		name := promName(baseName)
+		if name == "" {
+			continue
+		}
+
+		var series promSeries
+		typ := promTypeGauge
+		sv := fmt.Sprintf("%v", metric.Value)
+
+		switch metric.Type {
+		case "i", "I", "l", "L", "n":
+			if metric.Type == "n" && strings.Contains(sv, "H[") {
+				h, err := promHistogram(strings.Fields(strings.Trim(sv, "[]")))
+				if err != nil {
+					l.Warn().Err(err).Str("metric", metricName).Msg("invalid histogram")
+					continue
+				}
+				typ = promTypeHistogram
+				series.hist = h
+				break
+			}
+			v, err := promValue(sv)
+			if err != nil {
+				l.Warn().Err(err).Str("metric", metricName).Msg("invalid value")
+				continue
+			}
+			series.value = v
+		case "h":
+			h, err := promHistogram(metric.Value)
+			if err != nil {
+				l.Warn().Err(err).Str("metric", metricName).Msg("invalid histogram")
+				continue
+			}
+			typ = promTypeHistogram
+			series.hist = h
+		case "s":
+			name += "_info"
+			mtags = append(mtags, tags.Tag{Category: "value", Value: sv})
+			series.value = "1"
+		default:
+			l.Warn().Str("metric", metricName).Str("type", metric.Type).Msg("invalid metric type")
+			continue
+		}
+
+		series.labels = promLabels(mtags)
+		lkey := strings.Join(series.labels, ",")
+
+		fam, ok := families[name]
+		if !ok {
+			fam = &promFamily{name: name, help: baseName, typ: typ, series: make(map[string]promSeries)}
+			families[name] = fam
+		}
+		if fam.typ != typ {
+			l.Warn().Str("metric", metricName).Str("family", name).Str("type", typ).Str("family_type", fam.typ).Msg("type conflicts with metric family, skipping")
+			continue
+		}
+		if _, dup := fam.series[lkey]; dup {
+			l.Warn().Str("metric", metricName).Str("family", name).Msg("duplicate series after sanitizing, skipping")
+			continue
+		}
+		fam.series[lkey] = series
+	}
+
+	famNames := make([]string, 0, len(families))
+	for name := range families {
+		famNames = append(famNames, name)
+	}
+	sort.Strings(famNames)
+
+	for _, name := range famNames {
+		fam := families[name]
+
+		keys := make([]string, 0, len(fam.series))
+		for k := range fam.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		if fam.typ == promTypeHistogram {
+			writePromIntervalHistogram(w, fam, keys)
+			continue
+		}
+
+		fmt.Fprintf(w, "# HELP %s %s\n", fam.name, promHelpEscaper.Replace(fam.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", fam.name, fam.typ)
+		for _, k := range keys {
+			series := fam.series[k]
+			fmt.Fprintf(w, "%s%s %s\n", fam.name, promLabelSet(series.labels), series.value)
+		}
+	}
+}
+
+// writePromIntervalHistogram writes a histogram family as gauges, the samples
+// in the collection interval: <name>_interval_bucket (cumulative by le within
+// the interval), <name>_interval_count and <name>_interval_sum.
+func writePromIntervalHistogram(w io.Writer, fam *promFamily, keys []string) {
+	name := fam.name + promIntervalSuffix
+	help := promHelpEscaper.Replace(fam.help) + ", samples in the collection interval"
+
+	counts := make(map[string]uint64, len(keys))
+
+	fmt.Fprintf(w, "# HELP %s_bucket %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s_bucket %s\n", name, promTypeGauge)
+	for _, k := range keys {
+		series := fam.series[k]
+		count := uint64(0)
+		for _, b := range promBuckets(series.hist) {
+			count += b.count
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, promLabelSet(append(series.labels, `le="`+b.le+`"`)), count)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, promLabelSet(append(series.labels, `le="+Inf"`)), count)
+		counts[k] = count
+	}
+
+	fmt.Fprintf(w, "# HELP %s_count %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s_count %s\n", name, promTypeGauge)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s_count%s %d\n", name, promLabelSet(fam.series[k].labels), counts[k])
+	}
+
+	fmt.Fprintf(w, "# HELP %s_sum %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s_sum %s\n", name, promTypeGauge)
+	for _, k := range keys {
+		series := fam.series[k]
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, promLabelSet(series.labels), strconv.FormatFloat(series.hist.ApproxSum(), 'g', -1, 64))
+	}
+}
+
+// promName sanitizes a metric name, invalid characters (e.g. the ` separator)
+// are replaced with _ and names starting with a digit are prefixed with _.
+func promName(name string) string {
+	if name == "" {
+		return ""
+	}
+	name = promNameInvalidRx.ReplaceAllString(name, "_")
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// promLabels returns the rendered, sorted labels for stream tags. Tags with
+// categories starting with __ (circonus internal, reserved in prometheus) are
+// dropped, a later tag replaces an earlier one with the same label name.
+func promLabels(mtags tags.Tags) []string {
+	values := make(map[string]string, len(mtags))
+	for _, t := range mtags {
+		if t.Category == "" || strings.HasPrefix(t.Category, "__") {
+			continue
+		}
+		name := promLabelInvalidRx.ReplaceAllString(t.Category, "_")
+		if name[0] >= '0' && name[0] <= '9' {
+			name = "_" + name
+		}
+		values[name] = t.Value
+	}
+
+	labels := make([]string, 0, len(values))
+	for name, value := range values {
+		labels = append(labels, name+`="`+promLabelEscaper.Replace(value)+`"`)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// promLabelSet returns the label set for a sample, empty if there are no labels.
+func promLabelSet(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// promValue returns the sample value, integers as is, otherwise as a float.
+func promValue(sv string) (string, error) {
+	if _, err := strconv.ParseInt(sv, 10, 64); err == nil {
+		return sv, nil
+	}
+	if _, err := strconv.ParseUint(sv, 10, 64); err == nil {
+		return sv, nil
+	}
+	v, err := strconv.ParseFloat(sv, 64)
+	if err != nil {
+		return "", fmt.Errorf("parse value: %w", err)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64), nil
+}
+
+// promHistogram decodes a histogram metric value, base64 serialized or a list of bins (H[v]=n).
+func promHistogram(val interface{}) (*circonusllhist.Histogram, error) {
+	var bins []string
+	switch v := val.(type) {
+	case string:
+		if strings.HasPrefix(v, "H[") {
+			bins = strings.Fields(v)
+			break
+		}
+		data, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("decode histogram: %w", err)
+		}
+		h, err := circonusllhist.Deserialize(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("deserialize histogram: %w", err)
+		}
+		return h, nil
+	case []string:
+		bins = v
+	case []interface{}:
+		for _, b := range v {
+			bins = append(bins, fmt.Sprintf("%v", b))
+		}
+	default:
+		return nil, fmt.Errorf("%T: %w", val, errPromUnsupportedHist)
+	}
+
+	h, err := circonusllhist.NewFromStrings(bins, false)
+	if err != nil {
+		return nil, fmt.Errorf("parse histogram: %w", err)
+	}
+	return h, nil
+}
+
+// promBucket is a histogram bin as a (non-cumulative) prometheus bucket.
+type promBucket struct {
+	le    string
+	upper float64
+	count uint64
+}
+
+// promBuckets returns the histogram bins as buckets, sorted by upper bound. The
+// upper bound of a positive bin is its value plus its width (e.g. H[1.2e+00] is
+// [1.2,1.3), le="1.3"), of a negative bin its value.
+func promBuckets(h *circonusllhist.Histogram) []promBucket {
+	buckets := make([]promBucket, 0, h.BinCount())
+	for _, bin := range h.DecStrings() {
+		// H[1.2e+00]=3
+		parts := strings.SplitN(strings.TrimPrefix(bin, "H["), "]=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		count, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil || count == 0 {
+			continue
+		}
+		mexp := strings.SplitN(parts[0], "e", 2)
+		if len(mexp) != 2 {
+			continue
+		}
+		mantissa, err := strconv.ParseFloat(mexp[0], 64)
+		if err != nil || math.IsNaN(mantissa) {
+			continue
+		}
+		exp, err := strconv.Atoi(mexp[1])
+		if err != nil {
+			continue
+		}
+		if mantissa > 0 {
+			mantissa += 0.1
+		}
+		upper, err := strconv.ParseFloat(fmt.Sprintf("%.1fe%d", mantissa, exp), 64)
+		if err != nil {
+			continue
+		}
+		buckets = append(buckets, promBucket{upper: upper, count: count})
+	}
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].upper < buckets[j].upper })
+	for i := range buckets {
+		buckets[i].le = strconv.FormatFloat(buckets[i].upper, 'g', -1, 64)
+	}
+	return buckets
+}
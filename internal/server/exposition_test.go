@@ -0,0 +1,337 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/check"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/server/receiver"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/openhistogram/circonusllhist"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestPromName(t *testing.T) {
+	t.Log("Testing promName")
+
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{"valid", "cpu_user", "cpu_user"},
+		{"separator", "test`t1", "test_t1"},
+		{"invalid chars", "disk.sda-1/io", "disk_sda_1_io"},
+		{"leading digit", "1min", "_1min"},
+		{"colon", "a:b", "a:b"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if out := promName(tt.in); out != tt.out {
+				t.Fatalf("expected %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestPromLabels(t *testing.T) {
+	t.Log("Testing promLabels")
+
+	mtags := tags.Tags{
+		{Category: "units", Value: "bytes"},
+		{Category: "collector", Value: "procfs/cpu"},
+		{Category: "__rollup", Value: "false"},
+		{Category: "host-name", Value: `a "b" \c`},
+		{Category: "1x", Value: "y"},
+	}
+	expect := `_1x="y",collector="procfs/cpu",host_name="a \"b\" \\c",units="bytes"`
+	if labels := strings.Join(promLabels(mtags), ","); labels != expect {
+		t.Fatalf("expected %s, got %s", expect, labels)
+	}
+	if set := promLabelSet(nil); set != "" {
+		t.Fatalf("expected empty label set, got %s", set)
+	}
+}
+
+func TestPromBuckets(t *testing.T) {
+	t.Log("Testing promBuckets")
+
+	h := circonusllhist.New(circonusllhist.NoLocks())
+	_ = h.RecordValues(1.23, 2)
+	_ = h.RecordValues(0, 1)
+	_ = h.RecordValues(-2, 1)
+	_ = h.RecordValues(150, 3)
+
+	buckets := promBuckets(h)
+	expect := []struct {
+		le    string
+		count uint64
+	}{
+		{"-2", 1},
+		{"0", 1},
+		{"1.3", 2},
+		{"160", 3},
+	}
+	if len(buckets) != len(expect) {
+		t.Fatalf("expected %d buckets, got %d (%v)", len(expect), len(buckets), buckets)
+	}
+	for i, e := range expect {
+		if buckets[i].le != e.le || buckets[i].count != e.count {
+			t.Fatalf("bucket %d expected %s=%d, got %s=%d", i, e.le, e.count, buckets[i].le, buckets[i].count)
+		}
+	}
+}
+
+func TestPromHistogram(t *testing.T) {
+	t.Log("Testing promHistogram")
+
+	h := circonusllhist.New(circonusllhist.NoLocks())
+	_ = h.RecordValues(1.23, 2)
+	var b64 bytes.Buffer
+	if err := h.SerializeB64(&b64); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	tests := []struct {
+		val        interface{}
+		name       string
+		count      uint64
+		shouldFail bool
+	}{
+		{b64.String(), "base64", 2, false},
+		{"H[1.2e+00]=2 H[2.0e+00]=1", "bins string", 3, false},
+		{[]string{"H[1.2e+00]=2"}, "bins", 2, false},
+		{[]interface{}{"H[1.2e+00]=2", "H[3.0e+00]=4"}, "bins interface", 6, false},
+		{"invalid!", "invalid base64", 0, true},
+		{42, "invalid type", 0, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h, err := promHistogram(tt.val)
+			if tt.shouldFail {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			if h.Count() != tt.count {
+				t.Fatalf("expected count %d, got %d", tt.count, h.Count())
+			}
+		})
+	}
+}
+
+func TestWritePromExposition(t *testing.T) {
+	t.Log("Testing writePromExposition")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, c, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	cpuTags := tags.Tags{{Category: "collector", Value: "procfs/cpu"}, {Category: "__rollup", Value: "false"}}
+	metrics := cgm.Metrics{
+		tags.MetricNameWithStreamTags("cpu`user", cpuTags):                                  cgm.Metric{Type: "L", Value: uint64(10)},
+		tags.MetricNameWithStreamTags("cpu`user", tags.Tags{{Category: "cpu", Value: "0"}}): cgm.Metric{Type: "L", Value: uint64(4)},
+		"load`1min": cgm.Metric{Type: "n", Value: 0.25},
+		"latency":   cgm.Metric{Type: "h", Value: []string{"H[1.2e+00]=2", "H[3.0e+00]=1"}},
+		"agent_version|ST[b\"c291cmNl\":b\"YWdlbnQ=\"]": cgm.Metric{Type: "s", Value: "circonus-agent_1.0.0"},
+		"bad":                              cgm.Metric{Type: "L", Value: "abc"},
+		"conflict":                         cgm.Metric{Type: "L", Value: 1},
+		"conflict|ST[b\"YQ==\":b\"Yg==\"]": cgm.Metric{Type: "h", Value: []string{"H[1.0e+00]=1"}},
+	}
+
+	var buf bytes.Buffer
+	s.writePromExposition(&buf, metrics)
+
+	expect := `# HELP agent_version_info agent_version
+# TYPE agent_version_info gauge
+agent_version_info{source="agent",value="circonus-agent_1.0.0"} 1
+# HELP conflict conflict
+# TYPE conflict gauge
+conflict 1
+# HELP cpu_user cpu` + "`" + `user
+# TYPE cpu_user gauge
+cpu_user{collector="procfs/cpu"} 10
+cpu_user{cpu="0"} 4
+# HELP latency_interval_bucket latency, samples in the collection interval
+# TYPE latency_interval_bucket gauge
+latency_interval_bucket{le="1.3"} 2
+latency_interval_bucket{le="3.1"} 3
+latency_interval_bucket{le="+Inf"} 3
+# HELP latency_interval_count latency, samples in the collection interval
+# TYPE latency_interval_count gauge
+latency_interval_count 3
+# HELP latency_interval_sum latency, samples in the collection interval
+# TYPE latency_interval_sum gauge
+latency_interval_sum 5.55
+# HELP load_1min load` + "`" + `1min
+# TYPE load_1min gauge
+load_1min 0.25
+`
+	if buf.String() != expect {
+		t.Fatalf("expected\n%s\ngot\n%s", expect, buf.String())
+	}
+}
+
+func TestPromMetrics(t *testing.T) {
+	t.Log("Testing promMetrics")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	viper.Set(config.KeyMetricsCacheTTL, "1m")
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, c, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	get := func(t *testing.T, path string) (*http.Response, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+
+		s.promMetrics(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	_ = receiver.Flush() // metrics left by other tests
+	lastConduitMetricsmu.Lock()
+	lastConduitMetrics = make(map[string]*previousMetrics)
+	lastConduitMetricsmu.Unlock()
+
+	t.Log("invalid query -> 400")
+	{
+		if resp, _ := get(t, "/metrics?include=("); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected %d, got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+
+	t.Log("on demand (no cache)")
+	{
+		if err := receiver.Parse("expo", bytes.NewReader([]byte(`{"ondemand":{"_type":"L","_value":1}}`))); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		resp, body := get(t, "/metrics?conduit=receiver")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != promExpositionType {
+			t.Fatalf("expected content type %s, got %s", promExpositionType, ct)
+		}
+		if !strings.Contains(body, "# TYPE ondemand gauge\n") || !strings.Contains(body, `ondemand{collector="write",collector_id="expo"`) {
+			t.Fatalf("expected ondemand metric, got %s", body)
+		}
+	}
+
+	t.Log("on demand does not drain")
+	{
+		_, body := get(t, "/metrics?conduit=receiver")
+		if !strings.Contains(body, "ondemand{") {
+			t.Fatalf("expected accumulated metrics, got %s", body)
+		}
+		lastConduitMetricsmu.Lock()
+		_, ok := lastConduitMetrics[conduitReceiver]
+		lastConduitMetricsmu.Unlock()
+		if ok {
+			t.Fatal("expected receiver not flushed")
+		}
+	}
+
+	t.Log("cached (flushed by /run, accumulated metrics not flushed)")
+	{
+		if m := s.GetMetrics(ConsumerRun, []string{conduitReceiver}, "", nil); len(m) != 1 {
+			t.Fatalf("expected 1 metric flushed, got %d", len(m))
+		}
+		if err := receiver.Parse("expo", bytes.NewReader([]byte(`{"pending":{"_type":"L","_value":1}}`))); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		_, body := get(t, "/metrics?conduit=receiver")
+		if !strings.Contains(body, "ondemand{") || strings.Contains(body, "pending{") {
+			t.Fatalf("expected cached metrics, got %s", body)
+		}
+	}
+
+	t.Log("expired cache, collect on demand")
+	{
+		lastConduitMetricsmu.Lock()
+		lastConduitMetrics[conduitReceiver].ts = time.Now().Add(-2 * time.Minute)
+		lastConduitMetricsmu.Unlock()
+		_, body := get(t, "/metrics?conduit=receiver")
+		if !strings.Contains(body, "pending{") || strings.Contains(body, "ondemand{") {
+			t.Fatalf("expected collected metrics, got %s", body)
+		}
+	}
+
+	t.Log("cache freshness per conduit")
+	{
+		saveConduitMetrics(conduitStatsd, "", &cgm.Metrics{"fresh": cgm.Metric{Type: "L", Value: 1}})
+		_, body := get(t, "/metrics?conduit=receiver,statsd")
+		if !strings.Contains(body, "fresh ") && !strings.Contains(body, "fresh{") {
+			t.Fatalf("expected cached statsd metrics, got %s", body)
+		}
+		if !strings.Contains(body, "pending{") {
+			t.Fatalf("expected collected receiver metrics, got %s", body)
+		}
+	}
+
+	t.Log("gzip")
+	{
+		req := httptest.NewRequest("GET", "/metrics?conduit=receiver", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		s.promMetrics(w, req)
+
+		resp := w.Result()
+		resp.Body.Close()
+		if ce := resp.Header.Get("Content-Encoding"); ce != "gzip" {
+			t.Fatalf("expected gzip, got %q", ce)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+)
+
+// query parameters selecting metrics on /run.
+const (
+	queryInclude = "include" // metric name regex, metric included if any match
+	queryExclude = "exclude" // metric name regex, metric excluded if any match
+	queryTag     = "tag"     // tag selector (category:value or category:*), all must match
+	queryConduit = "conduit" // conduit(s) to collect from
+)
+
+var (
+	errFilterInvalidTag     = fmt.Errorf("invalid tag selector, expected category:value")
+	errFilterInvalidConduit = fmt.Errorf("invalid conduit, expected builtins, plugins, receiver, statsd or prometheus")
+)
+
+// MetricFilter selects metrics by name and stream tags.
+type MetricFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	tags    tags.Tags
+}
+
+// parseMetricQuery returns the metric filter (nil if no filter parameters are
+// set) and conduits selected by the request query parameters.
+func parseMetricQuery(values url.Values) (*MetricFilter, []string, error) {
+	f := &MetricFilter{}
+
+	for _, expr := range values[queryInclude] {
+		rx, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s (%s): %w", queryInclude, expr, err)
+		}
+		f.include = append(f.include, rx)
+	}
+
+	for _, expr := range values[queryExclude] {
+		rx, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s (%s): %w", queryExclude, expr, err)
+		}
+		f.exclude = append(f.exclude, rx)
+	}
+
+	for _, sel := range values[queryTag] {
+		tp := strings.SplitN(sel, tags.Delimiter, 2)
+		if len(tp) != 2 || tp[0] == "" || tp[1] == "" {
+			return nil, nil, fmt.Errorf("%s (%s): %w", queryTag, sel, errFilterInvalidTag)
+		}
+		f.tags = append(f.tags, tags.Tag{Category: strings.ToLower(tp[0]), Value: tp[1]})
+	}
+
+	var conduits []string
+	for _, v := range values[queryConduit] {
+		for _, cid := range strings.Split(v, ",") {
+			switch cid = strings.TrimSpace(cid); cid {
+			case conduitBuiltin, conduitPlugin, conduitReceiver, conduitStatsd, conduitPrometheus:
+				conduits = append(conduits, cid)
+			case "prom":
+				conduits = append(conduits, conduitPrometheus)
+			case "write":
+				conduits = append(conduits, conduitReceiver)
+			default:
+				return nil, nil, fmt.Errorf("%s (%s): %w", queryConduit, cid, errFilterInvalidConduit)
+			}
+		}
+	}
+
+	if len(f.include) == 0 && len(f.exclude) == 0 && len(f.tags) == 0 {
+		return nil, conduits, nil
+	}
+
+	return f, conduits, nil
+}
+
+// Match returns true if the metric (name with stream tags) is selected by the filter.
+func (f *MetricFilter) Match(metricName string) bool {
+	if f == nil {
+		return true
+	}
+
+	name, mtags := tags.ParseMetricName(metricName)
+
+	if len(f.include) > 0 {
+		included := false
+		for _, rx := range f.include {
+			if rx.MatchString(name) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, rx := range f.exclude {
+		if rx.MatchString(name) {
+			return false
+		}
+	}
+
+	for _, sel := range f.tags {
+		found := false
+		for _, t := range mtags {
+			if strings.EqualFold(t.Category, sel.Category) && (sel.Value == "*" || t.Value == sel.Value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,200 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/check"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/server/receiver"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestParseMetricQuery(t *testing.T) {
+	t.Log("Testing parseMetricQuery")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	tests := []struct {
+		name       string
+		query      string
+		conduits   []string
+		wantFilter bool
+		shouldFail bool
+	}{
+		{"empty", "", nil, false, false},
+		{"unknown param", "foo=bar", nil, false, false},
+		{"include", "include=^cpu", nil, true, false},
+		{"exclude", "exclude=idle$", nil, true, false},
+		{"tag", "tag=collector:procfs/cpu", nil, true, false},
+		{"tag wildcard", "tag=collector:*", nil, true, false},
+		{"conduit", "conduit=statsd", []string{conduitStatsd}, false, false},
+		{"conduit list", "conduit=builtins,prom&conduit=write", []string{conduitBuiltin, conduitPrometheus, conduitReceiver}, false, false},
+		{"invalid include", "include=(", nil, false, true},
+		{"invalid exclude", "exclude=[a", nil, false, true},
+		{"invalid tag", "tag=collector", nil, false, true},
+		{"invalid tag, no value", "tag=collector:", nil, false, true},
+		{"invalid conduit", "conduit=foo", nil, false, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parsing query (%s)", err)
+			}
+			filter, conduits, err := parseMetricQuery(values)
+			if tt.shouldFail {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			if tt.wantFilter && filter == nil {
+				t.Fatal("expected filter")
+			}
+			if !tt.wantFilter && filter != nil {
+				t.Fatalf("expected nil filter, got %#v", filter)
+			}
+			if strings.Join(conduits, ",") != strings.Join(tt.conduits, ",") {
+				t.Fatalf("expected conduits %v, got %v", tt.conduits, conduits)
+			}
+		})
+	}
+}
+
+func TestMetricFilterMatch(t *testing.T) {
+	t.Log("Testing MetricFilter.Match")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	cpuUser := tags.MetricNameWithStreamTags("cpu_user", tags.Tags{{Category: "collector", Value: "procfs/cpu"}, {Category: "units", Value: "centiseconds"}})
+	cpuIdle := tags.MetricNameWithStreamTags("cpu_idle", tags.Tags{{Category: "collector", Value: "procfs/cpu"}})
+	memFree := tags.MetricNameWithStreamTags("mem_free", tags.Tags{{Category: "collector", Value: "procfs/mem"}})
+
+	tests := []struct {
+		name   string
+		query  string
+		metric string
+		match  bool
+	}{
+		{"no filter", "", cpuUser, true},
+		{"include match", "include=^cpu_", cpuUser, true},
+		{"include no match", "include=^cpu_", memFree, false},
+		{"include any", "include=^cpu_&include=^mem_", memFree, true},
+		{"include ignores tags", "include=procfs", cpuUser, false},
+		{"exclude match", "exclude=idle$", cpuIdle, false},
+		{"exclude no match", "exclude=idle$", cpuUser, true},
+		{"include and exclude", "include=^cpu_&exclude=idle$", cpuIdle, false},
+		{"tag match", "tag=collector:procfs/cpu", cpuUser, true},
+		{"tag no match", "tag=collector:procfs/cpu", memFree, false},
+		{"tag category case", "tag=Collector:procfs/mem", memFree, true},
+		{"tag wildcard", "tag=units:*", cpuUser, true},
+		{"tag wildcard no match", "tag=units:*", cpuIdle, false},
+		{"tags all", "tag=collector:procfs/cpu&tag=units:centiseconds", cpuUser, true},
+		{"tags all no match", "tag=collector:procfs/cpu&tag=units:centiseconds", cpuIdle, false},
+		{"untagged metric", "tag=collector:*", "foo", false},
+		{"untagged metric include", "include=^foo$", "foo", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parsing query (%s)", err)
+			}
+			filter, _, err := parseMetricQuery(values)
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			if m := filter.Match(tt.metric); m != tt.match {
+				t.Fatalf("expected %v, got %v", tt.match, m)
+			}
+		})
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	t.Log("Testing run w/filters")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, c, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	t.Log("invalid queries -> 400")
+	for _, path := range []string{"/run?include=(", "/run?tag=foo", "/run?conduit=foo", "/run/write?conduit=statsd"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+
+		s.run(w, req)
+
+		resp := w.Result()
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s expected %d, got %d", path, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+
+	t.Log("receiver conduit, include and tag")
+	{
+		data := `{"cpu_user":{"_type":"L","_value":1},"cpu_idle":{"_type":"L","_value":2},"mem_free":{"_type":"L","_value":3}}`
+		if err := receiver.Parse("foo", bytes.NewReader([]byte(data))); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+
+		req := httptest.NewRequest("GET", "/run?conduit=receiver&include=^cpu_&exclude=idle&tag=collector_id:foo", nil)
+		w := httptest.NewRecorder()
+
+		s.run(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+
+		var metrics map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if len(metrics) != 1 {
+			t.Fatalf("expected 1 metric, got %d (%v)", len(metrics), metrics)
+		}
+		for name := range metrics {
+			if !strings.HasPrefix(name, "cpu_user|ST[") {
+				t.Fatalf("expected cpu_user, got %s", name)
+			}
+		}
+	}
+}
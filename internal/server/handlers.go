@@ -6,9 +6,7 @@
 package server
 
 import (
-	"bytes"
-	"compress/gzip"
-	"encoding/json"
+	"bufio"
 	"fmt"
 	"io"
 	"net/http"
@@ -39,13 +37,25 @@ const (
 )
 
 // run handles requests to execute plugins and return metrics emitted
-// handles /, /run, or /run/plugin_name.
+// handles /, /run, or /run/plugin_name. The metrics returned can be
+// filtered with the include, exclude, tag and conduit query parameters.
 func (s *Server) run(w http.ResponseWriter, r *http.Request) {
 	runStart := time.Now()
 	id := ""
 
+	filter, queryConduits, err := parseMetricQuery(r.URL.Query())
+	if err != nil {
+		s.logger.Warn().Err(err).Str("url", r.URL.String()).Msg("invalid metric query")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if strings.HasPrefix(r.URL.Path, "/run/") { // run specific item
 		id = strings.ReplaceAll(r.URL.Path, "/run/", "")
+		if id != "" && len(queryConduits) > 0 {
+			http.Error(w, "conduit cannot be combined with a specific item", http.StatusBadRequest)
+			return
+		}
 		if id != "" {
 			idOK := false
 
@@ -76,6 +86,9 @@ func (s *Server) run(w http.ResponseWriter, r *http.Request) {
 	}
 
 	conduitList := []string{} // default, empty list defaults to all known
+	if len(queryConduits) > 0 {
+		conduitList = queryConduits
+	}
 	if id != "" {
 		// identify conduit to collect from based on id passed
 		switch {
@@ -92,23 +105,38 @@ func (s *Server) run(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	metrics := s.GetMetrics(conduitList, id)
-	s.logger.Debug().Int("num_metrics", len(metrics)).Msg("aggregated")
+	// identical requests (e.g. concurrent polls) share the collected metrics and encoded payload
+	cr, shared := s.respCache.get(r.URL.RequestURI(), func() *cgm.Metrics {
+		metrics := s.GetMetrics(ConsumerRun, conduitList, id, filter)
+		s.logger.Debug().Int("num_metrics", len(metrics)).Msg("aggregated")
+
+		// filtered results are partial, keep the last complete set for /prom
+		if filter == nil && len(queryConduits) == 0 {
+			lastMetricsmu.Lock()
+			lastMetrics.metrics = &metrics
+			lastMetrics.ts = time.Now()
+			lastMetricsmu.Unlock()
+		}
 
-	lastMetricsmu.Lock()
-	lastMetrics.metrics = &metrics
-	lastMetrics.ts = time.Now()
-	lastMetricsmu.Unlock()
+		// if err := s.check.EnableNewMetrics(&metrics); err != nil {
+		// 	s.logger.Warn().Err(err).Msg("unable to update check bundle metrics")
+		// }
 
-	// if err := s.check.EnableNewMetrics(&metrics); err != nil {
-	// 	s.logger.Warn().Err(err).Msg("unable to update check bundle metrics")
-	// }
+		return &metrics
+	})
 
-	s.encodeResponse(&metrics, w, r, runStart)
+	s.encodeResponse(cr, w, r, runStart, shared)
 }
 
 // GetMetrics collects metrics from the various conduits and returns them for disposition.
-func (s *Server) GetMetrics(conduits []string, id string) cgm.Metrics {
+// If filter is not nil, only metrics matching the filter are returned.
+// Concurrent callers share the collection from each conduit. The accumulating
+// conduits (receiver, statsd, prometheus) and builtins (e.g. prometheus
+// histograms) are drained if the consumer is the drain owner, otherwise the
+// consumer gets a copy of the accumulated metrics.
+// Filtered requests always get a copy, metrics not matching the filter are
+// discarded and must not be taken from the drain owner.
+func (s *Server) GetMetrics(consumer string, conduits []string, id string, filter *MetricFilter) cgm.Metrics {
 	includeAgentMetrics := false
 	// default to all conduits if list is empty
 	if len(conduits) == 0 {
@@ -117,6 +145,7 @@ func (s *Server) GetMetrics(conduits []string, id string) cgm.Metrics {
 	}
 
 	collectStart := time.Now()
+	drain := s.drains(consumer) && filter == nil
 
 	type conduit struct {
 		metrics *cgm.Metrics
@@ -133,10 +162,17 @@ func (s *Server) GetMetrics(conduits []string, id string) cgm.Metrics {
 				start := time.Now()
 				numMetrics := 0
 				s.logger.Debug().Str("conduit_id", conduitID).Msg("start")
-				if err := s.builtins.Run(s.groupCtx, id); err != nil {
-					s.logger.Error().Err(err).Str("id", id).Msg("running builtin")
-				}
-				builtinMetrics := s.builtins.Flush(id)
+				builtinMetrics := s.collector.collect(conduitID+"/"+id, drain, func() *cgm.Metrics {
+					if err := s.builtins.Run(s.groupCtx, id); err != nil {
+						s.logger.Error().Err(err).Str("id", id).Msg("running builtin")
+					}
+					if !drain {
+						return s.builtins.Snapshot(id)
+					}
+					m := s.builtins.Flush(id)
+					saveConduitMetrics(conduitID, id, m)
+					return m
+				})
 				if builtinMetrics != nil && len(*builtinMetrics) > 0 {
 					numMetrics = len(*builtinMetrics)
 					conduitCh <- conduit{id: conduitID, metrics: builtinMetrics}
@@ -153,10 +189,14 @@ func (s *Server) GetMetrics(conduits []string, id string) cgm.Metrics {
 				start := time.Now()
 				numMetrics := 0
 				s.logger.Debug().Str("conduit_id", conduitID).Msg("start")
-				if err := s.plugins.Run(id); err != nil {
-					s.logger.Error().Err(err).Str("id", id).Msg("running plugin")
-				}
-				pluginMetrics := s.plugins.Flush(id)
+				pluginMetrics := s.collector.collect(conduitID+"/"+id, true, func() *cgm.Metrics {
+					if err := s.plugins.Run(id); err != nil {
+						s.logger.Error().Err(err).Str("id", id).Msg("running plugin")
+					}
+					m := s.plugins.Flush(id)
+					saveConduitMetrics(conduitID, id, m)
+					return m
+				})
 				if pluginMetrics != nil && len(*pluginMetrics) > 0 {
 					numMetrics = len(*pluginMetrics)
 					conduitCh <- conduit{id: conduitID, metrics: pluginMetrics}
@@ -170,7 +210,14 @@ func (s *Server) GetMetrics(conduits []string, id string) cgm.Metrics {
 				start := time.Now()
 				numMetrics := 0
 				s.logger.Debug().Str("conduit_id", conduitID).Msg("start")
-				receiverMetrics := receiver.Flush()
+				receiverMetrics := s.collector.collect(conduitID, drain, func() *cgm.Metrics {
+					if !drain {
+						return receiver.Snapshot()
+					}
+					m := receiver.Flush()
+					saveConduitMetrics(conduitID, id, m)
+					return m
+				})
 				if receiverMetrics != nil && len(*receiverMetrics) > 0 {
 					numMetrics = len(*receiverMetrics)
 					conduitCh <- conduit{id: conduitID, metrics: receiverMetrics}
@@ -185,7 +232,14 @@ func (s *Server) GetMetrics(conduits []string, id string) cgm.Metrics {
 					start := time.Now()
 					numMetrics := 0
 					s.logger.Debug().Str("conduit_id", conduitID).Msg("start")
-					statsdMetrics := s.statsdSvr.Flush()
+					statsdMetrics := s.collector.collect(conduitID, drain, func() *cgm.Metrics {
+						if !drain {
+							return s.statsdSvr.Snapshot()
+						}
+						m := s.statsdSvr.Flush()
+						saveConduitMetrics(conduitID, id, m)
+						return m
+					})
 					if statsdMetrics != nil && len(*statsdMetrics) > 0 {
 						numMetrics = len(*statsdMetrics)
 						conduitCh <- conduit{id: conduitID, metrics: statsdMetrics}
@@ -200,7 +254,14 @@ func (s *Server) GetMetrics(conduits []string, id string) cgm.Metrics {
 				start := time.Now()
 				numMetrics := 0
 				s.logger.Debug().Str("conduit_id", conduitID).Msg("start")
-				promMetrics := promrecv.Flush()
+				promMetrics := s.collector.collect(conduitID, drain, func() *cgm.Metrics {
+					if !drain {
+						return promrecv.Snapshot()
+					}
+					m := promrecv.Flush()
+					saveConduitMetrics(conduitID, id, m)
+					return m
+				})
 				if promMetrics != nil && len(*promMetrics) > 0 {
 					numMetrics = len(*promMetrics)
 					conduitCh <- conduit{id: conduitID, metrics: promMetrics}
@@ -242,6 +303,14 @@ func (s *Server) GetMetrics(conduits []string, id string) cgm.Metrics {
 		s.agentStats(metrics, mtags)
 	}
 
+	if filter != nil {
+		for m := range metrics {
+			if !filter.Match(m) {
+				delete(metrics, m)
+			}
+		}
+	}
+
 	s.logger.Debug().Str("duration", cdur.String()).Msg("collection complete")
 
 	return metrics
@@ -252,8 +321,9 @@ func (s *Server) GetMetrics(conduits []string, id string) cgm.Metrics {
 // it receives it. The agent does support gzip compression when the correct header
 // is supplied (Accept-Encoding: * or Accept-Encoding: gzip). The command line option
 // --no-gzip overrides and will result in unencoded response regardless of what the
-// Accept-Encoding header specifies.
-func (s *Server) encodeResponse(m *cgm.Metrics, w http.ResponseWriter, r *http.Request, runStart time.Time) {
+// client asks for. Each metric is encoded once, the Content-Length is known before
+// writing and the encoded metrics (and compressed payload) are shared by identical requests.
+func (s *Server) encodeResponse(cr *cachedResponse, w http.ResponseWriter, r *http.Request, runStart time.Time, shared bool) {
 	//
 	// if an error occurs, it is logged and empty {} metrics are returned
 	//
@@ -262,60 +332,57 @@ func (s *Server) encodeResponse(m *cgm.Metrics, w http.ResponseWriter, r *http.R
 	w.Header().Set("Transfer-Encoding", "identity")
 	w.Header().Set("Content-Type", "application/json")
 
-	var data []byte
-	var jsonData []byte
+	useGzip := acceptsGzip(r)
+
+	var gzData []byte
+	var enc *encodedMetrics
+	var contentLen int64
 	var err error
-	var useGzip bool
 
-	if viper.GetBool(config.KeyDisableGzip) {
-		useGzip = false
+	if useGzip {
+		gzData, err = cr.gzipped()
+		contentLen = int64(len(gzData))
 	} else {
-		acceptedEncodings := r.Header.Get("Accept-Encoding")
-		useGzip = strings.Contains(acceptedEncodings, "*") || strings.Contains(acceptedEncodings, "gzip")
+		enc, err = cr.encoded()
+		if err == nil {
+			contentLen = enc.size
+		}
 	}
 
-	jsonData, err = json.Marshal(m)
 	if err != nil {
 		// log the error and respond with empty metrics
 		s.logger.Error().
 			Err(err).
-			Interface("metrics", m).
-			Msg("encoding metrics to JSON for response")
-		jsonData = []byte("{}")
-	}
-	data = jsonData
-
-	if useGzip {
-		var buf bytes.Buffer
-		gz := gzip.NewWriter(&buf)
-		_, err := gz.Write(jsonData)
-		gz.Close()
-		if err != nil {
-			// log the error and respond with empty metrics
-			s.logger.Error().
-				Err(err).
-				Msg("compressing metrics")
-			data = []byte("{}")
-		} else {
+			Msg("encoding metrics for response")
+		useGzip = false
+		contentLen = int64(len(emptyMetricsJSON))
+		w.Header().Set("Content-Length", strconv.FormatInt(contentLen, 10))
+		_, err = io.WriteString(w, emptyMetricsJSON)
+	} else {
+		if useGzip {
 			w.Header().Set("Content-Encoding", "gzip")
-			data = buf.Bytes()
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(contentLen, 10))
+		if useGzip {
+			_, err = w.Write(gzData)
+		} else {
+			err = enc.writeTo(w)
 		}
 	}
-
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
-	if _, err := w.Write(data); err != nil {
+	if err != nil {
 		s.logger.Error().
 			Err(err).
 			Msg("writing metrics to response")
 		return
 	}
 
-	s.logger.Info().Str("duration", time.Since(runStart).String()).Int("num_metrics", len(*m)).Bool("compressed", useGzip).Int("content_bytes", len(data)).Msg("request response")
+	s.logger.Info().Str("duration", time.Since(runStart).String()).Int("num_metrics", len(*cr.metrics)).Bool("compressed", useGzip).Bool("shared", shared).Int64("content_bytes", contentLen).Msg("request response")
 
+	// shared responses were already dumped by the request which collected them
 	dumpDir := viper.GetString(config.KeyDebugDumpMetrics)
-	if dumpDir != "" {
+	if dumpDir != "" && !shared {
 		dumpFile := filepath.Join(dumpDir, "metrics_"+time.Now().Format("20060102_150405")+".json")
-		if err := os.WriteFile(dumpFile, jsonData, 0644); err != nil { //nolint:gosec
+		if err := dumpMetrics(dumpFile, cr.metrics); err != nil {
 			s.logger.Error().
 				Err(err).
 				Str("file", dumpFile).
@@ -324,6 +391,27 @@ func (s *Server) encodeResponse(m *cgm.Metrics, w http.ResponseWriter, r *http.R
 	}
 }
 
+// dumpMetrics streams the metrics, as JSON, to a file.
+func dumpMetrics(dumpFile string, m *cgm.Metrics) error {
+	f, err := os.OpenFile(dumpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	bw := bufio.NewWriter(f)
+	if err := writeMetricsJSON(bw, m); err != nil {
+		f.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("flush: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	return nil
+}
+
 // inventory returns the current, active plugin inventory.
 func (s *Server) inventory(w http.ResponseWriter) {
 	inventory := s.plugins.Inventory()
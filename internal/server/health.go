@@ -0,0 +1,143 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// component status on /health/ready.
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+)
+
+// HealthFunc returns the status detail of a component (e.g. a connection state)
+// and an error if the component is degraded.
+type HealthFunc func() (string, error)
+
+type healthCheck struct {
+	fn       HealthFunc
+	name     string
+	critical bool // a degraded critical component makes the agent not ready
+}
+
+// componentHealth is the /health/ready status of a component.
+type componentHealth struct {
+	Status   string `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Critical bool   `json:"critical"`
+}
+
+// readiness is the /health/ready response.
+type readiness struct {
+	Components map[string]componentHealth `json:"components"`
+	Status     string                     `json:"status"`
+	Ready      bool                       `json:"ready"`
+}
+
+// AddHealthCheck adds a component to the readiness report (/health/ready). If a
+// critical component is degraded the agent is not ready, /health/ready returns 503.
+func (s *Server) AddHealthCheck(name string, critical bool, fn HealthFunc) {
+	if fn == nil {
+		return
+	}
+
+	s.healthmu.Lock()
+	defer s.healthmu.Unlock()
+
+	for i, hc := range s.healthChecks {
+		if hc.name == name {
+			s.healthChecks[i] = healthCheck{name: name, critical: critical, fn: fn}
+			return
+		}
+	}
+	s.healthChecks = append(s.healthChecks, healthCheck{name: name, critical: critical, fn: fn})
+	sort.Slice(s.healthChecks, func(i, j int) bool { return s.healthChecks[i].name < s.healthChecks[j].name })
+}
+
+// readiness returns the status of the registered components.
+func (s *Server) readiness() readiness {
+	s.healthmu.Lock()
+	checks := make([]healthCheck, len(s.healthChecks))
+	copy(checks, s.healthChecks)
+	s.healthmu.Unlock()
+
+	rd := readiness{
+		Components: make(map[string]componentHealth, len(checks)),
+		Status:     healthOK,
+		Ready:      true,
+	}
+
+	for _, hc := range checks {
+		detail, err := hc.fn()
+		ch := componentHealth{Status: healthOK, Detail: detail, Critical: hc.critical}
+		if err != nil {
+			ch.Status = healthDegraded
+			ch.Error = err.Error()
+			rd.Status = healthDegraded
+			if hc.critical {
+				rd.Ready = false
+			}
+		}
+		rd.Components[hc.name] = ch
+	}
+
+	return rd
+}
+
+// statusOnly removes the component detail and errors (e.g. check ids, broker
+// and listener addresses), leaving the status of each component.
+func (rd *readiness) statusOnly() {
+	for name, ch := range rd.Components {
+		ch.Detail = ""
+		ch.Error = ""
+		rd.Components[name] = ch
+	}
+}
+
+// health handles /health, /health?verbose and /health/ready. /health is
+// liveness ("Alive"), verbose adds the component status (always 200).
+// /health/ready returns the component status, 503 if a critical component
+// is degraded. If api auth is configured, component detail and errors are
+// only returned to requests with the read scope.
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	ready := healthReadyRx.MatchString(r.URL.Path)
+	_, verbose := r.URL.Query()["verbose"]
+
+	if !ready && !verbose {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "Alive")
+		return
+	}
+
+	rd := s.readiness()
+
+	code := http.StatusOK
+	if ready && !rd.Ready {
+		code = http.StatusServiceUnavailable
+		s.logger.Warn().Str("status", rd.Status).Interface("components", rd.Components).Msg("not ready")
+	}
+
+	if !s.allowed(r, scopeRead) {
+		rd.statusOnly()
+	}
+
+	data, err := json.Marshal(rd)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("encoding readiness")
+		http.Error(w, "encoding readiness", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(data)
+}
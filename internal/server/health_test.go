@@ -0,0 +1,184 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/check"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestHealth(t *testing.T) {
+	t.Log("Testing health")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, c, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	get := func(t *testing.T, path string) (*http.Response, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+
+		s.router(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	decode := func(t *testing.T, body string) readiness {
+		t.Helper()
+		var rd readiness
+		if err := json.Unmarshal([]byte(body), &rd); err != nil {
+			t.Fatalf("unexpected error (%s) %s", err, body)
+		}
+		return rd
+	}
+
+	t.Log("liveness")
+	for _, path := range []string{"/health", "/health/"} {
+		resp, body := get(t, path)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s expected %d, got %d", path, http.StatusOK, resp.StatusCode)
+		}
+		if body != "Alive\n" {
+			t.Fatalf("%s expected Alive, got %q", path, body)
+		}
+	}
+
+	t.Log("ready (check management disabled)")
+	{
+		resp, body := get(t, "/health/ready")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("expected application/json, got %s", ct)
+		}
+		rd := decode(t, body)
+		if !rd.Ready || rd.Status != healthOK {
+			t.Fatalf("expected ready, got %#v", rd)
+		}
+		if ch, ok := rd.Components["check"]; !ok || ch.Status != healthOK || !ch.Critical {
+			t.Fatalf("expected check ok, got %#v", rd.Components)
+		}
+	}
+
+	t.Log("degraded, not critical")
+	{
+		s.AddHealthCheck("optional", false, func() (string, error) { return "", fmt.Errorf("down") })
+		resp, body := get(t, "/health/ready")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		rd := decode(t, body)
+		if !rd.Ready || rd.Status != healthDegraded {
+			t.Fatalf("expected ready and degraded, got %#v", rd)
+		}
+		if ch := rd.Components["optional"]; ch.Status != healthDegraded || ch.Error != "down" {
+			t.Fatalf("expected optional degraded, got %#v", ch)
+		}
+	}
+
+	t.Log("degraded, critical")
+	{
+		s.AddHealthCheck("reverse", true, func() (string, error) { return "ERROR", fmt.Errorf("not connected") })
+		resp, body := get(t, "/health/ready/")
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+		}
+		rd := decode(t, body)
+		if rd.Ready {
+			t.Fatalf("expected not ready, got %#v", rd)
+		}
+		if ch := rd.Components["reverse"]; ch.Detail != "ERROR" || ch.Error != "not connected" {
+			t.Fatalf("expected reverse detail and error, got %#v", ch)
+		}
+	}
+
+	t.Log("verbose is always 200")
+	{
+		resp, body := get(t, "/health?verbose")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if rd := decode(t, body); rd.Ready || len(rd.Components) != 3 {
+			t.Fatalf("expected not ready w/3 components, got %#v", rd)
+		}
+	}
+
+	t.Log("api auth, status only without read scope")
+	{
+		a, err := newAuth(authConfig{Tokens: []authToken{{Token: "foo", Scopes: []string{"read"}}}})
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		s.auth = a
+
+		resp, body := get(t, "/health/ready")
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+		}
+		rd := decode(t, body)
+		if ch := rd.Components["reverse"]; ch.Status != healthDegraded || ch.Detail != "" || ch.Error != "" {
+			t.Fatalf("expected reverse status only, got %#v", ch)
+		}
+		if _, body := get(t, "/health?verbose"); strings.Contains(body, "not connected") {
+			t.Fatalf("expected status only, got %s", body)
+		}
+
+		req := httptest.NewRequest("GET", "/health/ready", nil)
+		req.Header.Set("Authorization", "Bearer foo")
+		w := httptest.NewRecorder()
+		s.router(w, req)
+		if !strings.Contains(w.Body.String(), `"not connected"`) {
+			t.Fatalf("expected reverse detail and error, got %s", w.Body.String())
+		}
+
+		s.auth = nil
+	}
+
+	t.Log("replace health check")
+	{
+		s.AddHealthCheck("reverse", true, func() (string, error) { return "CONN_IDLE", nil })
+		resp, body := get(t, "/health/ready")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if !strings.Contains(body, `"CONN_IDLE"`) {
+			t.Fatalf("expected replaced check, got %s", body)
+		}
+		s.healthmu.Lock()
+		n := len(s.healthChecks)
+		s.healthmu.Unlock()
+		if n != 3 {
+			t.Fatalf("expected 3 health checks, got %d", n)
+		}
+	}
+}
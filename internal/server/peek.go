@@ -0,0 +1,91 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+)
+
+// peekConduit is the /peek response for a conduit.
+type peekConduit struct {
+	Metrics   cgm.Metrics `json:"metrics"`
+	LastFlush string      `json:"last_flush"`
+}
+
+var (
+	lastConduitMetrics   = make(map[string]*previousMetrics)
+	lastConduitMetricsmu sync.Mutex
+)
+
+// saveConduitMetrics keeps a copy of the metrics flushed from a conduit for /peek.
+// A full collection (id is empty) replaces the conduit's previous metrics, a
+// collection for a specific item updates them.
+func saveConduitMetrics(conduitID, id string, metrics *cgm.Metrics) {
+	if metrics == nil || len(*metrics) == 0 {
+		return
+	}
+
+	lastConduitMetricsmu.Lock()
+	defer lastConduitMetricsmu.Unlock()
+
+	prev, ok := lastConduitMetrics[conduitID]
+	if !ok || id == "" {
+		prev = &previousMetrics{metrics: &cgm.Metrics{}}
+		lastConduitMetrics[conduitID] = prev
+	}
+	for m, v := range *metrics {
+		(*prev.metrics)[m] = v
+	}
+	prev.ts = time.Now()
+}
+
+// peek handles /peek, returning the last metrics flushed from each conduit
+// without running plugins or flushing the conduits. The include, exclude, tag
+// and conduit query parameters select the metrics returned.
+func (s *Server) peek(w http.ResponseWriter, r *http.Request) {
+	filter, conduits, err := parseMetricQuery(r.URL.Query())
+	if err != nil {
+		s.logger.Warn().Err(err).Str("url", r.URL.String()).Msg("invalid metric query")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(conduits) == 0 {
+		conduits = []string{conduitBuiltin, conduitPlugin, conduitReceiver, conduitStatsd, conduitPrometheus}
+	}
+
+	resp := make(map[string]peekConduit, len(conduits))
+
+	lastConduitMetricsmu.Lock()
+	for _, cid := range conduits {
+		prev, ok := lastConduitMetrics[cid]
+		if !ok {
+			continue
+		}
+		metrics := cgm.Metrics{}
+		for m, v := range *prev.metrics {
+			if filter.Match(m) {
+				metrics[m] = v
+			}
+		}
+		resp[cid] = peekConduit{Metrics: metrics, LastFlush: prev.ts.UTC().Format(time.RFC3339Nano)}
+	}
+	lastConduitMetricsmu.Unlock()
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("encoding peek metrics")
+		http.Error(w, "encoding metrics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
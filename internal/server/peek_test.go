@@ -0,0 +1,122 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/check"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/server/receiver"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestPeek(t *testing.T) {
+	t.Log("Testing peek")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, c, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	peek := func(t *testing.T, path string) (int, map[string]peekConduit) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+
+		s.peek(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, nil
+		}
+		var v map[string]peekConduit
+		if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		return resp.StatusCode, v
+	}
+
+	t.Log("invalid query -> 400")
+	{
+		if code, _ := peek(t, "/peek?conduit=foo"); code != http.StatusBadRequest {
+			t.Fatalf("expected %d, got %d", http.StatusBadRequest, code)
+		}
+	}
+
+	_ = receiver.Flush() // metrics left by other tests
+	lastConduitMetricsmu.Lock()
+	lastConduitMetrics = make(map[string]*previousMetrics)
+	lastConduitMetricsmu.Unlock()
+
+	data := `{"cpu_user":{"_type":"L","_value":1},"mem_free":{"_type":"L","_value":3}}`
+	if err := receiver.Parse("peek", bytes.NewReader([]byte(data))); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	_ = s.GetMetrics(ConsumerRun, []string{conduitReceiver}, "", nil)
+
+	t.Log("receiver metrics available, not flushed")
+	{
+		for i := 0; i < 2; i++ {
+			code, v := peek(t, "/peek?conduit=receiver")
+			if code != http.StatusOK {
+				t.Fatalf("expected %d, got %d", http.StatusOK, code)
+			}
+			rm, ok := v[conduitReceiver]
+			if !ok {
+				t.Fatalf("expected receiver conduit, got %v", v)
+			}
+			if len(rm.Metrics) != 2 {
+				t.Fatalf("expected 2 metrics, got %d (%v)", len(rm.Metrics), rm.Metrics)
+			}
+			if rm.LastFlush == "" {
+				t.Fatal("expected last flush")
+			}
+		}
+	}
+
+	t.Log("filtered")
+	{
+		_, v := peek(t, "/peek?include=^mem_")
+		rm := v[conduitReceiver]
+		if len(rm.Metrics) != 1 {
+			t.Fatalf("expected 1 metric, got %d (%v)", len(rm.Metrics), rm.Metrics)
+		}
+		for name := range rm.Metrics {
+			if !strings.HasPrefix(name, "mem_free") {
+				t.Fatalf("expected mem_free, got %s", name)
+			}
+		}
+	}
+
+	t.Log("empty flush keeps last metrics")
+	{
+		_ = s.GetMetrics(ConsumerRun, []string{conduitReceiver}, "", nil)
+		_, v := peek(t, "/peek?conduit=receiver")
+		if len(v[conduitReceiver].Metrics) != 2 {
+			t.Fatalf("expected 2 metrics, got %v", v)
+		}
+	}
+}
@@ -85,6 +85,13 @@ func Flush() *cgm.Metrics {
 	return metrics.FlushMetrics()
 }
 
+// Snapshot returns a copy of the current metrics, without resetting them.
+func Snapshot() *cgm.Metrics {
+	_ = initCGM()
+
+	return metrics.FlushMetricsNoReset()
+}
+
 // Parse handles incoming PUT/POST requests.
 func Parse(data io.Reader) error {
 	if err := initCGM(); err != nil {
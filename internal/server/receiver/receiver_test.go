@@ -45,6 +45,43 @@ func TestFlush(t *testing.T) {
 	}
 }
 
+func TestSnapshot(t *testing.T) {
+	t.Log("Testing Snapshot")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	err := initCGM()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	_ = Flush()
+	metrics.SetText("test", "test")
+
+	t.Log("\tnot reset")
+	{
+		m := Snapshot()
+		if len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %d", len(*m))
+		}
+		m = Snapshot()
+		if len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %d", len(*m))
+		}
+	}
+
+	t.Log("\tflushed")
+	{
+		m := Flush()
+		if len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %d", len(*m))
+		}
+		m = Snapshot()
+		if len(*m) != 0 {
+			t.Fatalf("expected 0 metrics, got %d", len(*m))
+		}
+	}
+}
+
 func TestParse(t *testing.T) {
 	t.Log("Testing Parse")
 
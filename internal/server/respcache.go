@@ -0,0 +1,123 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+)
+
+// responseCache shares the metrics collected for a /run request, and their
+// encoded payloads, with identical requests. Concurrent requests wait for the
+// first one to collect, later requests reuse the result until it expires.
+type responseCache struct {
+	entries map[string]*cachedResponse
+	ttl     time.Duration
+	sync.Mutex
+}
+
+// cachedResponse is the metrics collected for a request, the encoded payloads
+// are created on first use.
+type cachedResponse struct {
+	expires time.Time
+	encErr  error
+	metrics *cgm.Metrics
+	enc     *encodedMetrics // json encoded metrics, nil until encoded
+	ready   chan struct{}   // closed once metrics are collected
+	gzData  []byte          // gzip compressed json payload
+	pending bool            // metrics are being collected
+	gzDone  bool
+	sync.Mutex
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		entries: make(map[string]*cachedResponse),
+		ttl:     ttl,
+	}
+}
+
+// get returns the response for key, calling collect if there is no response
+// being collected or cached. The bool is true if the response is shared with
+// another request.
+func (c *responseCache) get(key string, collect func() *cgm.Metrics) (*cachedResponse, bool) {
+	c.Lock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if !e.pending && now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if e, ok := c.entries[key]; ok {
+		c.Unlock()
+		<-e.ready
+		return e, true
+	}
+	e := &cachedResponse{ready: make(chan struct{}), pending: true}
+	c.entries[key] = e
+	c.Unlock()
+
+	defer func() {
+		c.Lock()
+		e.pending = false
+		e.expires = time.Now().Add(c.ttl)
+		if c.ttl <= 0 {
+			delete(c.entries, key)
+		}
+		c.Unlock()
+		close(e.ready)
+	}()
+
+	e.metrics = collect()
+	if e.metrics == nil {
+		e.metrics = &cgm.Metrics{}
+	}
+
+	return e, false
+}
+
+// encoded returns the json encoded metrics, encoding them the first time.
+func (cr *cachedResponse) encoded() (*encodedMetrics, error) {
+	cr.Lock()
+	defer cr.Unlock()
+
+	return cr.encode()
+}
+
+// encode encodes the metrics once, the caller must hold the lock.
+func (cr *cachedResponse) encode() (*encodedMetrics, error) {
+	if cr.enc == nil && cr.encErr == nil {
+		cr.enc, cr.encErr = encodeMetricsJSON(cr.metrics)
+	}
+
+	return cr.enc, cr.encErr
+}
+
+// gzipped returns the gzip compressed json encoded metrics, the compressed
+// payload is created the first time and kept for identical requests.
+func (cr *cachedResponse) gzipped() ([]byte, error) {
+	cr.Lock()
+	defer cr.Unlock()
+
+	if !cr.gzDone && cr.encErr == nil {
+		em, err := cr.encode()
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := gzipMetricsJSON(&buf, em); err != nil {
+			cr.encErr = err
+		} else {
+			cr.gzData = buf.Bytes()
+			cr.gzDone = true
+		}
+	}
+
+	return cr.gzData, cr.encErr
+}
@@ -0,0 +1,126 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+)
+
+func TestResponseCache(t *testing.T) {
+	t.Log("Testing responseCache")
+
+	var calls int32
+	collect := func() *cgm.Metrics {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return &cgm.Metrics{"foo": cgm.Metric{Type: "L", Value: 1}}
+	}
+
+	t.Log("concurrent requests share, ttl 0")
+	{
+		c := newResponseCache(0)
+		atomic.StoreInt32(&calls, 0)
+
+		var wg sync.WaitGroup
+		var shared int32
+		resps := make([]*cachedResponse, 5)
+		for i := range resps {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				cr, ok := c.get("/run", collect)
+				if ok {
+					atomic.AddInt32(&shared, 1)
+				}
+				resps[i] = cr
+			}(i)
+		}
+		wg.Wait()
+
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Fatalf("expected 1 collection, got %d", n)
+		}
+		if n := atomic.LoadInt32(&shared); n != 4 {
+			t.Fatalf("expected 4 shared, got %d", n)
+		}
+		for _, cr := range resps[1:] {
+			if cr != resps[0] {
+				t.Fatal("expected same response")
+			}
+		}
+
+		// not kept once collected
+		if _, ok := c.get("/run", collect); ok {
+			t.Fatal("expected new collection")
+		}
+		if len(c.entries) != 0 {
+			t.Fatalf("expected no entries, got %d", len(c.entries))
+		}
+	}
+
+	t.Log("ttl, different keys and expiry")
+	{
+		c := newResponseCache(200 * time.Millisecond)
+		atomic.StoreInt32(&calls, 0)
+
+		if _, ok := c.get("/run", collect); ok {
+			t.Fatal("expected new collection")
+		}
+		if _, ok := c.get("/run", collect); !ok {
+			t.Fatal("expected shared response")
+		}
+		if _, ok := c.get("/run/statsd", collect); ok {
+			t.Fatal("expected new collection for different request")
+		}
+		time.Sleep(250 * time.Millisecond)
+		if _, ok := c.get("/run", collect); ok {
+			t.Fatal("expected new collection after expiry")
+		}
+		if n := atomic.LoadInt32(&calls); n != 3 {
+			t.Fatalf("expected 3 collections, got %d", n)
+		}
+	}
+
+	t.Log("encoded payloads")
+	{
+		c := newResponseCache(time.Second)
+		cr, _ := c.get("/run", collect)
+
+		em, err := cr.encoded()
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if em.size != int64(len(`{"foo":{"_type":"L","_value":1}}`)) {
+			t.Fatalf("unexpected length %d", em.size)
+		}
+		if em2, _ := cr.encoded(); em2 != em {
+			t.Fatal("expected same encoded metrics")
+		}
+		gz1, err := cr.gzipped()
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		gz2, _ := cr.gzipped()
+		if len(gz1) == 0 || &gz1[0] != &gz2[0] {
+			t.Fatal("expected same compressed payload")
+		}
+
+		bad, _ := c.get("/bad", func() *cgm.Metrics {
+			return &cgm.Metrics{"bad": cgm.Metric{Type: "n", Value: func() {}}}
+		})
+		if _, err := bad.encoded(); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := bad.gzipped(); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
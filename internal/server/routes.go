@@ -7,7 +7,6 @@ package server
 
 import (
 	"expvar"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -25,10 +24,12 @@ func (s *Server) router(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
 		switch {
-		case r.URL.Path == "/health", r.URL.Path == "/health/":
-			w.WriteHeader(http.StatusOK)
-			_, _ = fmt.Fprintln(w, "Alive")
+		case healthPathRx.MatchString(r.URL.Path): // liveness and readiness
+			s.health(w, r)
 		case pluginPathRx.MatchString(r.URL.Path): // run plugin(s)
+			if !s.authorize(w, r, scopeRead) {
+				return
+			}
 			if viper.GetBool(config.KeyMultiAgent) {
 				http.Error(w, "not allowed when multi-agent enabled", http.StatusForbidden)
 				return
@@ -38,12 +39,44 @@ func (s *Server) router(w http.ResponseWriter, r *http.Request) {
 			}
 			s.run(w, r)
 		case inventoryPathRx.MatchString(r.URL.Path): // plugin inventory
+			if !s.authorize(w, r, scopeRead) {
+				return
+			}
 			s.inventory(w)
 		case statsPathRx.MatchString(r.URL.Path): // app stats
+			if !s.authorize(w, r, scopeRead) {
+				return
+			}
 			expvar.Handler().ServeHTTP(w, r)
 		case promPathRx.MatchString(r.URL.Path): // output prom format...
+			if !s.authorize(w, r, scopeRead) {
+				return
+			}
 			s.promOutput(w)
+		case peekPathRx.MatchString(r.URL.Path): // last metrics flushed, read-only
+			if !s.authorize(w, r, scopeRead) {
+				return
+			}
+			s.peek(w, r)
+		case metricsPathRx.MatchString(r.URL.Path): // prometheus exposition
+			if !s.authorize(w, r, scopeRead) {
+				return
+			}
+			s.promMetrics(w, r)
+		case configPathRx.MatchString(r.URL.Path): // running config, secrets redacted
+			if !s.authorize(w, r, scopeAdmin) {
+				return
+			}
+			s.showConfig(w, r)
+		case filtersPathRx.MatchString(r.URL.Path): // metric filter evaluation
+			if !s.authorize(w, r, scopeRead) {
+				return
+			}
+			s.testMetricFilters(w, r)
 		case strings.HasPrefix(r.URL.Path, "/options"):
+			if !s.authorize(w, r, scopeAdmin) {
+				return
+			}
 			s.handleOptions(w, r)
 		default:
 			_ = appstats.IncrementInt("server.requests_bad")
@@ -55,8 +88,14 @@ func (s *Server) router(w http.ResponseWriter, r *http.Request) {
 	case "PUT":
 		switch {
 		case writePathRx.MatchString(r.URL.Path):
+			if !s.authorize(w, r, scopeWrite) {
+				return
+			}
 			s.write(w, r)
 		case promPathRx.MatchString(r.URL.Path):
+			if !s.authorize(w, r, scopeWrite) {
+				return
+			}
 			s.promReceiver(w, r)
 		default:
 			_ = appstats.IncrementInt("server.requests_bad")
@@ -30,6 +30,10 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+// defaultStopTTL is how long to wait for in-flight requests when stopping,
+// if not set by the agent (SetStopTimeout), see defaults.ShutdownTimeout.
+const defaultStopTTL = 30 * time.Second
+
 type httpServer struct {
 	address *net.TCPAddr
 	server  *http.Server
@@ -50,16 +54,25 @@ type sslServer struct {
 
 // Server defines the listening servers.
 type Server struct {
-	check      *check.Check
-	group      *errgroup.Group
-	builtins   *builtins.Builtins
-	plugins    *plugins.Plugins
-	statsdSvr  *statsd.Server
-	svrHTTPS   *sslServer
-	svrHTTP    []*httpServer
-	svrSockets []*socketServer
-	groupCtx   context.Context
-	logger     zerolog.Logger
+	check        *check.Check
+	group        *errgroup.Group
+	builtins     *builtins.Builtins
+	plugins      *plugins.Plugins
+	statsdSvr    *statsd.Server
+	auth         *apiAuth
+	reverseToken string // bearer token for the reverse connection, if api auth is configured
+	svrHTTPS     *sslServer
+	svrHTTP      []*httpServer
+	svrSockets   []*socketServer
+	groupCtx     context.Context
+	logger       zerolog.Logger
+	cacheTTL     time.Duration // how long metrics flushed by /run are served by /metrics
+	stopTTL      time.Duration // how long to wait for in-flight requests when stopping
+	respCache    *responseCache
+	collector    *collector
+	drainOwner   string // consumer which drains the accumulating conduits
+	healthChecks []healthCheck
+	healthmu     sync.Mutex
 }
 
 type previousMetrics struct {
@@ -73,6 +86,12 @@ var (
 	writePathRx     = regexp.MustCompile("^/write/[a-zA-Z0-9_-]+$")
 	statsPathRx     = regexp.MustCompile("^/stats/?$")
 	promPathRx      = regexp.MustCompile("^/prom/?$")
+	peekPathRx      = regexp.MustCompile("^/peek/?$")
+	metricsPathRx   = regexp.MustCompile("^/metrics/?$")
+	healthPathRx    = regexp.MustCompile("^/health(/ready)?/?$")
+	healthReadyRx   = regexp.MustCompile("^/health/ready/?$")
+	configPathRx    = regexp.MustCompile("^/config/?$")
+	filtersPathRx   = regexp.MustCompile("^/filters/test/?$")
 	lastMetrics     = &previousMetrics{}
 	lastMetricsmu   sync.Mutex
 )
@@ -88,6 +107,81 @@ func New(ctx context.Context, c *check.Check, b *builtins.Builtins, p *plugins.P
 		plugins:   p,
 		statsdSvr: ss,
 		check:     c,
+		stopTTL:   defaultStopTTL,
+	}
+
+	// API authentication/authorization (all requests allowed if not configured)
+	if fn := viper.GetString(config.KeyAPIAuthFile); fn != "" {
+		auth, err := loadAuth(fn)
+		if err != nil {
+			s.logger.Error().Err(err).Str("file", fn).Msg("api auth")
+			return nil, fmt.Errorf("api auth: %w", err)
+		}
+		s.auth = auth
+		// broker requests relayed by the reverse connection carry no credentials
+		if viper.GetBool(config.KeyReverse) {
+			token, err := auth.newInternalToken()
+			if err != nil {
+				return nil, fmt.Errorf("api auth: %w", err)
+			}
+			s.reverseToken = token
+		}
+	}
+
+	// metrics served by /metrics from the last /run, if flushed within ttl
+	{
+		ttl := viper.GetString(config.KeyMetricsCacheTTL)
+		if ttl == "" {
+			ttl = defaults.MetricsCacheTTL
+		}
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			s.logger.Error().Err(err).Str("ttl", ttl).Msg("parsing metrics cache ttl")
+			return nil, fmt.Errorf("metrics cache ttl: %w", err)
+		}
+		s.cacheTTL = d
+	}
+
+	// encoded /run responses shared with identical requests within ttl
+	{
+		ttl := viper.GetString(config.KeyResponseCacheTTL)
+		if ttl == "" {
+			ttl = defaults.ResponseCacheTTL
+		}
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			s.logger.Error().Err(err).Str("ttl", ttl).Msg("parsing response cache ttl")
+			return nil, fmt.Errorf("response cache ttl: %w", err)
+		}
+		s.respCache = newResponseCache(d)
+	}
+
+	// consumer owning the accumulated metrics, other consumers get a copy
+	{
+		owner := viper.GetString(config.KeyDrainOwner)
+		if owner == "" {
+			owner = defaults.DrainOwner
+		}
+		if err := validDrainOwner(owner); err != nil {
+			s.logger.Error().Err(err).Msg("drain owner")
+			return nil, err
+		}
+		s.drainOwner = owner
+		s.collector = newCollector()
+	}
+
+	// components reported by /health/ready
+	if c != nil {
+		s.AddHealthCheck("check", true, c.Health)
+	}
+	if b != nil {
+		s.AddHealthCheck("builtins", false, b.Health)
+	}
+	if p != nil {
+		s.AddHealthCheck("plugins", true, p.Health)
+	}
+	if ss != nil {
+		s.AddHealthCheck("statsd", true, ss.Health)
 	}
 
 	// HTTP listener (1-n)
@@ -137,6 +231,18 @@ func New(ctx context.Context, c *check.Check, b *builtins.Builtins, p *plugins.P
 			return nil, fmt.Errorf("SSL server key file: %w", err)
 		}
 
+		reloader, err := newTLSReloader(
+			certFile,
+			keyFile,
+			viper.GetString(config.KeySSLClientCAFile),
+			viper.GetString(config.KeySSLClientAuth),
+			viper.GetStringSlice(config.KeySSLClientAllow),
+			s.logger)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("SSL server")
+			return nil, fmt.Errorf("SSL server: %w", err)
+		}
+
 		svr := sslServer{
 			address:  ta,
 			certFile: certFile,
@@ -146,6 +252,7 @@ func New(ctx context.Context, c *check.Check, b *builtins.Builtins, p *plugins.P
 				Handler: http.HandlerFunc(s.router),
 				// Handler: httpgzip.NewHandler(http.HandlerFunc(s.router), []string{"application/json"}),
 				ReadHeaderTimeout: 2 * time.Second,
+				TLSConfig:         reloader.serverConfig(),
 			},
 		}
 
@@ -197,6 +304,12 @@ func (s *Server) GetReverseAgentAddress() (string, error) {
 	return s.svrHTTP[0].address.String(), nil
 }
 
+// GetReverseAgentToken returns the bearer token the reverse connection uses to
+// fetch metrics from the agent, empty if api auth is not configured.
+func (s *Server) GetReverseAgentToken() string {
+	return s.reverseToken
+}
+
 // Start main listening server(s).
 func (s *Server) Start() error {
 	if len(s.svrHTTP) == 0 && s.svrHTTPS == nil && len(s.svrSockets) > 0 {
@@ -227,34 +340,55 @@ func (s *Server) Start() error {
 	return s.group.Wait() //nolint:wrapcheck
 }
 
+// SetStopTimeout sets how long Stop waits for in-flight requests to complete,
+// the agent's shutdown timeout.
+func (s *Server) SetStopTimeout(d time.Duration) {
+	s.stopTTL = d
+}
+
 // Stop the servers in an orderly, graceful fashion.
 func (s *Server) Stop() {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.stopTTL)
 	defer cancel()
 
-	for _, svrHTTP := range s.svrHTTP {
-		s.logger.Info().Msg("stopping HTTP server")
-		err := svrHTTP.server.Shutdown(ctx)
-		if err != nil {
-			s.logger.Warn().Err(err).Msg("closing HTTP server")
+	_ = s.Shutdown(ctx)
+}
+
+// Shutdown stops accepting connections on all servers and waits for in-flight
+// requests to complete, until ctx is done. The servers are shut down concurrently
+// so a slow request on one does not use up the time available to the others.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(s.svrHTTP)+len(s.svrSockets)+1)
+
+	shutdown := func(name string, svr *http.Server) {
+		defer wg.Done()
+		s.logger.Info().Str("server", name).Msg("stopping server")
+		if err := svr.Shutdown(ctx); err != nil {
+			s.logger.Warn().Err(err).Str("server", name).Msg("closing server, in-flight requests not completed")
+			errCh <- fmt.Errorf("%s: %w", name, err)
 		}
 	}
 
+	for _, svrHTTP := range s.svrHTTP {
+		wg.Add(1)
+		go shutdown("HTTP "+svrHTTP.server.Addr, svrHTTP.server)
+	}
+
 	if s.svrHTTPS != nil {
-		s.logger.Info().Msg("stopping HTTPS server")
-		err := s.svrHTTPS.server.Shutdown(ctx)
-		if err != nil {
-			s.logger.Warn().Err(err).Msg("closing HTTPS server")
-		}
+		wg.Add(1)
+		go shutdown("HTTPS "+s.svrHTTPS.server.Addr, s.svrHTTPS.server)
 	}
 
 	for _, svrSocket := range s.svrSockets {
-		s.logger.Info().Str("server", svrSocket.address.Name).Msg("stopping Socket server")
-		err := svrSocket.server.Shutdown(ctx)
-		if err != nil {
-			s.logger.Warn().Err(err).Str("server", svrSocket.address.Name).Msg("closing Socket server")
-		}
+		wg.Add(1)
+		go shutdown("Socket "+svrSocket.address.Name, svrSocket.server)
 	}
+
+	wg.Wait()
+	close(errCh)
+
+	return <-errCh // first error, if any
 }
 
 func (s *Server) startHTTP(svr *httpServer) error {
@@ -284,7 +418,8 @@ func (s *Server) startHTTPS() error {
 		return nil
 	}
 	s.logger.Info().Str("listen", s.svrHTTPS.server.Addr).Msg("SSL starting")
-	if err := s.svrHTTPS.server.ListenAndServeTLS(s.svrHTTPS.certFile, s.svrHTTPS.keyFile); err != nil {
+	// cert/key are provided (and reloaded on change) by the tls config
+	if err := s.svrHTTPS.server.ListenAndServeTLS("", ""); err != nil {
 		if !errors.Is(err, http.ErrServerClosed) {
 			s.logger.Fatal().Err(err).Msg("SSL Server, stopping agent")
 			return fmt.Errorf("SSL server: %w", err)
@@ -376,11 +376,8 @@ func TestStartHTTPS(t *testing.T) {
 		viper.Set(config.KeySSLCertFile, "testdata/cert.crt")
 		viper.Set(config.KeySSLKeyFile, "testdata/key.key")
 		ctx, cancel := context.WithCancel(context.Background())
-		s, err := New(ctx, nil, nil, nil, nil)
-		if err != nil {
-			t.Fatalf("expected no error, got (%s)", err)
-		}
-		if err := s.startHTTPS(); err == nil {
+		// cert/key are loaded (for reloading on change) when the server is created
+		if _, err := New(ctx, nil, nil, nil, nil); err == nil {
 			t.Fatal("expected error")
 		}
 		cancel()
@@ -491,20 +488,15 @@ func TestStart(t *testing.T) {
 		viper.Set(config.KeySSLCertFile, "testdata/cert.crt")
 		viper.Set(config.KeySSLKeyFile, "testdata/key.key")
 		ctx, cancel := context.WithCancel(context.Background())
-		s, err := New(ctx, nil, nil, nil, nil)
-		if err != nil {
-			t.Fatalf("expected no error, got (%s)", err)
-		}
-		time.AfterFunc(1*time.Second, func() {
-			cancel()
-		})
-		serr := s.Start()
-		if serr == nil {
+		defer cancel()
+		// cert/key are loaded (to be reloaded on change) when the server is created
+		_, err := New(ctx, nil, nil, nil, nil)
+		if err == nil {
 			t.Fatal("expected error")
 		}
-		expected := fmt.Errorf("SSL server: tls: failed to find any PEM data in certificate input") //nolint:goerr113
-		if serr.Error() != expected.Error() {
-			t.Fatalf("expected (%s) got (%s)", expected, serr)
+		expected := fmt.Errorf("SSL server: loading cert/key: tls: failed to find any PEM data in certificate input") //nolint:goerr113
+		if err.Error() != expected.Error() {
+			t.Fatalf("expected (%s) got (%s)", expected, err)
 		}
 	}
 }
@@ -570,3 +562,59 @@ func TestStop(t *testing.T) {
 		})
 	}
 }
+
+func TestShutdown(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("Testing Shutdown")
+
+	t.Run("default timeout", func(t *testing.T) {
+		viper.Reset()
+		viper.Set(config.KeyListen, []string{":65227"})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := New(ctx, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if s.stopTTL != defaultStopTTL {
+			t.Fatalf("expected %s, got %s", defaultStopTTL, s.stopTTL)
+		}
+	})
+
+	t.Run("valid http", func(t *testing.T) {
+		viper.Reset()
+		viper.Set(config.KeyListen, []string{":65227"})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, err := New(ctx, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		s.SetStopTimeout(5 * time.Second)
+		if s.stopTTL != 5*time.Second {
+			t.Fatalf("expected 5s, got %s", s.stopTTL)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- s.Start()
+		}()
+		time.Sleep(500 * time.Millisecond)
+
+		sctx, scancel := context.WithTimeout(context.Background(), s.stopTTL)
+		defer scancel()
+		if err := s.Shutdown(sctx); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+
+		select {
+		case serr := <-done:
+			if serr != nil {
+				t.Fatalf("expected no error, got (%s)", serr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected Start to return after Shutdown")
+		}
+	})
+}
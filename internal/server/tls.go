@@ -0,0 +1,205 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	appstats "github.com/maier/go-appstats"
+	"github.com/rs/zerolog"
+)
+
+// client certificate verification modes for the SSL server.
+const (
+	clientAuthOptional = "optional" // verify client certificates if presented
+	clientAuthRequire  = "require"  // require and verify client certificates
+)
+
+// tlsReloadInterval is how often the files are checked for changes, at most.
+const tlsReloadInterval = time.Second
+
+var (
+	errTLSInvalidCAFile      = fmt.Errorf("no certificates found in client ca file")
+	errTLSInvalidClientAuth  = fmt.Errorf("invalid client auth, expected optional or require")
+	errTLSClientCARequired   = fmt.Errorf("client ca file is required to verify client certificates")
+	errTLSClientNotAllowed   = fmt.Errorf("client certificate subject not allowed")
+	errTLSClientCertRequired = fmt.Errorf("client certificate required by allowlist")
+)
+
+// tlsReloader provides the SSL server tls config, reloading the certificate,
+// key and client CA bundle when the files change (e.g. rotated by cert-manager
+// or an ACME client) without restarting the agent.
+type tlsReloader struct {
+	lastCheck     time.Time
+	config        *tls.Config
+	mtimes        map[string]time.Time
+	allow         map[string]bool
+	logger        zerolog.Logger
+	certFile      string
+	keyFile       string
+	caFile        string
+	clientAuth    string
+	checkInterval time.Duration
+	mu            sync.Mutex
+}
+
+// newTLSReloader validates the SSL options and loads the certificate, key and client CA bundle.
+func newTLSReloader(certFile, keyFile, caFile, clientAuth string, allow []string, logger zerolog.Logger) (*tlsReloader, error) {
+	if clientAuth == "" {
+		clientAuth = clientAuthOptional
+	}
+	switch clientAuth {
+	case clientAuthOptional, clientAuthRequire:
+	default:
+		return nil, fmt.Errorf("%s: %w", clientAuth, errTLSInvalidClientAuth)
+	}
+	if caFile == "" && (clientAuth == clientAuthRequire || len(allow) > 0) {
+		return nil, errTLSClientCARequired
+	}
+
+	r := &tlsReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		caFile:        caFile,
+		clientAuth:    clientAuth,
+		checkInterval: tlsReloadInterval,
+		allow:         make(map[string]bool, len(allow)),
+		logger:        logger.With().Str("op", "tls").Logger(),
+	}
+	for _, subject := range allow {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			r.allow[subject] = true
+		}
+	}
+
+	r.mtimes, _ = r.changed()
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// files returns the files which are (re)loaded.
+func (r *tlsReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+// changed returns the current modification times of the files and whether any changed since the last load.
+func (r *tlsReloader) changed() (map[string]time.Time, bool) {
+	mtimes := make(map[string]time.Time, 3)
+	changed := false
+	for _, fn := range r.files() {
+		fi, err := os.Stat(fn)
+		if err != nil {
+			continue // keep using the loaded files while they are being replaced
+		}
+		mtimes[fn] = fi.ModTime()
+		if prev, ok := r.mtimes[fn]; !ok || !prev.Equal(fi.ModTime()) {
+			changed = true
+		}
+	}
+	return mtimes, changed
+}
+
+// load reads the certificate, key and client CA bundle and builds the tls config.
+func (r *tlsReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading cert/key: %w", err)
+	}
+
+	cfg := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		Certificates:     []tls.Certificate{cert},
+		NextProtos:       []string{"h2", "http/1.1"},
+		VerifyConnection: r.verifyConnection,
+	}
+
+	if r.caFile != "" {
+		data, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("read client ca file: %w", err)
+		}
+		cp := x509.NewCertPool()
+		if !cp.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%s: %w", r.caFile, errTLSInvalidCAFile)
+		}
+		cfg.ClientCAs = cp
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.clientAuth == clientAuthRequire {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	r.config = cfg
+	return nil
+}
+
+// getConfigForClient returns the current tls config, reloading the files if
+// they changed. The files are checked at most once per check interval.
+func (r *tlsReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) < r.checkInterval {
+		return r.config, nil
+	}
+	r.lastCheck = time.Now()
+
+	if mtimes, changed := r.changed(); changed {
+		// if reloading fails (e.g. only one of cert/key replaced so far) the
+		// previous config is used until the files change again
+		r.mtimes = mtimes
+		if err := r.load(); err != nil {
+			r.logger.Warn().Err(err).Msg("reloading, using previous certificates")
+		} else {
+			r.logger.Info().Msg("reloaded certificates")
+		}
+	}
+
+	return r.config, nil
+}
+
+// verifyConnection enforces the client subject allowlist on verified client
+// certificates. When an allowlist is set, clients without a certificate are
+// rejected, even if client auth is optional.
+func (r *tlsReloader) verifyConnection(cs tls.ConnectionState) error {
+	if len(r.allow) == 0 {
+		return nil
+	}
+	if len(cs.PeerCertificates) == 0 {
+		_ = appstats.IncrementInt("server.tls_clients_rejected")
+		r.logger.Warn().Msg("client certificate required by allowlist, none presented")
+		return errTLSClientCertRequired
+	}
+	for _, subject := range certSubjects(cs.PeerCertificates[0]) {
+		if r.allow[subject] {
+			return nil
+		}
+	}
+	_ = appstats.IncrementInt("server.tls_clients_rejected")
+	r.logger.Warn().Str("subject", cs.PeerCertificates[0].Subject.String()).Msg("client certificate not allowed")
+	return errTLSClientNotAllowed
+}
+
+// serverConfig returns the tls config for the http server.
+func (r *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.getConfigForClient,
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright © 2024 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// testCA is a certificate authority for tls tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create ca: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse ca: %s", err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a (client and server) certificate and key (pem) for the common name and dns names.
+func (ca *testCA) issue(t *testing.T, cn string, dnsNames ...string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create cert: %s", err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder})
+}
+
+// client returns an http client trusting the CA, presenting a client
+// certificate issued by the CA for the common name (if not empty).
+func (ca *testCA) client(t *testing.T, cn string, dnsNames ...string) *http.Client {
+	t.Helper()
+	cp := x509.NewCertPool()
+	cp.AddCert(ca.cert)
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: cp}
+	if cn != "" {
+		certPEM, keyPEM := ca.issue(t, cn, dnsNames...)
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("key pair: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true}}
+}
+
+// testTLSFiles are the server cert, key and client CA files.
+type testTLSFiles struct {
+	cert string
+	key  string
+	ca   string
+}
+
+// write writes pem data to a file, with a modification time in the future
+// so a change is detected regardless of file system timestamp granularity.
+func (f testTLSFiles) write(t *testing.T, fn string, data []byte, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(fn, data, 0600); err != nil {
+		t.Fatalf("write %s: %s", fn, err)
+	}
+	if err := os.Chtimes(fn, mtime, mtime); err != nil {
+		t.Fatalf("chtimes %s: %s", fn, err)
+	}
+}
+
+// newTestTLSServer starts a tls server using a tlsReloader with a server
+// certificate and client CA from the test CA.
+func newTestTLSServer(t *testing.T, ca *testCA, h http.Handler, clientAuth string, allow []string) (*httptest.Server, testTLSFiles) {
+	t.Helper()
+	dir := t.TempDir()
+	files := testTLSFiles{
+		cert: filepath.Join(dir, "server.pem"),
+		key:  filepath.Join(dir, "server.key"),
+		ca:   filepath.Join(dir, "ca.pem"),
+	}
+	certPEM, keyPEM := ca.issue(t, "agent")
+	now := time.Now()
+	files.write(t, files.cert, certPEM, now)
+	files.write(t, files.key, keyPEM, now)
+	files.write(t, files.ca, ca.pem, now)
+
+	r, err := newTLSReloader(files.cert, files.key, files.ca, clientAuth, allow, log.Logger)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	r.checkInterval = 0 // check for changes on every handshake
+	ts := httptest.NewUnstartedServer(h)
+	ts.TLS = r.serverConfig()
+	ts.StartTLS()
+	return ts, files
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestNewTLSReloader(t *testing.T) {
+	t.Log("Testing newTLSReloader")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	ca := newTestCA(t)
+	ts, files := newTestTLSServer(t, ca, http.HandlerFunc(okHandler), clientAuthOptional, nil)
+	ts.Close()
+
+	tests := []struct {
+		name       string
+		cert       string
+		caFile     string
+		clientAuth string
+		allow      []string
+	}{
+		{"invalid client auth", files.cert, files.ca, "sometimes", nil},
+		{"require without ca", files.cert, "", clientAuthRequire, nil},
+		{"allow without ca", files.cert, "", clientAuthOptional, []string{"foo"}},
+		{"missing cert", filepath.Join("testdata", "missing.crt"), files.ca, clientAuthOptional, nil},
+		{"invalid ca", files.cert, files.key, clientAuthOptional, nil},
+	}
+
+	for _, tst := range tests {
+		t.Log(tst.name)
+		if _, err := newTLSReloader(tst.cert, files.key, tst.caFile, tst.clientAuth, tst.allow, log.Logger); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("no client ca")
+	{
+		r, err := newTLSReloader(files.cert, files.key, "", "", nil, log.Logger)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		cfg, _ := r.getConfigForClient(nil)
+		if cfg.ClientAuth != tls.NoClientCert {
+			t.Fatalf("expected no client cert, got %v", cfg.ClientAuth)
+		}
+	}
+}
+
+func TestTLSClientVerification(t *testing.T) {
+	t.Log("Testing client certificate verification")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	ca := newTestCA(t)
+	other := newTestCA(t)
+
+	t.Log("optional")
+	{
+		ts, _ := newTestTLSServer(t, ca, http.HandlerFunc(okHandler), clientAuthOptional, nil)
+		defer ts.Close()
+		for _, cn := range []string{"", "client01"} {
+			resp, err := ca.client(t, cn).Get(ts.URL)
+			if err != nil {
+				t.Fatalf("(%s) expected NO error, got (%s)", cn, err)
+			}
+			resp.Body.Close()
+		}
+
+		t.Log("untrusted client cert")
+		oc := other.client(t, "client01")
+		oc.Transport.(*http.Transport).TLSClientConfig.RootCAs = ca.client(t, "").Transport.(*http.Transport).TLSClientConfig.RootCAs
+		if _, err := oc.Get(ts.URL); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("require")
+	{
+		ts, _ := newTestTLSServer(t, ca, http.HandlerFunc(okHandler), clientAuthRequire, nil)
+		defer ts.Close()
+		if _, err := ca.client(t, "").Get(ts.URL); err == nil {
+			t.Fatal("expected error")
+		}
+		resp, err := ca.client(t, "client01").Get(ts.URL)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		resp.Body.Close()
+	}
+
+	t.Log("allowlist")
+	{
+		ts, _ := newTestTLSServer(t, ca, http.HandlerFunc(okHandler), clientAuthRequire, []string{"client01", "broker.example.com"})
+		defer ts.Close()
+
+		tests := []struct {
+			cn      string
+			dns     []string
+			allowed bool
+		}{
+			{"client01", nil, true},
+			{"foo", []string{"broker.example.com"}, true},
+			{"client02", nil, false},
+		}
+		for _, tst := range tests {
+			t.Logf("cn %s", tst.cn)
+			resp, err := ca.client(t, tst.cn, tst.dns...).Get(ts.URL)
+			if tst.allowed {
+				if err != nil {
+					t.Fatalf("expected NO error, got (%s)", err)
+				}
+				resp.Body.Close()
+			} else if err == nil {
+				resp.Body.Close()
+				t.Fatal("expected error")
+			}
+		}
+	}
+
+	t.Log("allowlist, optional, no client cert")
+	{
+		ts, _ := newTestTLSServer(t, ca, http.HandlerFunc(okHandler), clientAuthOptional, []string{"client01"})
+		defer ts.Close()
+		if resp, err := ca.client(t, "").Get(ts.URL); err == nil {
+			resp.Body.Close()
+			t.Fatal("expected error")
+		}
+		resp, err := ca.client(t, "client01").Get(ts.URL)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestTLSReload(t *testing.T) {
+	t.Log("Testing certificate reload")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	ca := newTestCA(t)
+	ts, files := newTestTLSServer(t, ca, http.HandlerFunc(okHandler), clientAuthRequire, nil)
+	defer ts.Close()
+
+	serverCN := func(c *http.Client) (string, error) {
+		resp, err := c.Get(ts.URL)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	cn, err := serverCN(ca.client(t, "client01"))
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	if cn != "agent" {
+		t.Fatalf("expected agent, got %s", cn)
+	}
+
+	t.Log("server cert/key")
+	{
+		certPEM, keyPEM := ca.issue(t, "agent-renewed")
+		mtime := time.Now().Add(time.Minute)
+		files.write(t, files.cert, certPEM, mtime)
+		files.write(t, files.key, keyPEM, mtime)
+		cn, err := serverCN(ca.client(t, "client01"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if cn != "agent-renewed" {
+			t.Fatalf("expected agent-renewed, got %s", cn)
+		}
+	}
+
+	t.Log("invalid cert keeps previous")
+	{
+		files.write(t, files.cert, []byte("invalid"), time.Now().Add(2*time.Minute))
+		cn, err := serverCN(ca.client(t, "client01"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if cn != "agent-renewed" {
+			t.Fatalf("expected agent-renewed, got %s", cn)
+		}
+	}
+
+	t.Log("client ca")
+	{
+		newCA := newTestCA(t)
+		certPEM, keyPEM := ca.issue(t, "agent")
+		mtime := time.Now().Add(3 * time.Minute)
+		files.write(t, files.cert, certPEM, mtime)
+		files.write(t, files.key, keyPEM, mtime)
+		files.write(t, files.ca, newCA.pem, mtime)
+
+		// server cert still from the original ca, client certs must be from the new ca
+		c := newCA.client(t, "client01")
+		c.Transport.(*http.Transport).TLSClientConfig.RootCAs = ca.client(t, "").Transport.(*http.Transport).TLSClientConfig.RootCAs
+		if _, err := serverCN(c); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if _, err := serverCN(ca.client(t, "client01")); err == nil {
+			t.Fatal("expected error, client cert from previous ca")
+		}
+	}
+}
+
+func TestTLSReloadInterval(t *testing.T) {
+	t.Log("Testing certificate reload check interval")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	files := testTLSFiles{
+		cert: filepath.Join(dir, "server.pem"),
+		key:  filepath.Join(dir, "server.key"),
+	}
+	certPEM, keyPEM := ca.issue(t, "agent")
+	now := time.Now()
+	files.write(t, files.cert, certPEM, now)
+	files.write(t, files.key, keyPEM, now)
+
+	r, err := newTLSReloader(files.cert, files.key, "", "", nil, log.Logger)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	initial, _ := r.getConfigForClient(nil)
+
+	certPEM, keyPEM = ca.issue(t, "agent-renewed")
+	mtime := now.Add(time.Minute)
+	files.write(t, files.cert, certPEM, mtime)
+	files.write(t, files.key, keyPEM, mtime)
+
+	t.Log("within interval, not checked")
+	{
+		if cfg, _ := r.getConfigForClient(nil); cfg != initial {
+			t.Fatal("expected previous config within check interval")
+		}
+	}
+
+	t.Log("after interval, reloaded")
+	{
+		r.lastCheck = time.Now().Add(-tlsReloadInterval)
+		if cfg, _ := r.getConfigForClient(nil); cfg == initial {
+			t.Fatal("expected reloaded config after check interval")
+		}
+	}
+}
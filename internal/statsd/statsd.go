@@ -15,6 +15,7 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -70,6 +71,8 @@ type Server struct {
 	debugMetricParsing bool
 }
 
+var errListenerNotBound = fmt.Errorf("listener not bound")
+
 const (
 	maxPacketSize = 1472
 	// packetQueueSize = 20000.
@@ -226,21 +229,26 @@ func (s *Server) Start() error {
 
 		_ = s.group.Wait()
 		close(packetCh)
-		// only try to flush group metrics since they go
-		// directly to a broker. there is no point in trying
-		// to flush host metrics as the 'server' portion of
-		// the agent may have already closed.
-		if s.groupMetrics != nil {
-			s.logger.Info().Msg("flushing group metrics")
-			s.groupMetricsmu.Lock()
-			s.groupMetrics.Flush()
-			s.groupMetricsmu.Unlock()
-		}
+		// group metrics are flushed by the agent when stopping (FlushGroup),
+		// once the listening servers have drained in-flight requests.
 	}()
 
 	return s.group.Wait() //nolint:wrapcheck
 }
 
+// FlushGroup submits the group metrics accumulated since the last submission,
+// e.g. when the agent is stopping.
+func (s *Server) FlushGroup() {
+	if s.disabled || s.groupMetrics == nil {
+		return
+	}
+
+	s.logger.Info().Msg("flushing group metrics")
+	s.groupMetricsmu.Lock()
+	s.groupMetrics.Flush()
+	s.groupMetricsmu.Unlock()
+}
+
 // Flush *host* metrics only
 // NOTE: group metrics flush independently to a different check via circonus-gometrics.
 func (s *Server) Flush() *cgm.Metrics {
@@ -258,6 +266,49 @@ func (s *Server) Flush() *cgm.Metrics {
 	return s.hostMetrics.FlushMetrics()
 }
 
+// Snapshot returns a copy of the current *host* metrics, without resetting them.
+func (s *Server) Snapshot() *cgm.Metrics {
+	if s.disabled {
+		return nil
+	}
+
+	s.hostMetricsmu.Lock()
+	defer s.hostMetricsmu.Unlock()
+
+	if s.hostMetrics == nil {
+		return &cgm.Metrics{}
+	}
+
+	return s.hostMetrics.FlushMetricsNoReset()
+}
+
+// Health returns the bound listener addresses, for readiness. An error is
+// returned if an enabled listener is not bound.
+func (s *Server) Health() (string, error) {
+	if s.disabled {
+		return "disabled", nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	var addrs []string
+	if s.enableUDPListener && s.udpAddress != nil {
+		if s.udpListener == nil {
+			return "", errListenerNotBound
+		}
+		addrs = append(addrs, "udp "+s.udpListener.LocalAddr().String())
+	}
+	if s.enableTCPListener && s.tcpAddress != nil {
+		if s.tcpListener == nil {
+			return "", errListenerNotBound
+		}
+		addrs = append(addrs, "tcp "+s.tcpListener.Addr().String())
+	}
+
+	return strings.Join(addrs, ", "), nil
+}
+
 // startUDP the StatsD UDP listener.
 func (s *Server) startUDP() error {
 	if !s.enableUDPListener {
@@ -270,7 +321,9 @@ func (s *Server) startUDP() error {
 	if err != nil {
 		return fmt.Errorf("starting statsd udp listener: %w", err)
 	}
+	s.Lock()
 	s.udpListener = l
+	s.Unlock()
 	return nil
 }
 
@@ -286,7 +339,9 @@ func (s *Server) startTCP() error {
 	if err != nil {
 		return fmt.Errorf("starting statsd tcp listener: %w", err)
 	}
+	s.Lock()
 	s.tcpListener = l
+	s.Unlock()
 	return nil
 }
 
@@ -183,6 +183,56 @@ func TestFlush(t *testing.T) {
 	}
 }
 
+func TestSnapshot(t *testing.T) {
+	t.Log("Testing Snapshot")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("Snapshot (disabled)")
+	{
+		viper.Set(config.KeyStatsdDisabled, true)
+		s, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		metrics := s.Snapshot()
+		viper.Reset()
+
+		if metrics != nil {
+			t.Fatalf("expected nil, got (%#v)", metrics)
+		}
+	}
+
+	t.Log("Snapshot (stats, not reset)")
+	{
+		viper.Set(config.KeyStatsdDisabled, false)
+		viper.Set(config.KeyStatsdPort, "65125")
+		viper.Set(config.KeyStatsdHostCategory, defaults.StatsdHostCategory)
+		s, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		s.hostMetrics.Increment("test")
+		for i := 0; i < 2; i++ {
+			metrics := s.Snapshot()
+			if metrics == nil {
+				t.Fatal("expected not nil")
+				return
+			}
+			if len(*metrics) != 1 {
+				t.Fatalf("expected 1 metric, got (%#v)", metrics)
+			}
+		}
+		if metrics := s.Flush(); len(*metrics) != 1 {
+			t.Fatalf("expected 1 metric, got (%#v)", metrics)
+		}
+		if metrics := s.Snapshot(); len(*metrics) != 0 {
+			t.Fatalf("expected empty metrics, got (%#v)", metrics)
+		}
+		viper.Reset()
+	}
+}
+
 func TestValidateStatsdOptions(t *testing.T) {
 	t.Log("Testing validateStatsdOptions")
 
@@ -515,3 +565,56 @@ func TestValidateStatsdOptions(t *testing.T) {
 
 	viper.Reset()
 }
+
+func TestHealth(t *testing.T) {
+	t.Log("Testing Health")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("Health (disabled)")
+	{
+		viper.Set(config.KeyStatsdDisabled, true)
+		s, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		viper.Reset()
+
+		detail, herr := s.Health()
+		if herr != nil {
+			t.Fatalf("expected NO error, got (%s)", herr)
+		}
+		if detail != "disabled" {
+			t.Fatalf("expected disabled, got (%s)", detail)
+		}
+	}
+
+	t.Log("Health (listener not bound, bound)")
+	{
+		viper.Set(config.KeyStatsdDisabled, false)
+		viper.Set(config.KeyStatsdPort, "65125")
+		viper.Set(config.KeyStatsdHostCategory, defaults.StatsdHostCategory)
+		s, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		viper.Reset()
+
+		if _, herr := s.Health(); herr == nil {
+			t.Fatal("expected error")
+		}
+
+		if err := s.startUDP(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		defer s.udpListener.Close()
+
+		detail, herr := s.Health()
+		if herr != nil {
+			t.Fatalf("expected NO error, got (%s)", herr)
+		}
+		if !strings.HasPrefix(detail, "udp ") {
+			t.Fatalf("expected udp listener, got (%s)", detail)
+		}
+	}
+}
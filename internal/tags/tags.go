@@ -204,6 +204,44 @@ func MergeTags(metricName string, metricTags []string) string {
 	return mn
 }
 
+// ParseMetricName splits a metric name into the base name and the stream
+// tags, if any. Base64 encoded (b"...") tag categories and values are decoded.
+func ParseMetricName(metricName string) (string, Tags) {
+	p := strings.SplitN(metricName, "|ST[", 2)
+	if len(p) != 2 {
+		return metricName, Tags{}
+	}
+
+	tagList := strings.TrimSuffix(p[1], "]")
+	if tagList == "" {
+		return p[0], Tags{}
+	}
+
+	parts := strings.Split(tagList, Separator)
+	mtags := make(Tags, 0, len(parts))
+	for _, part := range parts {
+		tp := strings.SplitN(part, Delimiter, 2)
+		if len(tp) != 2 {
+			continue
+		}
+		mtags = append(mtags, Tag{Category: decodeTagPart(tp[0]), Value: decodeTagPart(tp[1])})
+	}
+
+	return p[0], mtags
+}
+
+// decodeTagPart decodes a base64 encoded (b"...") tag category or value.
+func decodeTagPart(s string) string {
+	if !strings.HasPrefix(s, `b"`) || !strings.HasSuffix(s, `"`) || len(s) < 3 {
+		return s
+	}
+	data, err := base64.StdEncoding.DecodeString(s[2 : len(s)-1])
+	if err != nil {
+		return s
+	}
+	return string(data)
+}
+
 // EncodeMetricStreamTags encodes Tags into a string suitable for use with
 // stream tags. Tags directly embedded into metric names using the
 // `metric_name|ST[<tags>]` syntax.
@@ -84,3 +84,41 @@ func TestGetBaseTags(t *testing.T) {
 		t.Fatalf("expected c2:v1, got (%s)", tags[1])
 	}
 }
+
+func TestParseMetricName(t *testing.T) {
+	t.Log("Testing ParseMetricName")
+
+	encoded := MetricNameWithStreamTags("cpu", Tags{
+		Tag{Category: "collector", Value: "procfs/cpu"},
+		Tag{Category: "units", Value: "percent"},
+	})
+
+	tt := []struct {
+		name       string
+		metricName string
+		expectName string
+		expectTags Tags
+	}{
+		{"no tags", "foo", "foo", Tags{}},
+		{"empty tags", "foo|ST[]", "foo", Tags{}},
+		{"plain tags", "foo|ST[c1:v1,c2:v2]", "foo", Tags{Tag{Category: "c1", Value: "v1"}, Tag{Category: "c2", Value: "v2"}}},
+		{"encoded tags", encoded, "cpu", Tags{Tag{Category: "collector", Value: "procfs/cpu"}, Tag{Category: "units", Value: "percent"}}},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\ttest -- %s (%s)", tst.name, tst.metricName)
+
+		name, mtags := ParseMetricName(tst.metricName)
+		if name != tst.expectName {
+			t.Fatalf("expected (%s) got (%s)", tst.expectName, name)
+		}
+		if len(mtags) != len(tst.expectTags) {
+			t.Fatalf("expected %v got %v", tst.expectTags, mtags)
+		}
+		for i, tag := range mtags {
+			if tag != tst.expectTags[i] {
+				t.Fatalf("expected %v got %v", tst.expectTags[i], tag)
+			}
+		}
+	}
+}